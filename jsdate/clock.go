@@ -0,0 +1,177 @@
+package jsdate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTime = errors.New("Invalid time value")
+
+var weekDays = [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+var months = [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// Clock is where a runtime gets the current time and its local time zone
+// from. Both can be replaced, tests freeze Now and pin Location to get
+// reproducible dates. The zero value uses time.Now and time.Local.
+type Clock struct {
+	// Location is the local time zone, time.Local when nil
+	Location *time.Location
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+}
+
+func (c *Clock) location() *time.Location {
+	if c == nil || c.Location == nil {
+		return time.Local
+	}
+	return c.Location
+}
+
+// Time is the time value of the current time, for Date.now and new Date()
+func (c *Clock) Time() float64 {
+	now := time.Now
+	if c != nil && c.Now != nil {
+		now = c.Now
+	}
+	return float64(now().UnixMilli())
+}
+
+// zone returns the abbreviated name of the time zone in effect at the time
+// value t and its offset from UTC in milliseconds
+func (c *Clock) zone(t float64) (string, float64) {
+	name, offset := time.UnixMilli(int64(t)).In(c.location()).Zone()
+	return name, float64(offset) * MS_PER_SECOND
+}
+
+// OffsetAt is the offset of local time from UTC at the time value t in
+// milliseconds
+func (c *Clock) OffsetAt(t float64) float64 {
+	if !isFinite(t) {
+		return 0
+	}
+	_, offset := c.zone(t)
+	return offset
+}
+
+// LocalTime converts a time value to local time
+func (c *Clock) LocalTime(t float64) float64 {
+	return t + c.OffsetAt(t)
+}
+
+// UTC converts local time to a time value. Local times that happen twice
+// when clocks go back, and local times skipped when they go forward, use
+// the offset from before the transition.
+func (c *Clock) UTC(t float64) float64 {
+	if !isFinite(t) {
+		return math.NaN()
+	}
+	before, after := c.OffsetAt(t-MS_PER_DAY), c.OffsetAt(t+MS_PER_DAY)
+	for _, offset := range []float64{before, after} {
+		if c.OffsetAt(t-offset) == offset {
+			return t - offset
+		}
+	}
+	return t - before
+}
+
+func pad(x float64, width int) string {
+	return fmt.Sprintf("%0*d", width, int64(x))
+}
+
+// year formats a year with at least four digits
+func year(y float64) string {
+	if y < 0 {
+		return "-" + pad(-y, 4)
+	}
+	return pad(y, 4)
+}
+
+// ToISOString is Date.prototype.toISOString, years outside of 0 to 9999
+// get six digits and a sign
+func ToISOString(t float64) (string, error) {
+	if math.IsNaN(t) {
+		return "", ErrInvalidTime
+	}
+	y := YearFromTime(t)
+	yearString := pad(y, 4)
+	if y < 0 {
+		yearString = "-" + pad(-y, 6)
+	} else if y > 9999 {
+		yearString = "+" + pad(y, 6)
+	}
+	return fmt.Sprintf("%s-%s-%sT%s:%s:%s.%sZ", yearString, pad(MonthFromTime(t)+1, 2), pad(DateFromTime(t), 2),
+		pad(HourFromTime(t), 2), pad(MinFromTime(t), 2), pad(SecFromTime(t), 2), pad(MsFromTime(t), 3)), nil
+}
+
+// dateString is DateString from ecma-262 21.4.4.41.2, like "Tue Jan 02 2024"
+func dateString(tv float64) string {
+	return weekDays[int(WeekDay(tv))] + " " + months[int(MonthFromTime(tv))] + " " + pad(DateFromTime(tv), 2) + " " + year(YearFromTime(tv))
+}
+
+// timeString is TimeString from ecma-262 21.4.4.41.1, like "03:04:05 GMT"
+func timeString(tv float64) string {
+	return pad(HourFromTime(tv), 2) + ":" + pad(MinFromTime(tv), 2) + ":" + pad(SecFromTime(tv), 2) + " GMT"
+}
+
+// timeZoneString is TimeZoneString from ecma-262 21.4.4.41.3, like
+// "+0100 (CET)"
+func (c *Clock) timeZoneString(t float64) string {
+	name, offset := c.zone(t)
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return sign + pad(math.Floor(offset/MS_PER_HOUR), 2) + pad(MinFromTime(offset), 2) + " (" + name + ")"
+}
+
+// ToString is Date.prototype.toString, like
+// "Tue Jan 02 2024 03:04:05 GMT+0100 (CET)"
+func (c *Clock) ToString(t float64) string {
+	if math.IsNaN(t) {
+		return "Invalid Date"
+	}
+	local := c.LocalTime(t)
+	return dateString(local) + " " + timeString(local) + c.timeZoneString(t)
+}
+
+// ToDateString is Date.prototype.toDateString
+func (c *Clock) ToDateString(t float64) string {
+	if math.IsNaN(t) {
+		return "Invalid Date"
+	}
+	return dateString(c.LocalTime(t))
+}
+
+// ToTimeString is Date.prototype.toTimeString
+func (c *Clock) ToTimeString(t float64) string {
+	if math.IsNaN(t) {
+		return "Invalid Date"
+	}
+	return timeString(c.LocalTime(t)) + c.timeZoneString(t)
+}
+
+// ToUTCString is Date.prototype.toUTCString, like
+// "Tue, 02 Jan 2024 03:04:05 GMT"
+func ToUTCString(t float64) string {
+	if math.IsNaN(t) {
+		return "Invalid Date"
+	}
+	return weekDays[int(WeekDay(t))] + ", " + pad(DateFromTime(t), 2) + " " + months[int(MonthFromTime(t))] + " " + year(YearFromTime(t)) + " " + timeString(t)
+}
+
+func monthIndex(name string) int {
+	if len(name) < 3 {
+		return -1
+	}
+	for i, month := range months {
+		if strings.EqualFold(name[:3], month) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,163 @@
+package jsdate
+
+import (
+	"math"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func newYork(t *testing.T) *Clock {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %s", err.Error())
+	}
+	return &Clock{Location: location}
+}
+
+func TestTimeValues(t *testing.T) {
+	tv := MakeDate(MakeDay(2024, 1, 29), MakeTime(23, 59, 58, 999))
+	parts := []float64{YearFromTime(tv), MonthFromTime(tv), DateFromTime(tv), WeekDay(tv), HourFromTime(tv), MinFromTime(tv), SecFromTime(tv), MsFromTime(tv)}
+	expected := []float64{2024, 1, 29, 4, 23, 59, 58, 999}
+	for i := range parts {
+		if parts[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, parts)
+			break
+		}
+	}
+
+	if day := MakeDay(2023, 13, 32); day != MakeDay(2024, 2, 3) {
+		t.Error("Expected months and days to carry over")
+	}
+	if day := MakeDay(2024, -1, 1); day != MakeDay(2023, 11, 1) {
+		t.Error("Expected negative months to borrow from the year")
+	}
+	if tv := MakeDate(MakeDay(-1, 0, 1), 0); YearFromTime(tv) != -1 || DateFromTime(tv) != 1 || tv != -62198755200000 {
+		t.Errorf("Unexpected time value %v for year -1", tv)
+	}
+	if !math.IsNaN(TimeClip(MAX_TIME+1)) || TimeClip(MAX_TIME) != MAX_TIME || math.Signbit(TimeClip(math.Copysign(0, -1))) {
+		t.Error("Unexpected TimeClip results")
+	}
+	if !math.IsNaN(MakeTime(math.Inf(1), 0, 0, 0)) || !math.IsNaN(MakeDay(1e20, 0, 1)) {
+		t.Error("Expected non-finite parts to give NaN")
+	}
+	if MakeFullYear(99) != 1999 || MakeFullYear(100) != 100 {
+		t.Error("Unexpected MakeFullYear results")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	clock := newYork(t)
+	tv := MakeDate(MakeDay(2024, 0, 2), MakeTime(3, 4, 5, 6))
+
+	if s := clock.ToString(tv); s != "Mon Jan 01 2024 22:04:05 GMT-0500 (EST)" {
+		t.Errorf("Unexpected toString %s", s)
+	}
+	if s := clock.ToDateString(tv); s != "Mon Jan 01 2024" {
+		t.Errorf("Unexpected toDateString %s", s)
+	}
+	if s := clock.ToTimeString(tv); s != "22:04:05 GMT-0500 (EST)" {
+		t.Errorf("Unexpected toTimeString %s", s)
+	}
+	if s := ToUTCString(tv); s != "Tue, 02 Jan 2024 03:04:05 GMT" {
+		t.Errorf("Unexpected toUTCString %s", s)
+	}
+	if s, _ := ToISOString(tv); s != "2024-01-02T03:04:05.006Z" {
+		t.Errorf("Unexpected toISOString %s", s)
+	}
+	if s, _ := ToISOString(-62198755200000); s != "-000001-01-01T00:00:00.000Z" {
+		t.Errorf("Unexpected toISOString %s", s)
+	}
+	if s := ToUTCString(-62198755200000); s != "Fri, 01 Jan -0001 00:00:00 GMT" {
+		t.Errorf("Unexpected toUTCString %s", s)
+	}
+	if _, err := ToISOString(math.NaN()); err != ErrInvalidTime {
+		t.Error("Expected toISOString of an invalid date to fail")
+	}
+	if s := clock.ToString(math.NaN()); s != "Invalid Date" {
+		t.Errorf("Unexpected toString %s", s)
+	}
+}
+
+func TestLocalTime(t *testing.T) {
+	clock := newYork(t)
+
+	summer := MakeDate(MakeDay(2024, 6, 1), 0)
+	if clock.LocalTime(summer) != summer-4*MS_PER_HOUR {
+		t.Error("Expected daylight saving time in July")
+	}
+	// 01:30 happens twice on 2024-11-03 and 02:30 doesn't happen on
+	// 2024-03-10, both use the offset from before the transition
+	if tv := clock.UTC(MakeDate(MakeDay(2024, 10, 3), MakeTime(1, 30, 0, 0))); tv != 1730611800000 {
+		t.Errorf("Unexpected time value %v for a repeated local time", tv)
+	}
+	if tv := clock.UTC(MakeDate(MakeDay(2024, 2, 10), MakeTime(2, 30, 0, 0))); tv != 1710055800000 {
+		t.Errorf("Unexpected time value %v for a skipped local time", tv)
+	}
+
+	frozen := &Clock{Now: func() time.Time { return time.UnixMilli(1704164645000) }}
+	if frozen.Time() != 1704164645000 {
+		t.Error("Expected the injected clock to be used")
+	}
+}
+
+func TestParse(t *testing.T) {
+	clock := newYork(t)
+	tests := map[string]float64{
+		"2024-01-02":                    1704153600000,
+		"2024-01":                       1704067200000,
+		"2024-01-02T10:00":              1704207600000,
+		"2024-01-02T10:00:00.123Z":      1704189600123,
+		"2024-01-02T10:00:00+01:00":     1704186000000,
+		"2024-01-02T24:00":              1704258000000,
+		"+275760-09-13T00:00:00Z":       8640000000000000,
+		"-000001-01-01T00:00:00Z":       -62198755200000,
+		"2024-03-10T02:30":              1710055800000,
+		"2024-11-03T01:30":              1730611800000,
+		"Tue, 02 Jan 2024 03:04:05 GMT": 1704164645000,
+		"Jan 2 2024":                    1704171600000,
+		"January 2, 2024 10:00 PM":      1704250800000,
+		"2 Jan 2024 10:00:00 EST":       1704207600000,
+		"1/2/2024":                      1704171600000,
+		"2024/01/02 10:00":              1704207600000,
+		"1/2/24":                        1704171600000,
+		"12/31/99 23:59:59.5":           946702799500,
+		"2024-01-02 10:00:00Z":          1704189600000,
+		"Jan 2 2024 10:00 -0500":        1704207600000,
+		"2024-01-02T10:00+0100":         1704186000000,
+		"Tue Jan 02 2024 10:00:00 GMT+0100 (Central European Standard Time)": 1704186000000,
+		"Thu, 15 Feb -1199 14:13:20 GMT":                                     -100000000000000,
+		"Tue Apr 20 -271821 00:00:00 GMT+0000":                               -8640000000000000,
+	}
+	for s, expected := range tests {
+		if tv := clock.Parse(s); tv != expected {
+			t.Errorf("Expected %q to be %v, got %v", s, expected, tv)
+		}
+	}
+
+	for _, s := range []string{"", "foo", "2024-02-30", "2024-13-01", "2024-01-02T25:00", "-000000-01-01T00:00:00Z", "+275760-09-13T00:00:00.001Z", "Jan 2024", "Jan 2 +002024"} {
+		if tv := clock.Parse(s); !math.IsNaN(tv) {
+			t.Errorf("Expected %q to be invalid, got %v", s, tv)
+		}
+	}
+
+	tv := MakeDate(MakeDay(2024, 6, 4), MakeTime(12, 30, 15, 0))
+	if parsed := clock.Parse(clock.ToString(tv)); parsed != tv {
+		t.Errorf("Expected toString to round trip, got %v", parsed)
+	}
+	if parsed := clock.Parse(ToUTCString(tv)); parsed != tv {
+		t.Errorf("Expected toUTCString to round trip, got %v", parsed)
+	}
+
+	// Local mean time before 1883 is a few seconds off from the offset
+	// toString prints, negative years round trip through UTC
+	utc := &Clock{Location: time.UTC}
+	for _, tv := range []float64{-62198755200000, -100000000000000, -8.64e15} {
+		if parsed := utc.Parse(utc.ToString(tv)); parsed != tv {
+			t.Errorf("Expected toString of %v to round trip, got %v", tv, parsed)
+		}
+		if parsed := clock.Parse(ToUTCString(tv)); parsed != tv {
+			t.Errorf("Expected toUTCString of %v to round trip, got %v", tv, parsed)
+		}
+	}
+}
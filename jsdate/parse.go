@@ -0,0 +1,376 @@
+package jsdate
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DATE PARSING
+//
+// Date.parse accepts the Date Time String Format from ecma-262 21.4.1.32,
+// and falls back to a legacy parser for the other formats browsers accept:
+// the output of toString and toUTCString, "Jan 2 2024 10:00", "1/2/2024"
+// and so on.
+
+// Parse is Date.parse, NaN when s isn't a date
+func (c *Clock) Parse(s string) float64 {
+	if t, ok := c.parseISO(s); ok {
+		return t
+	}
+	return c.parseLegacy(s)
+}
+
+// isoScanner reads the fixed width fields of the ISO format
+type isoScanner struct {
+	s   string
+	pos int
+}
+
+func (sc *isoScanner) eat(c byte) bool {
+	if sc.pos < len(sc.s) && sc.s[sc.pos] == c {
+		sc.pos++
+		return true
+	}
+	return false
+}
+
+func (sc *isoScanner) digits(n int) (float64, bool) {
+	if sc.pos+n > len(sc.s) {
+		return 0, false
+	}
+	value := 0
+	for _, c := range []byte(sc.s[sc.pos : sc.pos+n]) {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		value = value*10 + int(c-'0')
+	}
+	sc.pos += n
+	return float64(value), true
+}
+
+func (c *Clock) parseISO(s string) (float64, bool) {
+	sc := &isoScanner{s: s}
+
+	var y float64
+	var ok bool
+	if sign := s[:min(1, len(s))]; sign == "+" || sign == "-" {
+		sc.pos++
+		if y, ok = sc.digits(6); !ok || (sign == "-" && y == 0) {
+			return 0, false
+		}
+		if sign == "-" {
+			y = -y
+		}
+	} else if y, ok = sc.digits(4); !ok {
+		return 0, false
+	}
+
+	month, day := 1.0, 1.0
+	if sc.eat('-') {
+		if month, ok = sc.digits(2); !ok || month < 1 || month > 12 {
+			return 0, false
+		}
+		if sc.eat('-') {
+			if day, ok = sc.digits(2); !ok || day < 1 || day > daysInMonth(y, month) {
+				return 0, false
+			}
+		}
+	}
+
+	hour, minute, second, ms := 0.0, 0.0, 0.0, 0.0
+	hasTime, offset, hasOffset := false, 0.0, false
+	if sc.eat('T') || sc.eat('t') {
+		hasTime = true
+		if hour, ok = sc.digits(2); !ok || !sc.eat(':') {
+			return 0, false
+		}
+		if minute, ok = sc.digits(2); !ok {
+			return 0, false
+		}
+		if sc.eat(':') {
+			if second, ok = sc.digits(2); !ok {
+				return 0, false
+			}
+			if sc.eat('.') {
+				start := sc.pos
+				for sc.pos < len(s) && s[sc.pos] >= '0' && s[sc.pos] <= '9' {
+					sc.pos++
+				}
+				if sc.pos == start {
+					return 0, false
+				}
+				// Digits past milliseconds are dropped
+				fraction := (s[start:sc.pos] + "00")[:3]
+				value, _ := strconv.Atoi(fraction)
+				ms = float64(value)
+			}
+		}
+		if hour > 24 || minute > 59 || second > 59 || (hour == 24 && (minute != 0 || second != 0 || ms != 0)) {
+			return 0, false
+		}
+
+		if sc.eat('Z') || sc.eat('z') {
+			hasOffset = true
+		} else if sc.pos < len(s) && (s[sc.pos] == '+' || s[sc.pos] == '-') {
+			sign := 1.0
+			if s[sc.pos] == '-' {
+				sign = -1
+			}
+			sc.pos++
+			offsetHour, okHour := sc.digits(2)
+			colon := sc.eat(':')
+			offsetMinute, okMinute := sc.digits(2)
+			if !okHour || !colon || !okMinute || offsetHour > 23 || offsetMinute > 59 {
+				return 0, false
+			}
+			offset = sign * (offsetHour*MS_PER_HOUR + offsetMinute*MS_PER_MINUTE)
+			hasOffset = true
+		}
+	}
+	if sc.pos != len(s) {
+		return 0, false
+	}
+
+	t := MakeDate(MakeDay(y, month-1, day), MakeTime(hour, minute, second, ms))
+	switch {
+	case hasOffset:
+		t -= offset
+	case hasTime:
+		// Date-time forms without an offset are local time, date-only
+		// forms are UTC
+		t = c.UTC(t)
+	}
+	return TimeClip(t), true
+}
+
+func daysInMonth(y, month float64) float64 {
+	m := int(month) - 1
+	return monthStart(m+1, DaysInYear(y)-365) - monthStart(m, DaysInYear(y)-365)
+}
+
+// Time zone abbreviations the legacy format understands, offsets in hours
+var zoneAbbreviations = map[string]float64{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0,
+	"EST": -5, "EDT": -4, "CST": -6, "CDT": -5,
+	"MST": -7, "MDT": -6, "PST": -8, "PDT": -7,
+}
+
+// legacyToken is a number, a word or a single punctuation character,
+// spaced if it follows a separator or starts the string
+type legacyToken struct {
+	word   string
+	number float64
+	digits int
+	punct  byte
+	spaced bool
+}
+
+func tokenizeLegacy(s string) []legacyToken {
+	tokens := []legacyToken{}
+	spaced := true
+	for i := 0; i < len(s); {
+		c := s[i]
+		count := len(tokens)
+		switch {
+		case c == '(':
+			// Comments, like the time zone name toString appends
+			depth := 0
+			for ; i < len(s); i++ {
+				if s[i] == '(' {
+					depth++
+				} else if s[i] == ')' {
+					depth--
+					if depth == 0 {
+						i++
+						break
+					}
+				}
+			}
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+			value, _ := strconv.ParseFloat(s[start:i], 64)
+			tokens = append(tokens, legacyToken{number: value, digits: i - start})
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z') {
+				i++
+			}
+			tokens = append(tokens, legacyToken{word: strings.ToUpper(s[start:i])})
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			spaced = true
+			i++
+			continue
+		default:
+			tokens = append(tokens, legacyToken{punct: c})
+			i++
+		}
+		if len(tokens) > count {
+			tokens[count].spaced = spaced
+			spaced = false
+		}
+	}
+	return tokens
+}
+
+func (c *Clock) parseLegacy(s string) float64 {
+	tokens := tokenizeLegacy(s)
+	at := func(i int) legacyToken {
+		if i < len(tokens) {
+			return tokens[i]
+		}
+		return legacyToken{punct: 0xFF}
+	}
+
+	month := -1.0
+	numbers := []legacyToken{}
+	hour, minute, second, ms := 0.0, 0.0, 0.0, 0.0
+	hasTime, offset, hasOffset := false, 0.0, false
+	pm, am := false, false
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case token.digits > 0 && at(i+1).punct == ':' && !hasTime:
+			// hh:mm[:ss[.sss]]
+			hasTime = true
+			hour = token.number
+			if at(i+2).digits == 0 {
+				return math.NaN()
+			}
+			minute = at(i + 2).number
+			i += 2
+			if at(i+1).punct == ':' && at(i+2).digits > 0 {
+				second = at(i + 2).number
+				i += 2
+				if at(i+1).punct == '.' && at(i+2).digits > 0 {
+					fraction := at(i + 2)
+					ms = math.Floor(fraction.number * 1000 / math.Pow(10, float64(fraction.digits)))
+					i += 2
+				}
+			}
+		case token.digits > 0:
+			numbers = append(numbers, token)
+		case token.punct == '+' || token.punct == '-':
+			next := at(i + 1)
+			if next.digits == 0 {
+				if token.punct == '-' {
+					continue
+				}
+				return math.NaN()
+			}
+			// A sign after the time or after GMT is an offset, anywhere
+			// else it separates the parts of the date
+			if !hasTime && !hasOffset {
+				if next.digits > 4 && (token.punct == '+' || month < 0) {
+					// Signed six digit years are only valid in the ISO
+					// format, or negative after the month name
+					return math.NaN()
+				}
+				if token.punct == '-' && token.spaced && !next.spaced {
+					// A minus that starts a number is a negative year, the
+					// way toString and toUTCString print them
+					numbers = append(numbers, legacyToken{number: -next.number, digits: next.digits})
+					i++
+				}
+				continue
+			}
+			sign := 1.0
+			if token.punct == '-' {
+				sign = -1
+			}
+			hours, minutes := next.number, 0.0
+			if next.digits > 2 {
+				hours, minutes = math.Floor(next.number/100), math.Mod(next.number, 100)
+			} else if at(i+2).punct == ':' && at(i+3).digits > 0 {
+				minutes = at(i + 3).number
+				i += 2
+			}
+			offset = sign * (hours*MS_PER_HOUR + minutes*MS_PER_MINUTE)
+			hasOffset = true
+			i++
+		case token.punct == '/' || token.punct == '.':
+		case token.word != "":
+			if zone, found := zoneAbbreviations[token.word]; found {
+				offset = zone * MS_PER_HOUR
+				hasOffset = true
+			} else if token.word == "AM" || token.word == "A" && at(i+1).punct == '.' {
+				am = true
+			} else if token.word == "PM" || token.word == "P" && at(i+1).punct == '.' {
+				pm = true
+			} else if index := monthIndex(token.word); index >= 0 && month < 0 {
+				month = float64(index)
+			} else if !isWeekDay(token.word) && token.word != "T" {
+				return math.NaN()
+			}
+		default:
+			return math.NaN()
+		}
+	}
+
+	var year legacyToken
+	var day float64
+	switch {
+	case month >= 0 && len(numbers) == 2:
+		// Jan 2 2024, 2 Jan 2024 or 2024 Jan 2
+		day, year = numbers[0].number, numbers[1]
+		if numbers[0].digits > 2 {
+			year, day = numbers[0], numbers[1].number
+		}
+	case month < 0 && len(numbers) == 3:
+		// 2024/01/02 or 1/2/2024
+		if numbers[0].digits > 2 {
+			year, month, day = numbers[0], numbers[1].number-1, numbers[2].number
+		} else {
+			month, day, year = numbers[0].number-1, numbers[1].number, numbers[2]
+		}
+	default:
+		return math.NaN()
+	}
+	y := year.number
+	if year.digits <= 2 && y >= 0 {
+		// Two digit years are 1950 to 2049
+		if y < 50 {
+			y += 2000
+		} else {
+			y += 1900
+		}
+	}
+
+	if am || pm {
+		if hour < 1 || hour > 12 {
+			return math.NaN()
+		}
+		hour = math.Mod(hour, 12)
+		if pm {
+			hour += 12
+		}
+	}
+	if month < 0 || month > 11 || day < 1 || day > daysInMonth(y, month+1) || hour > 24 || minute > 59 || second > 59 {
+		return math.NaN()
+	}
+
+	t := MakeDate(MakeDay(y, month, day), MakeTime(hour, minute, second, ms))
+	if hasOffset {
+		t -= offset
+	} else {
+		t = c.UTC(t)
+	}
+	return TimeClip(t)
+}
+
+func isWeekDay(word string) bool {
+	if len(word) < 3 {
+		return false
+	}
+	for _, name := range weekDays {
+		if strings.EqualFold(word[:3], name) {
+			return true
+		}
+	}
+	return false
+}
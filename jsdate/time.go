@@ -0,0 +1,203 @@
+package jsdate
+
+import "math"
+
+// TIME VALUES
+//
+// The abstract operations on time values from ecma-262 21.4.1. A time value
+// is a float64 counting milliseconds since the epoch in UTC, NaN for an
+// invalid date. Dates are proleptic Gregorian and ignore leap seconds.
+
+const (
+	MS_PER_SECOND = 1000.0
+	MS_PER_MINUTE = 60000.0
+	MS_PER_HOUR   = 3600000.0
+	MS_PER_DAY    = 86400000.0
+
+	// Time values are limited to 100,000,000 days either side of the epoch
+	MAX_TIME = 8.64e15
+)
+
+func isFinite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
+
+// mod is the mathematical modulo, the result has the sign of y
+func mod(x, y float64) float64 {
+	m := math.Mod(x, y)
+	if m != 0 && (m < 0) != (y < 0) {
+		m += y
+	}
+	return m + 0
+}
+
+// toInteger is ToIntegerOrInfinity for a number
+func toInteger(x float64) float64 {
+	if math.IsNaN(x) {
+		return 0
+	}
+	return math.Trunc(x) + 0
+}
+
+// Day is the number of the day t falls on
+func Day(t float64) float64 {
+	return math.Floor(t / MS_PER_DAY)
+}
+
+// TimeWithinDay is the number of milliseconds since the start of the day
+func TimeWithinDay(t float64) float64 {
+	return mod(t, MS_PER_DAY)
+}
+
+// DaysInYear is 366 for leap years, 365 otherwise
+func DaysInYear(y float64) float64 {
+	switch {
+	case mod(y, 4) != 0:
+		return 365
+	case mod(y, 100) != 0:
+		return 366
+	case mod(y, 400) != 0:
+		return 365
+	}
+	return 366
+}
+
+// DayFromYear is the day number of the first day of year y
+func DayFromYear(y float64) float64 {
+	return 365*(y-1970) + math.Floor((y-1969)/4) - math.Floor((y-1901)/100) + math.Floor((y-1601)/400)
+}
+
+// TimeFromYear is the time value at the start of year y
+func TimeFromYear(y float64) float64 {
+	return MS_PER_DAY * DayFromYear(y)
+}
+
+// YearFromTime is the year t falls in
+func YearFromTime(t float64) float64 {
+	y := math.Floor(t/(MS_PER_DAY*365.2425)) + 1970
+	for TimeFromYear(y) > t {
+		y--
+	}
+	for TimeFromYear(y+1) <= t {
+		y++
+	}
+	return y
+}
+
+// InLeapYear is 1 when t falls in a leap year, 0 otherwise
+func InLeapYear(t float64) float64 {
+	return DaysInYear(YearFromTime(t)) - 365
+}
+
+// DayWithinYear is the day of the year, from 0
+func DayWithinYear(t float64) float64 {
+	return Day(t) - DayFromYear(YearFromTime(t))
+}
+
+// monthStarts holds the day within a year each month starts on, without
+// the leap day
+var monthStarts = [13]float64{0, 31, 59, 90, 120, 151, 181, 212, 243, 273, 304, 334, 365}
+
+func monthStart(month int, leap float64) float64 {
+	if month >= 2 {
+		return monthStarts[month] + leap
+	}
+	return monthStarts[month]
+}
+
+// MonthFromTime is the month t falls in, from 0 for January
+func MonthFromTime(t float64) float64 {
+	day, leap := DayWithinYear(t), InLeapYear(t)
+	month := 0
+	for month < 11 && day >= monthStart(month+1, leap) {
+		month++
+	}
+	return float64(month)
+}
+
+// DateFromTime is the day of the month, from 1
+func DateFromTime(t float64) float64 {
+	return DayWithinYear(t) - monthStart(int(MonthFromTime(t)), InLeapYear(t)) + 1
+}
+
+// WeekDay is the day of the week, from 0 for Sunday
+func WeekDay(t float64) float64 {
+	return mod(Day(t)+4, 7)
+}
+
+// HourFromTime is the hour of the day
+func HourFromTime(t float64) float64 {
+	return mod(math.Floor(t/MS_PER_HOUR), 24)
+}
+
+// MinFromTime is the minute of the hour
+func MinFromTime(t float64) float64 {
+	return mod(math.Floor(t/MS_PER_MINUTE), 60)
+}
+
+// SecFromTime is the second of the minute
+func SecFromTime(t float64) float64 {
+	return mod(math.Floor(t/MS_PER_SECOND), 60)
+}
+
+// MsFromTime is the millisecond of the second
+func MsFromTime(t float64) float64 {
+	return mod(t, MS_PER_SECOND)
+}
+
+// MakeTime computes a number of milliseconds from its parts, which don't
+// have to be in range
+func MakeTime(hour, min, sec, ms float64) float64 {
+	if !isFinite(hour) || !isFinite(min) || !isFinite(sec) || !isFinite(ms) {
+		return math.NaN()
+	}
+	return toInteger(hour)*MS_PER_HOUR + toInteger(min)*MS_PER_MINUTE + toInteger(sec)*MS_PER_SECOND + toInteger(ms)
+}
+
+// MakeDay computes a day number from a year, a month from 0 and a day of
+// the month from 1. Months and days outside of their range carry over.
+func MakeDay(year, month, date float64) float64 {
+	if !isFinite(year) || !isFinite(month) || !isFinite(date) {
+		return math.NaN()
+	}
+	y, m, dt := toInteger(year), toInteger(month), toInteger(date)
+	ym := y + math.Floor(m/12)
+	if !isFinite(ym) || math.Abs(ym) > 400000 {
+		// Far outside of the time value range, which TimeClip rejects anyway
+		return math.NaN()
+	}
+	mn := int(mod(m, 12))
+	return DayFromYear(ym) + monthStart(mn, DaysInYear(ym)-365) + dt - 1
+}
+
+// MakeDate combines a day number and a time within the day
+func MakeDate(day, time float64) float64 {
+	if !isFinite(day) || !isFinite(time) {
+		return math.NaN()
+	}
+	tv := day*MS_PER_DAY + time
+	if !isFinite(tv) {
+		return math.NaN()
+	}
+	return tv
+}
+
+// MakeFullYear maps the years 0 to 99 to 1900 to 1999, as the Date
+// constructor and Date.UTC do
+func MakeFullYear(year float64) float64 {
+	if math.IsNaN(year) {
+		return year
+	}
+	if truncated := toInteger(year); truncated >= 0 && truncated <= 99 {
+		return 1900 + truncated
+	}
+	return year
+}
+
+// TimeClip turns t into a valid time value, NaN when it's out of range
+func TimeClip(t float64) float64 {
+	if !isFinite(t) || math.Abs(t) > MAX_TIME {
+		return math.NaN()
+	}
+	return toInteger(t)
+}
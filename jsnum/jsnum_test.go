@@ -0,0 +1,243 @@
+package jsnum
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToString(t *testing.T) {
+	tests := map[float64]string{
+		0:                       "0",
+		math.Copysign(0, -1):    "0",
+		1:                       "1",
+		-1.5:                    "-1.5",
+		0.1:                     "0.1",
+		123456789:               "123456789",
+		1e21:                    "1e+21",
+		1e20:                    "100000000000000000000",
+		123e-20:                 "1.23e-18",
+		0.000001:                "0.000001",
+		0.0000001:               "1e-7",
+		1.5e-7:                  "1.5e-7",
+		math.MaxFloat64:         "1.7976931348623157e+308",
+		5e-324:                  "5e-324",
+		math.Inf(1):             "Infinity",
+		math.Inf(-1):            "-Infinity",
+		9007199254740993:        "9007199254740992",
+		-1234.5678:              "-1234.5678",
+		111111111111111111111.0: "111111111111111110000",
+	}
+	for x, expected := range tests {
+		if s := ToString(x); s != expected {
+			t.Errorf("Expected %v to be %s, got %s", x, expected, s)
+		}
+	}
+	sum := 0.1
+	sum += 0.2
+	if s := ToString(sum); s != "0.30000000000000004" {
+		t.Errorf("Expected 0.30000000000000004, got %s", s)
+	}
+	if s := ToString(math.NaN()); s != "NaN" {
+		t.Errorf("Expected NaN, got %s", s)
+	}
+}
+
+func TestToStringRadix(t *testing.T) {
+	tests := []struct {
+		x        float64
+		radix    int
+		expected string
+	}{
+		{255, 16, "ff"},
+		{-255, 2, "-11111111"},
+		{0.5, 2, "0.1"},
+		{0.1, 3, "0.0022002200220022002200220022002201"},
+		{3.75, 16, "3.c"},
+		{1e21, 36, "5v1j4f4ds7c000"},
+		{math.Pi, 7, "3.066365143203613411"},
+		{1.0 / 3, 2, "0.010101010101010101010101010101010101010101010101010101"},
+		{255.5, 16, "ff.8"},
+		{-0.000001, 36, "-0.0001ogs5wo29m8"},
+		{1 << 60, 2, "1" + "000000000000000000000000000000000000000000000000000000000000"},
+		{35, 36, "z"},
+		{0.1, 16, "0.1999999999999a"},
+		{math.Copysign(0, -1), 2, "0"},
+		{math.Inf(-1), 16, "-Infinity"},
+		{12.5, 10, "12.5"},
+	}
+	for _, test := range tests {
+		s, err := ToStringRadix(test.x, test.radix)
+		if err != nil || s != test.expected {
+			t.Errorf("Expected (%v).toString(%d) to be %s, got %s", test.x, test.radix, test.expected, s)
+		}
+	}
+	if _, err := ToStringRadix(1, 37); err != ErrRadix {
+		t.Error("Expected radix 37 to be out of range")
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	fixed := []struct {
+		x        float64
+		digits   int
+		expected string
+	}{
+		{0, 2, "0.00"},
+		{1.005, 2, "1.00"},
+		{1.45, 1, "1.4"},
+		{0.5, 0, "1"},
+		{2.5, 0, "3"},
+		{-1.5, 0, "-2"},
+		{-0.0001, 2, "-0.00"},
+		{123.456, 10, "123.4560000000"},
+		{0.000001, 7, "0.0000010"},
+		{1e21, 2, "1e+21"},
+		{99.99, 1, "100.0"},
+		{4.35, 1, "4.3"},
+		{1e-10, 20, "0.00000000010000000000"},
+		{1000000000000000128, 0, "1000000000000000128"},
+	}
+	for _, test := range fixed {
+		if s, _ := ToFixed(test.x, test.digits); s != test.expected {
+			t.Errorf("Expected (%v).toFixed(%d) to be %s, got %s", test.x, test.digits, test.expected, s)
+		}
+	}
+
+	exponential := []struct {
+		x        float64
+		digits   int
+		expected string
+	}{
+		{0, 2, "0.00e+0"},
+		{123456, 2, "1.23e+5"},
+		{0.00015, 1, "1.5e-4"},
+		{-9.99, 1, "-1.0e+1"},
+		{1, 0, "1e+0"},
+		{0.5, 0, "5e-1"},
+	}
+	for _, test := range exponential {
+		if s, _ := ToExponential(test.x, test.digits); s != test.expected {
+			t.Errorf("Expected (%v).toExponential(%d) to be %s, got %s", test.x, test.digits, test.expected, s)
+		}
+	}
+	if s := ToExponentialShortest(-123.456); s != "-1.23456e+2" {
+		t.Errorf("Unexpected toExponential() %s", s)
+	}
+
+	precision := []struct {
+		x        float64
+		digits   int
+		expected string
+	}{
+		{0, 3, "0.00"},
+		{123.456, 4, "123.5"},
+		{123.456, 2, "1.2e+2"},
+		{0.000123, 2, "0.00012"},
+		{0.0000001234, 2, "1.2e-7"},
+		{1e21, 3, "1.00e+21"},
+		{-99.99, 3, "-100"},
+		{5e-324, 1, "5e-324"},
+		{1.25, 2, "1.3"},
+	}
+	for _, test := range precision {
+		if s, _ := ToPrecision(test.x, test.digits); s != test.expected {
+			t.Errorf("Expected (%v).toPrecision(%d) to be %s, got %s", test.x, test.digits, test.expected, s)
+		}
+	}
+
+	if _, err := ToFixed(1, 101); err != ErrFractionDigits {
+		t.Error("Expected toFixed(101) to be out of range")
+	}
+	if s, err := ToExponential(math.Inf(1), -5); err != nil || s != "Infinity" {
+		t.Error("Expected toExponential to check for Infinity before the range of its argument")
+	}
+	if _, err := ToPrecision(1, 0); err != ErrPrecision {
+		t.Error("Expected toPrecision(0) to be out of range")
+	}
+}
+
+func TestStringToNumber(t *testing.T) {
+	tests := map[string]float64{
+		"":                      0,
+		"  \n\t ":               0,
+		"42":                    42,
+		" -4.5e3 ":              -4500,
+		"+.5":                   0.5,
+		"5.":                    5,
+		"0x1F":                  31,
+		"0o17":                  15,
+		"0B101":                 5,
+		"0x20000000000001":      9007199254740992,
+		"0x20000000000003":      9007199254740996,
+		"-Infinity":             math.Inf(-1),
+		"1e1000":                math.Inf(1),
+		"\u00a0\ufeff12\u2028":  12,
+		"010":                   10,
+		"9007199254740993":      9007199254740992,
+		"0.1e-400":              0,
+		"00000000000000000001.": 1,
+	}
+	for s, expected := range tests {
+		if x := StringToNumber(s); x != expected {
+			t.Errorf("Expected %q to be %v, got %v", s, expected, x)
+		}
+	}
+
+	for _, s := range []string{"abc", "1_000", "0x", "-0x10", "1e", ".", "infinity", "1 2", "0b2", "Infinityx", "e5", "1.2.3"} {
+		if x := StringToNumber(s); !math.IsNaN(x) {
+			t.Errorf("Expected %q to be NaN, got %v", s, x)
+		}
+	}
+}
+
+func TestStringToBigInt(t *testing.T) {
+	tests := map[string]string{
+		"":                               "0",
+		" -123 ":                         "-123",
+		"0xff":                           "255",
+		"123456789012345678901234567890": "123456789012345678901234567890",
+	}
+	for s, expected := range tests {
+		if n, ok := StringToBigInt(s); !ok || n.String() != expected {
+			t.Errorf("Expected %q to be %s, got %v", s, expected, n)
+		}
+	}
+	for _, s := range []string{"1.5", "1e3", "-0x1", "0x", "1n", "Infinity"} {
+		if _, ok := StringToBigInt(s); ok {
+			t.Errorf("Expected %q not to be a BigInt", s)
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		s        string
+		radix    int
+		expected float64
+	}{
+		{"  42px", 0, 42},
+		{"-0x1A", 0, -26},
+		{"0x1A", 16, 26},
+		{"0x1A", 10, 0},
+		{"z", 36, 35},
+		{"0b11", 0, 0},
+		{"777", 8, 511},
+		{"12345678901234567890123", 10, 12345678901234567890123},
+	}
+	for _, test := range tests {
+		if x := ParseInt(test.s, test.radix); x != test.expected {
+			t.Errorf("Expected parseInt(%q, %d) to be %v, got %v", test.s, test.radix, test.expected, x)
+		}
+	}
+	if x := ParseInt("-0", 0); x != 0 || !math.Signbit(x) {
+		t.Error("Expected parseInt(\"-0\") to be -0")
+	}
+	for _, s := range []string{"", "px", "-", "0x"} {
+		if x := ParseInt(s, 0); !math.IsNaN(x) {
+			t.Errorf("Expected parseInt(%q) to be NaN, got %v", s, x)
+		}
+	}
+	if x := ParseInt("10", 37); !math.IsNaN(x) {
+		t.Error("Expected radix 37 to give NaN")
+	}
+}
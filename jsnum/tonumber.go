@@ -0,0 +1,200 @@
+package jsnum
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// STRING TO NUMBER
+//
+// StringToNumber and StringToBigInt from ecma-262 7.1.4.1 and 7.1.14, and
+// the global parseInt. The tokenizer uses the same routines for numeric
+// literals once it has checked their syntax and removed separators.
+
+// IsWhiteSpace reports whether r is WhiteSpace or a LineTerminator, the
+// characters StringToNumber trims
+func IsWhiteSpace(r rune) bool {
+	switch r {
+	case '\t', '\n', '\v', '\f', '\r', 0x2028, 0x2029, 0xFEFF:
+		return true
+	}
+	return unicode.Is(unicode.Zs, r)
+}
+
+func trim(s string) string {
+	return strings.TrimFunc(s, IsWhiteSpace)
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func digitValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 36
+}
+
+// radixPrefix returns the radix of a 0x, 0o or 0b prefix, or 0 when s
+// doesn't start with one
+func radixPrefix(s string) int {
+	if len(s) < 2 || s[0] != '0' {
+		return 0
+	}
+	switch s[1] {
+	case 'x', 'X':
+		return 16
+	case 'o', 'O':
+		return 8
+	case 'b', 'B':
+		return 2
+	}
+	return 0
+}
+
+// parseRadix returns the value of digits in radix rounded to the nearest
+// double, or false when digits is empty or has a digit outside of radix
+func parseRadix(digits string, radix int) (float64, bool) {
+	if len(digits) == 0 {
+		return 0, false
+	}
+	for i := 0; i < len(digits); i++ {
+		if digitValue(digits[i]) >= radix {
+			return 0, false
+		}
+	}
+	if n, err := strconv.ParseUint(digits, radix, 53); err == nil {
+		return float64(n), true
+	}
+	n, _ := new(big.Int).SetString(digits, radix)
+	value, _ := new(big.Float).SetInt(n).Float64()
+	return value, true
+}
+
+// isDecimalLiteral checks s against StrUnsignedDecimalLiteral without
+// Infinity
+func isDecimalLiteral(s string) bool {
+	mantissa, exponent := s, ""
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa, exponent = s[:i], s[i+1:]
+		if len(exponent) > 0 && (exponent[0] == '+' || exponent[0] == '-') {
+			exponent = exponent[1:]
+		}
+		if !isDigits(exponent) {
+			return false
+		}
+	}
+	integer, fraction, hasDot := strings.Cut(mantissa, ".")
+	if integer == "" && fraction == "" {
+		return false
+	}
+	return (integer == "" || isDigits(integer)) && (!hasDot || fraction == "" || isDigits(fraction))
+}
+
+// StringToNumber is ToNumber applied to a string, NaN when s isn't a
+// StringNumericLiteral
+func StringToNumber(s string) float64 {
+	s = trim(s)
+	if s == "" {
+		return 0
+	}
+	if radix := radixPrefix(s); radix != 0 {
+		value, ok := parseRadix(s[2:], radix)
+		if !ok {
+			return math.NaN()
+		}
+		return value
+	}
+
+	unsigned := s
+	if s[0] == '+' || s[0] == '-' {
+		unsigned = s[1:]
+	}
+	if unsigned == "Infinity" {
+		if s[0] == '-' {
+			return math.Inf(-1)
+		}
+		return math.Inf(1)
+	}
+	if !isDecimalLiteral(unsigned) {
+		return math.NaN()
+	}
+	// Out of range values come back as ±Inf or ±0 along with an error
+	value, _ := strconv.ParseFloat(s, 64)
+	return value
+}
+
+// StringToBigInt returns the BigInt value of s, or false when s isn't a
+// StringIntegerLiteral, where JS gets undefined
+func StringToBigInt(s string) (*big.Int, bool) {
+	s = trim(s)
+	if s == "" {
+		return new(big.Int), true
+	}
+	if radix := radixPrefix(s); radix != 0 {
+		digits := s[2:]
+		if digits == "" || strings.ContainsAny(digits, "+-_") {
+			return nil, false
+		}
+		return new(big.Int).SetString(digits, radix)
+	}
+	unsigned := s
+	if s[0] == '+' || s[0] == '-' {
+		unsigned = s[1:]
+	}
+	if !isDigits(unsigned) {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+// ParseInt is the global parseInt, radix is ToInt32 of the radix argument
+// with 0 for undefined
+func ParseInt(s string, radix int) float64 {
+	s = strings.TrimLeftFunc(s, IsWhiteSpace)
+	sign := 1.0
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		if s[0] == '-' {
+			sign = -1
+		}
+		s = s[1:]
+	}
+
+	stripPrefix := true
+	if radix != 0 {
+		if radix < 2 || radix > 36 {
+			return math.NaN()
+		}
+		stripPrefix = radix == 16
+	} else {
+		radix = 10
+	}
+	if stripPrefix && len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		s = s[2:]
+		radix = 16
+	}
+
+	end := 0
+	for end < len(s) && digitValue(s[end]) < radix {
+		end++
+	}
+	value, ok := parseRadix(s[:end], radix)
+	if !ok {
+		return math.NaN()
+	}
+	return sign * value
+}
@@ -0,0 +1,308 @@
+package jsnum
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NUMBER TO STRING
+//
+// Number::toString and the formatting methods of Number.prototype, see
+// ecma-262 6.1.6.1.20 and 21.1.3. strconv gets close but formats exponents
+// as 1e+21 and keeps the sign of -0.
+
+var (
+	ErrFractionDigits = errors.New("toFixed() digits argument must be between 0 and 100")
+	ErrExponentDigits = errors.New("toExponential() argument must be between 0 and 100")
+	ErrPrecision      = errors.New("toPrecision() argument must be between 1 and 100")
+	ErrRadix          = errors.New("toString() radix must be between 2 and 36")
+)
+
+const digitChars = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// shortest returns the shortest digits that round trip to x along with n,
+// the position of the decimal point, so that x = 0.digits * 10^n. x must be
+// finite and positive.
+func shortest(x float64) (string, int) {
+	return splitExponent(strconv.FormatFloat(x, 'e', -1, 64))
+}
+
+// exact returns every decimal digit of x, the exact value of a double has at
+// most 767 significant digits
+func exact(x float64) (string, int) {
+	digits, n := splitExponent(strconv.FormatFloat(x, 'e', 767, 64))
+	return strings.TrimRight(digits, "0"), n
+}
+
+// splitExponent splits the 'e' format of strconv into its digits and the
+// position of the decimal point
+func splitExponent(s string) (string, int) {
+	mantissa, exponent, _ := strings.Cut(s, "e")
+	e, _ := strconv.Atoi(exponent)
+	return strings.Replace(mantissa, ".", "", 1), e + 1
+}
+
+// round rounds digits to count digits, ties going up as toFixed,
+// toExponential and toPrecision pick the larger n. The position of the
+// decimal point moves by one when rounding carries into a new digit, which
+// makes the result one digit short for toFixed.
+func round(digits string, n int, count int) (string, int) {
+	if count < 0 {
+		return "", n
+	}
+	if len(digits) <= count {
+		return digits + strings.Repeat("0", count-len(digits)), n
+	}
+	rounded := []byte(digits[:count])
+	if digits[count] < '5' {
+		return string(rounded), n
+	}
+	for i := count - 1; i >= 0; i-- {
+		if rounded[i] < '9' {
+			rounded[i]++
+			return string(rounded), n
+		}
+		rounded[i] = '0'
+	}
+	// Every digit was a 9
+	return "1" + string(rounded[:max(count-1, 0)]), n + 1
+}
+
+// ToString is Number::toString(x, 10)
+func ToString(x float64) string {
+	switch {
+	case math.IsNaN(x):
+		return "NaN"
+	case x == 0:
+		return "0"
+	case x < 0:
+		return "-" + ToString(-x)
+	case math.IsInf(x, 1):
+		return "Infinity"
+	}
+
+	digits, n := shortest(x)
+	k := len(digits)
+	switch {
+	case k <= n && n <= 21:
+		return digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return "0." + strings.Repeat("0", -n) + digits
+	}
+	return exponential(digits, n)
+}
+
+// exponential formats digits as d.ddde±x, with 10^(n-1) as the exponent
+func exponential(digits string, n int) string {
+	var b strings.Builder
+	b.WriteByte(digits[0])
+	if len(digits) > 1 {
+		b.WriteByte('.')
+		b.WriteString(digits[1:])
+	}
+	b.WriteByte('e')
+	if n-1 >= 0 {
+		b.WriteByte('+')
+	}
+	b.WriteString(strconv.Itoa(n - 1))
+	return b.String()
+}
+
+// ToStringRadix is Number::toString(x, radix), radixes other than 10 use
+// the same algorithm V8 does, fractions get digits up to the precision of x
+func ToStringRadix(x float64, radix int) (string, error) {
+	if radix < 2 || radix > 36 {
+		return "", ErrRadix
+	}
+	if radix == 10 || math.IsNaN(x) || math.IsInf(x, 0) || x == 0 {
+		return ToString(x), nil
+	}
+
+	negative := x < 0
+	x = math.Abs(x)
+	integer := math.Floor(x)
+	fraction := x - integer
+
+	// Only compute fraction digits up to the precision of x
+	delta := max(0.5*(math.Nextafter(x, math.Inf(1))-x), math.SmallestNonzeroFloat64)
+	fractionDigits := []byte{}
+	if fraction >= delta {
+		for {
+			fraction *= float64(radix)
+			delta *= float64(radix)
+			digit := int(fraction)
+			fractionDigits = append(fractionDigits, digitChars[digit])
+			fraction -= float64(digit)
+			// Round to even
+			if fraction > 0.5 || (fraction == 0.5 && digit&1 == 1) {
+				if fraction+delta > 1 {
+					fractionDigits, integer = carry(fractionDigits, integer, radix)
+					break
+				}
+			}
+			if fraction < delta {
+				break
+			}
+		}
+	}
+
+	// Digits below the precision of integer are zeros
+	integerDigits := []byte{}
+	for {
+		_, exp := math.Frexp(integer / float64(radix))
+		if exp <= 53 {
+			break
+		}
+		integer /= float64(radix)
+		integerDigits = append(integerDigits, '0')
+	}
+	for {
+		remainder := math.Mod(integer, float64(radix))
+		integerDigits = append(integerDigits, digitChars[int(remainder)])
+		integer = (integer - remainder) / float64(radix)
+		if integer <= 0 {
+			break
+		}
+	}
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i := len(integerDigits) - 1; i >= 0; i-- {
+		b.WriteByte(integerDigits[i])
+	}
+	if len(fractionDigits) > 0 {
+		b.WriteByte('.')
+		b.Write(fractionDigits)
+	}
+	return b.String(), nil
+}
+
+// carry rounds up the fraction digits written so far, carrying over into
+// the integer part when every digit overflows
+func carry(digits []byte, integer float64, radix int) ([]byte, float64) {
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := strings.IndexByte(digitChars, digits[i])
+		if digit+1 < radix {
+			digits[i] = digitChars[digit+1]
+			return digits[:i+1], integer
+		}
+	}
+	return digits[:0], integer + 1
+}
+
+// ToFixed is Number.prototype.toFixed, fractionDigits is
+// ToIntegerOrInfinity of the argument
+func ToFixed(x float64, fractionDigits int) (string, error) {
+	if fractionDigits < 0 || fractionDigits > 100 {
+		return "", ErrFractionDigits
+	}
+	if math.IsNaN(x) {
+		return "NaN", nil
+	}
+	if math.Abs(x) >= 1e21 {
+		return ToString(x), nil
+	}
+
+	sign := ""
+	if x < 0 {
+		sign = "-"
+		x = -x
+	}
+	if x == 0 {
+		return fixed("0", 1, fractionDigits), nil
+	}
+
+	digits, n := exact(x)
+	digits, n = round(digits, n, n+fractionDigits)
+	if digits == "" {
+		return sign + fixed("0", 1, fractionDigits), nil
+	}
+	return sign + fixed(digits, n, fractionDigits), nil
+}
+
+// fixed formats digits with the decimal point at n and f fraction digits,
+// digits has no more than n+f digits
+func fixed(digits string, n int, f int) string {
+	if n <= 0 {
+		digits = strings.Repeat("0", 1-n) + digits
+		n = 1
+	}
+	digits += strings.Repeat("0", max(0, n+f-len(digits)))
+	if f == 0 {
+		return digits
+	}
+	return digits[:n] + "." + digits[n:]
+}
+
+// ToExponential is Number.prototype.toExponential, fractionDigits is
+// ToIntegerOrInfinity of the argument. ToExponentialShortest handles an
+// undefined argument.
+func ToExponential(x float64, fractionDigits int) (string, error) {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return ToString(x), nil
+	}
+	if fractionDigits < 0 || fractionDigits > 100 {
+		return "", ErrExponentDigits
+	}
+
+	sign := ""
+	if x < 0 {
+		sign = "-"
+		x = -x
+	}
+	digits, n := strings.Repeat("0", fractionDigits+1), 1
+	if x != 0 {
+		digits, n = exact(x)
+		digits, n = round(digits, n, fractionDigits+1)
+	}
+	return sign + exponential(digits, n), nil
+}
+
+// ToExponentialShortest is Number.prototype.toExponential without an
+// argument, it uses as many digits as needed to represent x
+func ToExponentialShortest(x float64) string {
+	switch {
+	case x == 0:
+		return "0e+0"
+	case math.IsNaN(x) || math.IsInf(x, 0):
+		return ToString(x)
+	case x < 0:
+		return "-" + ToExponentialShortest(-x)
+	}
+	return exponential(shortest(x))
+}
+
+// ToPrecision is Number.prototype.toPrecision for a precision that isn't
+// undefined, which is ToString
+func ToPrecision(x float64, precision int) (string, error) {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return ToString(x), nil
+	}
+	if precision < 1 || precision > 100 {
+		return "", ErrPrecision
+	}
+
+	sign := ""
+	if x < 0 {
+		sign = "-"
+		x = -x
+	}
+
+	digits, n := strings.Repeat("0", precision), 1
+	if x != 0 {
+		digits, n = exact(x)
+		digits, n = round(digits, n, precision)
+	}
+
+	e := n - 1
+	if e < -6 || e >= precision {
+		return sign + exponential(digits, n), nil
+	}
+	return sign + fixed(digits, n, precision-n), nil
+}
@@ -0,0 +1,444 @@
+package jsregexp
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type runeRange struct {
+	lo, hi rune
+}
+
+// charClass is a set of characters and, for v-mode classes, of strings.
+// negate inverts the match without computing the complement.
+type charClass struct {
+	ranges  []runeRange // sorted and merged after normalize
+	strings [][]rune    // longest first after normalize
+	negate  bool
+}
+
+func (c *charClass) addRange(lo, hi rune) {
+	c.ranges = append(c.ranges, runeRange{lo, hi})
+}
+
+func (c *charClass) addAtom(ch rune, class *charClass) {
+	if class == nil {
+		c.addRange(ch, ch)
+		return
+	}
+	if class.negate {
+		class = class.complement()
+	}
+	c.ranges = append(c.ranges, class.ranges...)
+}
+
+func (c *charClass) addString(s []rune) {
+	if len(s) == 1 {
+		c.addRange(s[0], s[0])
+		return
+	}
+	c.strings = append(c.strings, s)
+}
+
+func (c *charClass) addTable(table *unicode.RangeTable) {
+	for _, r := range table.R16 {
+		c.addStride(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	for _, r := range table.R32 {
+		c.addStride(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+}
+
+func (c *charClass) addStride(lo, hi, stride rune) {
+	if stride == 1 {
+		c.addRange(lo, hi)
+		return
+	}
+	for r := lo; r <= hi; r += stride {
+		c.addRange(r, r)
+	}
+}
+
+func (c *charClass) normalize() {
+	sort.Slice(c.ranges, func(i, j int) bool {
+		return c.ranges[i].lo < c.ranges[j].lo
+	})
+	merged := c.ranges[:0]
+	for _, r := range c.ranges {
+		if len(merged) > 0 && r.lo <= merged[len(merged)-1].hi+1 {
+			if r.hi > merged[len(merged)-1].hi {
+				merged[len(merged)-1].hi = r.hi
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	c.ranges = merged
+
+	seen := map[string]bool{}
+	strs := c.strings[:0]
+	for _, s := range c.strings {
+		if !seen[string(s)] {
+			seen[string(s)] = true
+			strs = append(strs, s)
+		}
+	}
+	sort.SliceStable(strs, func(i, j int) bool {
+		return len(strs[i]) > len(strs[j])
+	})
+	c.strings = strs
+}
+
+func (c *charClass) contains(ch rune) bool {
+	i := sort.Search(len(c.ranges), func(i int) bool {
+		return c.ranges[i].hi >= ch
+	})
+	return i < len(c.ranges) && c.ranges[i].lo <= ch
+}
+
+func (c *charClass) stringSet() map[string]bool {
+	set := make(map[string]bool, len(c.strings))
+	for _, s := range c.strings {
+		set[string(s)] = true
+	}
+	return set
+}
+
+// complement returns the characters not in c, strings are dropped
+func (c *charClass) complement() *charClass {
+	result := &charClass{}
+	next := rune(0)
+	for _, r := range c.ranges {
+		if r.lo > next {
+			result.addRange(next, r.lo-1)
+		}
+		next = r.hi + 1
+	}
+	if next <= unicode.MaxRune {
+		result.addRange(next, unicode.MaxRune)
+	}
+	return result
+}
+
+func (c *charClass) union(other *charClass) *charClass {
+	result := &charClass{}
+	result.ranges = append(append(result.ranges, c.ranges...), other.ranges...)
+	result.strings = append(append(result.strings, c.strings...), other.strings...)
+	result.normalize()
+	return result
+}
+
+func (c *charClass) intersect(other *charClass) *charClass {
+	result := &charClass{}
+	i, j := 0, 0
+	for i < len(c.ranges) && j < len(other.ranges) {
+		a, b := c.ranges[i], other.ranges[j]
+		lo, hi := max(a.lo, b.lo), min(a.hi, b.hi)
+		if lo <= hi {
+			result.addRange(lo, hi)
+		}
+		if a.hi < b.hi {
+			i++
+		} else {
+			j++
+		}
+	}
+	strs := other.stringSet()
+	for _, s := range c.strings {
+		if strs[string(s)] {
+			result.strings = append(result.strings, s)
+		}
+	}
+	result.normalize()
+	return result
+}
+
+func (c *charClass) subtract(other *charClass) *charClass {
+	result := c.intersect(other.complement())
+	strs := other.stringSet()
+	for _, s := range c.strings {
+		if !strs[string(s)] {
+			result.strings = append(result.strings, s)
+		}
+	}
+	result.normalize()
+	return result
+}
+
+var (
+	digitClass = &charClass{ranges: []runeRange{{'0', '9'}}}
+	wordClass  = &charClass{ranges: []runeRange{{'0', '9'}, {'A', 'Z'}, {'_', '_'}, {'a', 'z'}}}
+
+	// With the u and i flags ſ and K fold into [a-z], so they're word
+	// characters, see WordCharacters
+	unicodeIgnoreCaseWordClass = wordClass.union(&charClass{ranges: []runeRange{{0x017F, 0x017F}, {0x212A, 0x212A}}})
+
+	spaceClass = func() *charClass {
+		c := &charClass{}
+		for _, ch := range "\t\n\v\f\r\u00a0\u2028\u2029\ufeff" {
+			c.addRange(ch, ch)
+		}
+		c.addTable(unicode.Zs)
+		c.normalize()
+		return c
+	}()
+)
+
+func escapeClass(escape rune, unicodeIgnoreCase bool) *charClass {
+	var class *charClass
+	switch unicode.ToLower(escape) {
+	case 'd':
+		class = digitClass
+	case 's':
+		class = spaceClass
+	case 'w':
+		class = wordClass
+		if unicodeIgnoreCase {
+			class = unicodeIgnoreCaseWordClass
+		}
+	}
+	if unicode.IsUpper(escape) {
+		return class.complement()
+	}
+	return class
+}
+
+func isLineTerminator(ch rune) bool {
+	return ch == '\n' || ch == '\r' || ch == 0x2028 || ch == 0x2029
+}
+
+func isWordChar(ch rune, unicodeIgnoreCase bool) bool {
+	if ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_' {
+		return true
+	}
+	return unicodeIgnoreCase && (ch == 0x017F || ch == 0x212A)
+}
+
+// canonicalize maps ch to the character it is compared as when the i flag is
+// set, see ecma-262 22.2.2.7.3 Canonicalize. In unicode mode characters with
+// the same simple case folding are equal, otherwise characters are compared
+// by their uppercase, unless that would turn a non-ASCII character into ASCII.
+func canonicalize(ch rune, unicodeMode bool) rune {
+	if unicodeMode {
+		smallest := ch
+		for c := unicode.SimpleFold(ch); c != ch; c = unicode.SimpleFold(c) {
+			smallest = min(smallest, c)
+		}
+		return smallest
+	}
+
+	if ch < 128 {
+		if ch >= 'a' && ch <= 'z' {
+			return ch - 'a' + 'A'
+		}
+		return ch
+	}
+	if ch >= 0x1F80 && ch <= 0x1FAF || ch == 0x1FB3 || ch == 0x1FC3 || ch == 0x1FF3 {
+		// The full uppercase of these is two characters, like "ᾳ" to "ΑΙ"
+		return ch
+	}
+	upper := unicode.ToUpper(ch)
+	if upper < 128 || upper > 0xFFFF {
+		return ch
+	}
+	return upper
+}
+
+// containsFolded reports whether c has a character that canonicalizes to the
+// same character as ch
+func (c *charClass) containsFolded(ch rune, unicodeMode bool) bool {
+	if c.contains(ch) {
+		return true
+	}
+	canonical := canonicalize(ch, unicodeMode)
+	for other := unicode.SimpleFold(ch); other != ch; other = unicode.SimpleFold(other) {
+		if c.contains(other) && canonicalize(other, unicodeMode) == canonical {
+			return true
+		}
+	}
+	return false
+}
+
+// UNICODE PROPERTIES
+
+var generalCategoryAliases = map[string]string{
+	"Other": "C", "Control": "Cc", "cntrl": "Cc", "Format": "Cf", "Unassigned": "Cn",
+	"Private_Use": "Co", "Surrogate": "Cs", "Letter": "L", "Cased_Letter": "LC",
+	"Lowercase_Letter": "Ll", "Modifier_Letter": "Lm", "Other_Letter": "Lo",
+	"Titlecase_Letter": "Lt", "Uppercase_Letter": "Lu", "Mark": "M", "Combining_Mark": "M",
+	"Spacing_Mark": "Mc", "Enclosing_Mark": "Me", "Nonspacing_Mark": "Mn", "Number": "N",
+	"Decimal_Number": "Nd", "digit": "Nd", "Letter_Number": "Nl", "Other_Number": "No",
+	"Punctuation": "P", "punct": "P", "Connector_Punctuation": "Pc", "Dash_Punctuation": "Pd",
+	"Close_Punctuation": "Pe", "Final_Punctuation": "Pf", "Initial_Punctuation": "Pi",
+	"Other_Punctuation": "Po", "Open_Punctuation": "Ps", "Symbol": "S", "Currency_Symbol": "Sc",
+	"Modifier_Symbol": "Sk", "Math_Symbol": "Sm", "Other_Symbol": "So", "Separator": "Z",
+	"Line_Separator": "Zl", "Paragraph_Separator": "Zp", "Space_Separator": "Zs",
+}
+
+var scriptAliases = map[string]string{
+	"Arab": "Arabic", "Armn": "Armenian", "Beng": "Bengali", "Cyrl": "Cyrillic",
+	"Deva": "Devanagari", "Ethi": "Ethiopic", "Geor": "Georgian", "Grek": "Greek",
+	"Gujr": "Gujarati", "Guru": "Gurmukhi", "Hang": "Hangul", "Hani": "Han",
+	"Hebr": "Hebrew", "Hira": "Hiragana", "Kana": "Katakana", "Khmr": "Khmer",
+	"Knda": "Kannada", "Laoo": "Lao", "Latn": "Latin", "Mlym": "Malayalam",
+	"Mong": "Mongolian", "Mymr": "Myanmar", "Orya": "Oriya", "Sinh": "Sinhala",
+	"Syrc": "Syriac", "Taml": "Tamil", "Telu": "Telugu", "Thaa": "Thaana",
+	"Thai": "Thai", "Tibt": "Tibetan", "Zinh": "Inherited", "Qaai": "Inherited",
+	"Zyyy": "Common",
+}
+
+var binaryPropertyAliases = map[string]string{
+	"AHex": "ASCII_Hex_Digit", "Bidi_C": "Bidi_Control", "Dep": "Deprecated",
+	"Dia": "Diacritic", "Ext": "Extender", "Hex": "Hex_Digit", "IDSB": "IDS_Binary_Operator",
+	"IDST": "IDS_Trinary_Operator", "Ideo": "Ideographic", "Join_C": "Join_Control",
+	"LOE": "Logical_Order_Exception", "NChar": "Noncharacter_Code_Point",
+	"Pat_Syn": "Pattern_Syntax", "Pat_WS": "Pattern_White_Space", "QMark": "Quotation_Mark",
+	"RI": "Regional_Indicator", "STerm": "Sentence_Terminal", "SD": "Soft_Dotted",
+	"Term": "Terminal_Punctuation", "UIdeo": "Unified_Ideograph", "VS": "Variation_Selector",
+	"space": "White_Space", "Alpha": "Alphabetic", "Lower": "Lowercase", "Upper": "Uppercase",
+	"IDS": "ID_Start", "IDC": "ID_Continue",
+}
+
+// propertyClass returns the characters matched by \p{expression}. General
+// categories, scripts and the binary properties Go has tables for are
+// supported, Script_Extensions is approximated by Script. withStrings allows
+// the properties of strings, for \p in v mode.
+func propertyClass(expression string, withStrings bool) (*charClass, error) {
+	name, value, hasValue := strings.Cut(expression, "=")
+	class := &charClass{}
+
+	if hasValue {
+		switch name {
+		case "General_Category", "gc":
+			if !class.addGeneralCategory(value) {
+				return nil, syntaxError("Invalid property name")
+			}
+		case "Script", "sc", "Script_Extensions", "scx":
+			if alias, found := scriptAliases[value]; found {
+				value = alias
+			}
+			table, found := unicode.Scripts[value]
+			if !found {
+				return nil, syntaxError("Invalid property name")
+			}
+			class.addTable(table)
+		default:
+			return nil, syntaxError("Invalid property name")
+		}
+		class.normalize()
+		return class, nil
+	}
+
+	if class.addGeneralCategory(name) || class.addBinaryProperty(name) || withStrings && class.addStringProperty(name) {
+		class.normalize()
+		return class, nil
+	}
+	return nil, syntaxError("Invalid property name")
+}
+
+// addStringProperty adds the emoji of a property of strings, RGI_Emoji is
+// the union of the others
+func (c *charClass) addStringProperty(name string) bool {
+	if name == "RGI_Emoji" {
+		for _, sequences := range emojiSequences {
+			for _, s := range sequences {
+				c.addString([]rune(s))
+			}
+		}
+		return true
+	}
+	sequences, found := emojiSequences[name]
+	for _, s := range sequences {
+		c.addString([]rune(s))
+	}
+	return found
+}
+
+func (c *charClass) addGeneralCategory(name string) bool {
+	if alias, found := generalCategoryAliases[name]; found {
+		name = alias
+	}
+	switch name {
+	case "LC":
+		c.addTable(unicode.Lu)
+		c.addTable(unicode.Ll)
+		c.addTable(unicode.Lt)
+	case "Cn":
+		c.ranges = append(c.ranges, assignedClass().complement().ranges...)
+	case "C":
+		c.addTable(unicode.C)
+		c.ranges = append(c.ranges, assignedClass().complement().ranges...)
+	default:
+		table, found := unicode.Categories[name]
+		if !found {
+			return false
+		}
+		c.addTable(table)
+	}
+	return true
+}
+
+func (c *charClass) addBinaryProperty(name string) bool {
+	if alias, found := binaryPropertyAliases[name]; found {
+		name = alias
+	}
+	switch name {
+	case "Any":
+		c.addRange(0, unicode.MaxRune)
+	case "ASCII":
+		c.addRange(0, 0x7F)
+	case "Assigned":
+		c.ranges = append(c.ranges, assignedClass().ranges...)
+	case "Alphabetic":
+		for _, table := range []*unicode.RangeTable{unicode.Lu, unicode.Ll, unicode.Lt, unicode.Lm, unicode.Lo, unicode.Nl, unicode.Other_Alphabetic} {
+			c.addTable(table)
+		}
+	case "Lowercase":
+		c.addTable(unicode.Ll)
+		c.addTable(unicode.Other_Lowercase)
+	case "Uppercase":
+		c.addTable(unicode.Lu)
+		c.addTable(unicode.Other_Uppercase)
+	case "Math":
+		c.addTable(unicode.Sm)
+		c.addTable(unicode.Other_Math)
+	case "ID_Start", "ID_Continue":
+		tables := []*unicode.RangeTable{unicode.L, unicode.Nl, unicode.Other_ID_Start}
+		if name == "ID_Continue" {
+			tables = append(tables, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
+		}
+		ids := &charClass{}
+		for _, table := range tables {
+			ids.addTable(table)
+		}
+		excluded := &charClass{}
+		excluded.addTable(unicode.Pattern_Syntax)
+		excluded.addTable(unicode.Pattern_White_Space)
+		ids.normalize()
+		excluded.normalize()
+		c.ranges = append(c.ranges, ids.subtract(excluded).ranges...)
+	default:
+		if strings.HasPrefix(name, "Other_") {
+			// Contributory properties aren't exposed by JS
+			return false
+		}
+		table, found := unicode.Properties[name]
+		if !found {
+			return false
+		}
+		c.addTable(table)
+	}
+	return true
+}
+
+func assignedClass() *charClass {
+	class := &charClass{}
+	for name, table := range unicode.Categories {
+		if len(name) == 2 {
+			class.addTable(table)
+		}
+	}
+	class.normalize()
+	return class
+}
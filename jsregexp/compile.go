@@ -0,0 +1,548 @@
+package jsregexp
+
+// MATCHING
+//
+// Patterns compile to matchers in continuation passing style, following the
+// Matcher and MatcherContinuation abstractions of ecma-262 22.2.2. A matcher
+// tries its part of the pattern at pos and calls k with the position after
+// it. Returning false backtracks into the previous alternative.
+
+type continuation func(pos int) bool
+
+type matcher func(m *machine, pos int, k continuation) bool
+
+// stepper matches a single character, it returns the next position or -1.
+// Repeats of steppers are matched with a loop instead of recursion.
+type stepper func(m *machine, pos int) int
+
+type machine struct {
+	input []uint16
+	caps  []int // start and end of every group, -1 when unmatched
+
+	unicode bool
+
+	steps     int
+	stepLimit int
+
+	// depth counts the continuations on the Go stack, which grows with the
+	// length of the match. Once it overflows the match is abandoned.
+	depth    int
+	overflow bool
+}
+
+// step counts the work done by a match, it fails once the step limit is
+// reached so that catastrophic backtracking ends
+func (m *machine) step() bool {
+	m.steps++
+	return m.steps <= m.stepLimit && !m.overflow
+}
+
+// enter is called before a matcher continues into the rest of the pattern,
+// each call has to be paired with exit
+func (m *machine) enter() bool {
+	if m.depth >= MAX_MATCH_DEPTH {
+		m.overflow = true
+		return false
+	}
+	m.depth++
+	return true
+}
+
+func (m *machine) exit() {
+	m.depth--
+}
+
+// next reads the character starting at pos, in unicode mode a surrogate pair
+// is one character. The width is 0 at the end of the input.
+func (m *machine) next(pos int) (rune, int) {
+	if pos >= len(m.input) {
+		return 0, 0
+	}
+	c := rune(m.input[pos])
+	if m.unicode && isLeadSurrogate(c) && pos+1 < len(m.input) && isTrailSurrogate(rune(m.input[pos+1])) {
+		return combineSurrogates(c, rune(m.input[pos+1])), 2
+	}
+	return c, 1
+}
+
+// prev reads the character ending at pos
+func (m *machine) prev(pos int) (rune, int) {
+	if pos <= 0 {
+		return 0, 0
+	}
+	c := rune(m.input[pos-1])
+	if m.unicode && isTrailSurrogate(c) && pos >= 2 && isLeadSurrogate(rune(m.input[pos-2])) {
+		return combineSurrogates(rune(m.input[pos-2]), c), 2
+	}
+	return c, 1
+}
+
+func (m *machine) saveCaps(first, count int) []int {
+	return append([]int(nil), m.caps[first*2:(first+count)*2]...)
+}
+
+func (m *machine) restoreCaps(first int, saved []int) {
+	copy(m.caps[first*2:], saved)
+}
+
+type compiler struct {
+	f          flags
+	groupCount int
+}
+
+// compile turns n into a matcher. forward is false inside lookbehinds, where
+// the pattern is matched from right to left. The i, m and s flags can change
+// within the pattern, so matchers read them from c.f while compiling.
+func (c *compiler) compile(n *node, forward bool) (matcher, stepper) {
+	switch n.typ {
+	case NODE_EMPTY:
+		return func(m *machine, pos int, k continuation) bool {
+			return k(pos)
+		}, nil
+
+	case NODE_CHAR:
+		ch := n.ch
+		if c.f.ignoreCase {
+			unicodeMode := c.f.unicode || c.f.unicodeSets
+			canonical := canonicalize(ch, unicodeMode)
+			return c.character(func(m *machine, input rune) bool {
+				return input == ch || canonicalize(input, unicodeMode) == canonical
+			}, forward)
+		}
+		return c.character(func(m *machine, input rune) bool {
+			return input == ch
+		}, forward)
+
+	case NODE_ANY:
+		dotAll := c.f.dotAll
+		return c.character(func(m *machine, input rune) bool {
+			return dotAll || !isLineTerminator(input)
+		}, forward)
+
+	case NODE_CLASS:
+		return c.class(n.class, forward)
+
+	case NODE_LINE_START:
+		multiline := c.f.multiline
+		return func(m *machine, pos int, k continuation) bool {
+			if pos == 0 || multiline && isLineTerminator(rune(m.input[pos-1])) {
+				return k(pos)
+			}
+			return false
+		}, nil
+
+	case NODE_LINE_END:
+		multiline := c.f.multiline
+		return func(m *machine, pos int, k continuation) bool {
+			if pos == len(m.input) || multiline && isLineTerminator(rune(m.input[pos])) {
+				return k(pos)
+			}
+			return false
+		}, nil
+
+	case NODE_WORD_BOUNDARY, NODE_NOT_WORD_BOUNDARY:
+		want := n.typ == NODE_WORD_BOUNDARY
+		unicodeIgnoreCase := (c.f.unicode || c.f.unicodeSets) && c.f.ignoreCase
+		return func(m *machine, pos int, k continuation) bool {
+			a := pos > 0 && isWordChar(rune(m.input[pos-1]), unicodeIgnoreCase)
+			b := pos < len(m.input) && isWordChar(rune(m.input[pos]), unicodeIgnoreCase)
+			if (a != b) == want {
+				return k(pos)
+			}
+			return false
+		}, nil
+
+	case NODE_BACKREFERENCE:
+		if n.indices != nil {
+			return c.backreference(n.indices, forward), nil
+		}
+		return c.backreference([]int{n.index}, forward), nil
+
+	case NODE_GROUP:
+		return c.group(n, forward), nil
+
+	case NODE_LOOKAHEAD, NODE_NEGATIVE_LOOKAHEAD, NODE_LOOKBEHIND, NODE_NEGATIVE_LOOKBEHIND:
+		return c.lookaround(n), nil
+
+	case NODE_ALTERNATION:
+		alternatives := make([]matcher, len(n.children))
+		for i, child := range n.children {
+			alternatives[i], _ = c.compile(child, forward)
+		}
+		return func(m *machine, pos int, k continuation) bool {
+			if !m.enter() {
+				return false
+			}
+			defer m.exit()
+			for _, alternative := range alternatives {
+				if alternative(m, pos, k) {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case NODE_CONCAT:
+		terms := make([]matcher, len(n.children))
+		for i, child := range n.children {
+			terms[i], _ = c.compile(child, forward)
+		}
+		if !forward {
+			for i, j := 0, len(terms)-1; i < j; i, j = i+1, j-1 {
+				terms[i], terms[j] = terms[j], terms[i]
+			}
+		}
+		return sequence(terms), nil
+
+	case NODE_REPEAT:
+		return c.repeat(n, forward), nil
+
+	case NODE_MODIFIERS:
+		outer := c.f
+		c.f = c.f.modify(n.enable, n.disable)
+		inner, step := c.compile(n.children[0], forward)
+		c.f = outer
+		return inner, step
+	}
+	panic("unknown regexp node")
+}
+
+func sequence(terms []matcher) matcher {
+	switch len(terms) {
+	case 0:
+		return func(m *machine, pos int, k continuation) bool {
+			return k(pos)
+		}
+	case 1:
+		return terms[0]
+	}
+	first, rest := terms[0], sequence(terms[1:])
+	return func(m *machine, pos int, k continuation) bool {
+		return first(m, pos, func(next int) bool {
+			if !m.enter() {
+				return false
+			}
+			matched := rest(m, next, k)
+			m.exit()
+			return matched
+		})
+	}
+}
+
+// character builds the matcher of a single character, see CharacterSetMatcher
+func (c *compiler) character(match func(m *machine, input rune) bool, forward bool) (matcher, stepper) {
+	var step stepper
+	if forward {
+		step = func(m *machine, pos int) int {
+			ch, width := m.next(pos)
+			if width == 0 || !match(m, ch) {
+				return -1
+			}
+			return pos + width
+		}
+	} else {
+		step = func(m *machine, pos int) int {
+			ch, width := m.prev(pos)
+			if width == 0 || !match(m, ch) {
+				return -1
+			}
+			return pos - width
+		}
+	}
+	return func(m *machine, pos int, k continuation) bool {
+		if !m.step() {
+			return false
+		}
+		next := step(m, pos)
+		return next >= 0 && k(next)
+	}, step
+}
+
+func (c *compiler) class(class *charClass, forward bool) (matcher, stepper) {
+	unicodeMode := c.f.unicode || c.f.unicodeSets
+	contains := class.contains
+	if c.f.ignoreCase {
+		contains = func(ch rune) bool {
+			return class.containsFolded(ch, unicodeMode)
+		}
+	}
+	single, step := c.character(func(m *machine, input rune) bool {
+		return contains(input) != class.negate
+	}, forward)
+	if len(class.strings) == 0 {
+		return single, step
+	}
+
+	// Strings of a v-mode class are tried longest first, then single
+	// characters and then the empty string. Without the i flag only the
+	// strings that start with the next code unit can match.
+	strs := [][]uint16{}
+	byFirst := map[uint16][][]uint16{}
+	hasEmpty := false
+	for _, s := range class.strings {
+		if len(s) == 0 {
+			hasEmpty = true
+			continue
+		}
+		units := encodeRunes(s)
+		strs = append(strs, units)
+		first := units[0]
+		if !forward {
+			first = units[len(units)-1]
+		}
+		byFirst[first] = append(byFirst[first], units)
+	}
+	ignoreCase := c.f.ignoreCase
+	return func(m *machine, pos int, k continuation) bool {
+		candidates := strs
+		if !ignoreCase {
+			candidates = nil
+			if forward && pos < len(m.input) {
+				candidates = byFirst[m.input[pos]]
+			} else if !forward && pos > 0 {
+				candidates = byFirst[m.input[pos-1]]
+			}
+		}
+		for _, s := range candidates {
+			if next, ok := m.matchUnits(s, pos, forward, ignoreCase); ok && k(next) {
+				return true
+			}
+		}
+		return single(m, pos, k) || hasEmpty && k(pos)
+	}, nil
+}
+
+// matchUnits compares the input next to pos with s, character by character so
+// that the i flag applies
+func (m *machine) matchUnits(s []uint16, pos int, forward bool, ignoreCase bool) (int, bool) {
+	start, end := pos, pos+len(s)
+	if !forward {
+		start, end = pos-len(s), pos
+	}
+	if start < 0 || end > len(m.input) {
+		return 0, false
+	}
+
+	if !ignoreCase {
+		for i, u := range s {
+			if m.input[start+i] != u {
+				return 0, false
+			}
+		}
+	} else {
+		sub := &machine{input: s, unicode: m.unicode}
+		for i := 0; i < len(s); {
+			a, width := sub.next(i)
+			b, _ := m.next(start + i)
+			if a != b && canonicalize(a, m.unicode) != canonicalize(b, m.unicode) {
+				return 0, false
+			}
+			i += width
+		}
+	}
+	if forward {
+		return end, true
+	}
+	return start, true
+}
+
+// backreference matches what one of the groups captured, see
+// BackreferenceMatcher. Only one of the groups with a name can participate,
+// when none did the backreference matches the empty string.
+func (c *compiler) backreference(indices []int, forward bool) matcher {
+	ignoreCase := c.f.ignoreCase
+	return func(m *machine, pos int, k continuation) bool {
+		if !m.step() {
+			return false
+		}
+		for _, index := range indices {
+			start, end := m.caps[index*2], m.caps[index*2+1]
+			if start < 0 || end < 0 {
+				continue
+			}
+			next, ok := m.matchUnits(m.input[start:end], pos, forward, ignoreCase)
+			return ok && k(next)
+		}
+		return k(pos)
+	}
+}
+
+func (c *compiler) group(n *node, forward bool) matcher {
+	inner, _ := c.compile(n.children[0], forward)
+	index := n.index
+	return func(m *machine, pos int, k continuation) bool {
+		return inner(m, pos, func(next int) bool {
+			if !m.enter() {
+				return false
+			}
+			defer m.exit()
+			oldStart, oldEnd := m.caps[index*2], m.caps[index*2+1]
+			if forward {
+				m.caps[index*2], m.caps[index*2+1] = pos, next
+			} else {
+				m.caps[index*2], m.caps[index*2+1] = next, pos
+			}
+			if k(next) {
+				return true
+			}
+			m.caps[index*2], m.caps[index*2+1] = oldStart, oldEnd
+			return false
+		})
+	}
+}
+
+// lookaround matches its body without consuming input. Once the body matched
+// it isn't backtracked into, but the captures it made stay.
+func (c *compiler) lookaround(n *node) matcher {
+	behind := n.typ == NODE_LOOKBEHIND || n.typ == NODE_NEGATIVE_LOOKBEHIND
+	negative := n.typ == NODE_NEGATIVE_LOOKAHEAD || n.typ == NODE_NEGATIVE_LOOKBEHIND
+	inner, _ := c.compile(n.children[0], !behind)
+	groups := c.groupCount + 1
+
+	accept := func(int) bool { return true }
+	return func(m *machine, pos int, k continuation) bool {
+		if !m.step() || !m.enter() {
+			return false
+		}
+		defer m.exit()
+		saved := m.saveCaps(0, groups)
+		matched := inner(m, pos, accept)
+		if negative {
+			if matched {
+				m.restoreCaps(0, saved)
+				return false
+			}
+			return k(pos)
+		}
+		if !matched {
+			return false
+		}
+		if k(pos) {
+			return true
+		}
+		m.restoreCaps(0, saved)
+		return false
+	}
+}
+
+// repeat implements quantifiers, see RepeatMatcher. An iteration that matches
+// the empty string once the minimum is reached fails, which stops (a*)* from
+// looping forever. Captures inside the atom are reset on every iteration.
+func (c *compiler) repeat(n *node, forward bool) matcher {
+	inner, step := c.compile(n.children[0], forward)
+	if step != nil && n.groupCount == 0 {
+		return c.repeatSteps(step, n.min, n.max, n.greedy)
+	}
+
+	first, count := n.firstGroup, n.groupCount
+	greedy := n.greedy
+
+	var repeat func(m *machine, pos int, min, max int, k continuation) bool
+	repeat = func(m *machine, pos int, min, max int, k continuation) bool {
+		if max == 0 {
+			return k(pos)
+		}
+		if !m.step() {
+			return false
+		}
+
+		next := func(y int) bool {
+			if min == 0 && y == pos {
+				return false
+			}
+			nextMax := max
+			if max > 0 {
+				nextMax--
+			}
+			return repeat(m, y, max0(min-1), nextMax, k)
+		}
+		iterate := func() bool {
+			if !m.enter() {
+				return false
+			}
+			saved := m.saveCaps(first, count)
+			for i := first; i < first+count; i++ {
+				m.caps[i*2], m.caps[i*2+1] = -1, -1
+			}
+			matched := inner(m, pos, next)
+			m.exit()
+			if matched {
+				return true
+			}
+			m.restoreCaps(first, saved)
+			return false
+		}
+
+		if min > 0 {
+			return iterate()
+		}
+		if !greedy {
+			return k(pos) || iterate()
+		}
+		return iterate() || k(pos)
+	}
+
+	return func(m *machine, pos int, k continuation) bool {
+		return repeat(m, pos, n.min, n.max, k)
+	}
+}
+
+// repeatSteps repeats a single character matcher, the positions it can stop
+// at are collected first and then tried in order
+func (c *compiler) repeatSteps(step stepper, min, max int, greedy bool) matcher {
+	return func(m *machine, pos int, k continuation) bool {
+		positions := []int{pos}
+		for max < 0 || len(positions) <= max {
+			if !m.step() {
+				return false
+			}
+			if !greedy && len(positions) > min {
+				break
+			}
+			next := step(m, positions[len(positions)-1])
+			if next < 0 {
+				break
+			}
+			positions = append(positions, next)
+		}
+		if len(positions) <= min {
+			return false
+		}
+
+		if greedy {
+			for i := len(positions) - 1; i >= min; i-- {
+				if k(positions[i]) {
+					return true
+				}
+				if !m.step() {
+					return false
+				}
+			}
+			return false
+		}
+
+		// Lazy, extend one character at a time only when needed
+		current := positions[len(positions)-1]
+		count := len(positions) - 1
+		for {
+			if k(current) {
+				return true
+			}
+			if max >= 0 && count >= max || !m.step() {
+				return false
+			}
+			current = step(m, current)
+			if current < 0 {
+				return false
+			}
+			count++
+		}
+	}
+}
+
+func max0(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
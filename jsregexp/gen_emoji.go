@@ -0,0 +1,133 @@
+//go:build ignore
+
+// gen_emoji writes emoji_tables.go, the properties of strings of the v flag,
+// from the emoji-test.txt of the Unicode emoji data:
+//
+//	go run gen_emoji.go path/to/emoji-test.txt
+//
+// The fully-qualified emoji in the file are exactly RGI_Emoji, they're sorted
+// into its sub-properties by their structure, see UTS #51.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var properties = []string{
+	"Basic_Emoji",
+	"Emoji_Keycap_Sequence",
+	"RGI_Emoji_Flag_Sequence",
+	"RGI_Emoji_Modifier_Sequence",
+	"RGI_Emoji_Tag_Sequence",
+	"RGI_Emoji_ZWJ_Sequence",
+}
+
+func property(seq []rune) string {
+	switch {
+	case strings.ContainsRune(string(seq), 0x20E3):
+		return "Emoji_Keycap_Sequence"
+	case strings.ContainsRune(string(seq), 0xE007F):
+		return "RGI_Emoji_Tag_Sequence"
+	case strings.ContainsRune(string(seq), 0x200D):
+		return "RGI_Emoji_ZWJ_Sequence"
+	case len(seq) == 2 && seq[0] >= 0x1F1E6 && seq[0] <= 0x1F1FF && seq[1] >= 0x1F1E6 && seq[1] <= 0x1F1FF:
+		return "RGI_Emoji_Flag_Sequence"
+	case len(seq) == 2 && seq[1] >= 0x1F3FB && seq[1] <= 0x1F3FF:
+		return "RGI_Emoji_Modifier_Sequence"
+	case len(seq) == 1 || len(seq) == 2 && seq[1] == 0xFE0F:
+		return "Basic_Emoji"
+	}
+	log.Fatalf("Unknown kind of emoji %U", seq)
+	return ""
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("Usage: go run gen_emoji.go emoji-test.txt")
+	}
+	file, err := os.Open(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	version := ""
+	versionLine := regexp.MustCompile(`^# Version: (\S+)`)
+	sequences := map[string][]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := versionLine.FindStringSubmatch(line); match != nil {
+			version = match[1]
+		}
+		data, _, _ := strings.Cut(line, "#")
+		codePoints, status, found := strings.Cut(data, ";")
+		if !found {
+			continue
+		}
+		seq := []rune{}
+		for _, field := range strings.Fields(codePoints) {
+			cp, err := strconv.ParseUint(field, 16, 32)
+			if err != nil {
+				log.Fatal(err)
+			}
+			seq = append(seq, rune(cp))
+		}
+
+		// The skin tones and hair styles are components, they're
+		// Basic_Emoji without being fully-qualified emoji of their own
+		switch strings.TrimSpace(status) {
+		case "fully-qualified":
+		case "component":
+			if len(seq) != 1 {
+				continue
+			}
+		default:
+			continue
+		}
+		name := property(seq)
+		sequences[name] = append(sequences[name], string(seq))
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by gen_emoji.go from emoji-test.txt, Emoji %s. DO NOT EDIT.\n\n", version)
+	b.WriteString("package jsregexp\n\n")
+	b.WriteString("// emojiSequences holds the properties of strings by name\n")
+	b.WriteString("var emojiSequences = map[string][]string{\n")
+	for _, name := range properties {
+		fmt.Fprintf(&b, "\t%q: {\n", name)
+		for i, s := range sequences[name] {
+			if i%8 == 0 {
+				b.WriteString("\t\t")
+			}
+			b.WriteString(strconv.QuoteToASCII(s))
+			b.WriteString(",")
+			if i%8 == 7 || i == len(sequences[name])-1 {
+				b.WriteString("\n")
+			} else {
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\t},\n")
+	}
+	b.WriteString("}\n")
+
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("emoji_tables.go", source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,478 @@
+// Package jsregexp is a backtracking regular expression engine with the
+// semantics of ECMAScript RegExp. Go's regexp package is RE2, it can't do
+// backreferences or lookaround and matches UTF-8 instead of UTF-16 code units.
+//
+// Strings are slices of UTF-16 code units, like JS strings, indices are code
+// unit offsets.
+package jsregexp
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+// DEFAULT_STEP_LIMIT bounds the work of a single match, see RegExp.StepLimit
+const DEFAULT_STEP_LIMIT = 10_000_000
+
+// MAX_NESTING_DEPTH bounds how deeply groups and v-mode classes nest, parsing,
+// compiling and matching all recurse once per level
+const MAX_NESTING_DEPTH = 1000
+
+// MAX_MATCH_DEPTH bounds how far a match recurses. Matchers call the rest of
+// the pattern as a continuation, so every character matched by a sequence or
+// a repeated group adds Go stack frames until the match ends.
+const MAX_MATCH_DEPTH = 1_000_000
+
+// ErrStepLimit is returned when a match gives up because of the step limit
+var ErrStepLimit = errors.New("Maximum regular expression backtracking exceeded")
+
+// ErrStackLimit is returned when a match gives up because of MAX_MATCH_DEPTH
+var ErrStackLimit = errors.New("Maximum regular expression stack size exceeded")
+
+type flags struct {
+	hasIndices  bool // d
+	global      bool // g
+	ignoreCase  bool // i
+	multiline   bool // m
+	dotAll      bool // s
+	unicode     bool // u
+	unicodeSets bool // v
+	sticky      bool // y
+}
+
+func parseFlags(s string) (flags, error) {
+	f := flags{}
+	for _, c := range s {
+		var flag *bool
+		switch c {
+		case 'd':
+			flag = &f.hasIndices
+		case 'g':
+			flag = &f.global
+		case 'i':
+			flag = &f.ignoreCase
+		case 'm':
+			flag = &f.multiline
+		case 's':
+			flag = &f.dotAll
+		case 'u':
+			flag = &f.unicode
+		case 'v':
+			flag = &f.unicodeSets
+		case 'y':
+			flag = &f.sticky
+		}
+		if flag == nil || *flag {
+			return f, syntaxError("Invalid flags supplied to RegExp constructor '" + s + "'")
+		}
+		*flag = true
+	}
+	if f.unicode && f.unicodeSets {
+		return f, syntaxError("Invalid flags supplied to RegExp constructor '" + s + "'")
+	}
+	return f, nil
+}
+
+// set turns on the flag c of a modifiers group
+func (f *flags) set(c rune) {
+	switch c {
+	case 'i':
+		f.ignoreCase = true
+	case 'm':
+		f.multiline = true
+	case 's':
+		f.dotAll = true
+	}
+}
+
+// modify applies the flags of a modifiers group
+func (f flags) modify(enable, disable flags) flags {
+	f.ignoreCase = (f.ignoreCase || enable.ignoreCase) && !disable.ignoreCase
+	f.multiline = (f.multiline || enable.multiline) && !disable.multiline
+	f.dotAll = (f.dotAll || enable.dotAll) && !disable.dotAll
+	return f
+}
+
+// String returns the flags in the order of RegExp.prototype.flags
+func (f flags) String() string {
+	var sb strings.Builder
+	for _, flag := range []struct {
+		set  bool
+		name byte
+	}{
+		{f.hasIndices, 'd'}, {f.global, 'g'}, {f.ignoreCase, 'i'}, {f.multiline, 'm'},
+		{f.dotAll, 's'}, {f.unicode, 'u'}, {f.unicodeSets, 'v'}, {f.sticky, 'y'},
+	} {
+		if flag.set {
+			sb.WriteByte(flag.name)
+		}
+	}
+	return sb.String()
+}
+
+// RegExp is a compiled pattern together with the state of a JS RegExp object,
+// LastIndex is the lastIndex property.
+type RegExp struct {
+	LastIndex int
+
+	// StepLimit bounds the work of one Exec, DEFAULT_STEP_LIMIT when 0
+	StepLimit int
+
+	pattern    []uint16
+	flags      flags
+	program    matcher
+	groupNames []string
+
+	// When the pattern starts with a literal code unit, match attempts can
+	// skip ahead to it
+	prefix    uint16
+	hasPrefix bool
+}
+
+// New compiles pattern with flags, see RegExpInitialize
+func New(pattern string, flags string) (*RegExp, error) {
+	return NewUTF16(EncodeString(pattern), flags)
+}
+
+// NewUTF16 is New for patterns that can contain lone surrogates
+func NewUTF16(pattern []uint16, flagString string) (*RegExp, error) {
+	f, err := parseFlags(flagString)
+	if err != nil {
+		return nil, err
+	}
+
+	var src []rune
+	if f.unicode || f.unicodeSets {
+		src = decodeUnits(pattern)
+	} else {
+		src = make([]rune, len(pattern))
+		for i, u := range pattern {
+			src[i] = rune(u)
+		}
+	}
+
+	n, p, err := parsePattern(src, f)
+	if err != nil {
+		return nil, syntaxError("Invalid regular expression: /" + DecodeString(pattern) + "/" + flagString + ": " + err.Error())
+	}
+
+	c := &compiler{f: f, groupCount: p.captureIndex}
+	program, _ := c.compile(n, true)
+	re := &RegExp{pattern: pattern, flags: f, program: program, groupNames: p.groupNames}
+	re.prefix, re.hasPrefix = literalPrefix(n, f)
+	return re, nil
+}
+
+// MustNew is New for patterns known to be valid
+func MustNew(pattern string, flags string) *RegExp {
+	re, err := New(pattern, flags)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+func literalPrefix(n *node, f flags) (uint16, bool) {
+	for n.typ == NODE_CONCAT && len(n.children) > 0 {
+		n = n.children[0]
+	}
+	for n.typ == NODE_GROUP || n.typ == NODE_REPEAT && n.min > 0 {
+		n = n.children[0]
+		for n.typ == NODE_CONCAT && len(n.children) > 0 {
+			n = n.children[0]
+		}
+	}
+	if n.typ != NODE_CHAR || f.ignoreCase || f.sticky {
+		return 0, false
+	}
+	if n.ch > 0xFFFF {
+		return uint16(0xD800 + (n.ch-0x10000)>>10), true
+	}
+	return uint16(n.ch), true
+}
+
+// Source is the source property, the pattern escaped so that /source/ is a
+// valid literal, see EscapeRegExpPattern
+func (re *RegExp) Source() string {
+	if len(re.pattern) == 0 {
+		return "(?:)"
+	}
+
+	var sb strings.Builder
+	inClass := false
+	src := []rune(DecodeString(re.pattern))
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\\' && i+1 < len(src):
+			sb.WriteRune(c)
+			i++
+			c = src[i]
+			if isLineTerminator(c) {
+				sb.WriteString(escapeLineTerminator(c)[1:])
+				continue
+			}
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			sb.WriteString(`\/`)
+			continue
+		case isLineTerminator(c):
+			sb.WriteString(escapeLineTerminator(c))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func escapeLineTerminator(c rune) string {
+	switch c {
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case 0x2028:
+		return `\u2028`
+	}
+	return `\u2029`
+}
+
+func (re *RegExp) Flags() string {
+	return re.flags.String()
+}
+
+func (re *RegExp) HasIndices() bool  { return re.flags.hasIndices }
+func (re *RegExp) Global() bool      { return re.flags.global }
+func (re *RegExp) IgnoreCase() bool  { return re.flags.ignoreCase }
+func (re *RegExp) Multiline() bool   { return re.flags.multiline }
+func (re *RegExp) DotAll() bool      { return re.flags.dotAll }
+func (re *RegExp) Unicode() bool     { return re.flags.unicode }
+func (re *RegExp) UnicodeSets() bool { return re.flags.unicodeSets }
+func (re *RegExp) Sticky() bool      { return re.flags.sticky }
+
+// String is RegExp.prototype.toString
+func (re *RegExp) String() string {
+	return "/" + re.Source() + "/" + re.Flags()
+}
+
+// MarshalJSON encodes like JSON.stringify does, a RegExp has no own
+// enumerable properties
+func (re *RegExp) MarshalJSON() ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+// GroupNames lists the names of the capture groups by index, unnamed groups
+// and group 0 have an empty name
+func (re *RegExp) GroupNames() []string {
+	return re.groupNames
+}
+
+// NumGroups is the number of capture groups, without group 0
+func (re *RegExp) NumGroups() int {
+	return len(re.groupNames) - 1
+}
+
+// withSticky returns a sticky copy of re, the pattern isn't compiled again
+func (re *RegExp) withSticky() *RegExp {
+	clone := *re
+	clone.flags.sticky = true
+	clone.hasPrefix = false
+	return &clone
+}
+
+// Match is the result of a successful Exec
+type Match struct {
+	Input []uint16
+	Index int
+
+	captures   []int
+	groupNames []string
+}
+
+// Group returns what group n captured, ok is false when it didn't take part in
+// the match
+func (m *Match) Group(n int) (s []uint16, ok bool) {
+	start, end, ok := m.Span(n)
+	if !ok {
+		return nil, false
+	}
+	return m.Input[start:end], true
+}
+
+// Span returns where group n matched, these are the values of the indices
+// array created for the d flag
+func (m *Match) Span(n int) (start int, end int, ok bool) {
+	if n < 0 || n*2 >= len(m.captures) || m.captures[n*2] < 0 {
+		return 0, 0, false
+	}
+	return m.captures[n*2], m.captures[n*2+1], true
+}
+
+// NamedGroup returns what the group called name captured. Groups in
+// different alternatives can share a name, it's the one that participated.
+func (m *Match) NamedGroup(name string) ([]uint16, bool) {
+	for i, n := range m.groupNames {
+		if n == name && name != "" {
+			if group, ok := m.Group(i); ok {
+				return group, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// GroupNames lists the group names by index, like RegExp.GroupNames
+func (m *Match) GroupNames() []string {
+	return m.groupNames
+}
+
+func (m *Match) NumGroups() int {
+	return len(m.captures)/2 - 1
+}
+
+// End is the index right after the match
+func (m *Match) End() int {
+	return m.captures[1]
+}
+
+// Exec runs re on input, see RegExpBuiltinExec. Global and sticky regexps
+// start at LastIndex and update it, others always search the whole input.
+// It returns nil when nothing matches.
+func (re *RegExp) Exec(input []uint16) (*Match, error) {
+	lastIndex := re.LastIndex
+	if !re.flags.global && !re.flags.sticky {
+		lastIndex = 0
+	}
+	if lastIndex < 0 {
+		lastIndex = 0
+	}
+	if lastIndex > len(input) {
+		if re.flags.global || re.flags.sticky {
+			re.LastIndex = 0
+		}
+		return nil, nil
+	}
+
+	fullUnicode := re.flags.unicode || re.flags.unicodeSets
+	if fullUnicode && lastIndex > 0 && lastIndex < len(input) &&
+		isTrailSurrogate(rune(input[lastIndex])) && isLeadSurrogate(rune(input[lastIndex-1])) {
+		// lastIndex points into a surrogate pair, match from the pair
+		lastIndex--
+	}
+
+	stepLimit := re.StepLimit
+	if stepLimit <= 0 {
+		stepLimit = DEFAULT_STEP_LIMIT
+	}
+	m := &machine{
+		input:     input,
+		caps:      make([]int, len(re.groupNames)*2),
+		unicode:   fullUnicode,
+		stepLimit: stepLimit,
+	}
+
+	for start := lastIndex; start <= len(input); start = AdvanceStringIndex(input, start, fullUnicode) {
+		if re.hasPrefix {
+			for start < len(input) && input[start] != re.prefix {
+				start = AdvanceStringIndex(input, start, fullUnicode)
+			}
+			if start == len(input) {
+				break
+			}
+		}
+
+		for i := range m.caps {
+			m.caps[i] = -1
+		}
+		end := -1
+		matched := re.program(m, start, func(pos int) bool {
+			end = pos
+			return true
+		})
+		if m.overflow {
+			return nil, ErrStackLimit
+		}
+		if m.steps > m.stepLimit {
+			return nil, ErrStepLimit
+		}
+		if matched {
+			m.caps[0], m.caps[1] = start, end
+			if re.flags.global || re.flags.sticky {
+				re.LastIndex = end
+			}
+			return &Match{Input: input, Index: start, captures: m.caps, groupNames: re.groupNames}, nil
+		}
+		if re.flags.sticky || start == len(input) {
+			break
+		}
+	}
+
+	if re.flags.global || re.flags.sticky {
+		re.LastIndex = 0
+	}
+	return nil, nil
+}
+
+// Test is RegExp.prototype.test
+func (re *RegExp) Test(input []uint16) (bool, error) {
+	match, err := re.Exec(input)
+	return match != nil, err
+}
+
+// AdvanceStringIndex returns the index after the character at index, a whole
+// surrogate pair in unicode mode
+func AdvanceStringIndex(s []uint16, index int, unicode bool) int {
+	if !unicode || index+1 >= len(s) {
+		return index + 1
+	}
+	if isLeadSurrogate(rune(s[index])) && isTrailSurrogate(rune(s[index+1])) {
+		return index + 2
+	}
+	return index + 1
+}
+
+// EncodeString converts a Go string to UTF-16 code units
+func EncodeString(s string) []uint16 {
+	return utf16.Encode([]rune(s))
+}
+
+// DecodeString converts UTF-16 code units to a Go string, lone surrogates
+// become U+FFFD
+func DecodeString(s []uint16) string {
+	return string(utf16.Decode(s))
+}
+
+func encodeRunes(s []rune) []uint16 {
+	return utf16.Encode(s)
+}
+
+// decodeUnits combines surrogate pairs but keeps lone surrogates, which
+// utf16.Decode would replace
+func decodeUnits(s []uint16) []rune {
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := rune(s[i])
+		if isLeadSurrogate(c) && i+1 < len(s) && isTrailSurrogate(rune(s[i+1])) {
+			c = combineSurrogates(c, rune(s[i+1]))
+			i++
+		}
+		runes = append(runes, c)
+	}
+	return runes
+}
+
+func isLeadSurrogate(c rune) bool {
+	return c >= 0xD800 && c <= 0xDBFF
+}
+
+func isTrailSurrogate(c rune) bool {
+	return c >= 0xDC00 && c <= 0xDFFF
+}
+
+func combineSurrogates(lead, trail rune) rune {
+	return (lead-0xD800)<<10 + (trail - 0xDC00) + 0x10000
+}
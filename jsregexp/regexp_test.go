@@ -0,0 +1,368 @@
+package jsregexp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// groups formats the captures of a match like JS prints exec results,
+// undefined for groups that didn't participate
+func groups(m *Match) []string {
+	if m == nil {
+		return nil
+	}
+	result := []string{}
+	for i := 0; i <= m.NumGroups(); i++ {
+		if group, ok := m.Group(i); ok {
+			result = append(result, DecodeString(group))
+		} else {
+			result = append(result, "undefined")
+		}
+	}
+	return result
+}
+
+func TestExec(t *testing.T) {
+	tests := []struct {
+		pattern, flags, input string
+		expected              []string
+	}{
+		{`a+b`, "", "xaab", []string{"aab"}},
+		{`(a)|(b)`, "", "b", []string{"b", "undefined", "b"}},
+		{`(\d+)-(\d+)`, "", "tel 12-345", []string{"12-345", "12", "345"}},
+		{`(?<year>\d{4})-(?<month>\d{2})`, "", "2024-05", []string{"2024-05", "2024", "05"}},
+		{`(a)\1`, "", "aa", []string{"aa", "a"}},
+		{`\1(a)`, "", "a", []string{"a", "a"}},
+		{`(?<x>b)\k<x>`, "", "abb", []string{"bb", "b"}},
+		{`(?<a>x)|(?<a>y)`, "", "y", []string{"y", "undefined", "y"}},
+		{`(?:(?<a>x)|(?<a>y))\k<a>`, "", "xyy", []string{"yy", "undefined", "y"}},
+		{`(?:(?:(?<a>x)|(?<a>y))|(?<a>z))\k<a>`, "u", "zz", []string{"zz", "undefined", "undefined", "z"}},
+		{`(z)((a+)?(b+)?(c))*`, "", "zaacbbbcac", []string{"zaacbbbcac", "z", "ac", "a", "undefined", "c"}},
+		{`(a*)*`, "", "b", []string{"", "undefined"}},
+		{`(a*)b\1+`, "", "baaaac", []string{"b", ""}},
+		{`(?=(a+))`, "", "baaabac", []string{"", "aaa"}},
+		{`(?=(a+))a*b\1`, "", "baaabac", []string{"aba", "a"}},
+		{`(.*?)a(?!(a+)b\2c)\2(.*)`, "", "baaabaac", []string{"baaabaac", "ba", "undefined", "abaac"}},
+		{`(?<=\$)\d+(\.\d*)?`, "", "cost $10.53", []string{"10.53", ".53"}},
+		{`(?<!\$)\b\d+`, "", "$10 20", []string{"20"}},
+		{`(?<=(\d+)(\d+))$`, "", "1053", []string{"", "1", "053"}},
+		{`(?<=\1(a))b`, "", "aab", []string{"b", "a"}},
+		{`a.c`, "", "a\nc", nil},
+		{`a.c`, "s", "a\nc", []string{"a\nc"}},
+		{`^b`, "", "a\nb", nil},
+		{`^b$`, "m", "a\nb\nc", []string{"b"}},
+		{`ABC`, "i", "xabc", []string{"abc"}},
+		{`[a-z]+`, "i", "ABC", []string{"ABC"}},
+		{`K`, "i", "k", nil},
+		{`K`, "iu", "k", []string{"k"}},
+		{`\w`, "iu", "ſ", []string{"ſ"}},
+		{`\W`, "iu", "ſ", nil},
+		{`ß`, "i", "ẞ", nil},
+		{`a(?i:b)c`, "", "aBc", []string{"aBc"}},
+		{`a(?i:b)c`, "", "aBC", nil},
+		{`(?-i:a)b`, "i", "AbaB", []string{"aB"}},
+		{`(?i-s:a.)`, "s", "a\nA.", []string{"A."}},
+		{`(?m:^b)`, "", "a\nb", []string{"b"}},
+		{`(?s:.)`, "", "\n", []string{"\n"}},
+		{`(?i:\w)`, "u", "ſ", []string{"ſ"}},
+		{`(?i:(a))\1`, "", "AaAA", []string{"AA", "A"}},
+		{`(?i:(a)\1)`, "", "Aa", []string{"Aa", "A"}},
+		{`(?i:a)+`, "", "aAb", []string{"aA"}},
+		{`.`, "", "😀", []string{"�"}},
+		{`^.$`, "u", "😀", []string{"😀"}},
+		{`\u{1F600}`, "u", "😀", []string{"😀"}},
+		{`😀`, "u", "😀", []string{"😀"}},
+		{`[😀]`, "u", "😀", []string{"😀"}},
+		{`\udf06`, "u", "𝌆", nil},
+		{`\ud834`, "u", "𝌆", nil},
+		{`x?\udf06`, "u", "a𝌆", nil},
+		{`\p{Lu}+`, "u", "abcDEF", []string{"DEF"}},
+		{`\p{Script=Greek}`, "u", "aβ", []string{"β"}},
+		{`\P{L}`, "u", "ab1", []string{"1"}},
+		{`[\p{L}--[a-z]]`, "v", "abC", []string{"C"}},
+		{`[\w&&\d]+`, "v", "ab12", []string{"12"}},
+		{`[\q{abc|d}x]+`, "v", "abcxd!", []string{"abcxd"}},
+		{`[\q{}a]`, "v", "b", []string{""}},
+		{`\p{RGI_Emoji}`, "v", "a👨‍👩‍👧!", []string{"👨‍👩‍👧"}},
+		{`^\p{Emoji_Keycap_Sequence}$`, "v", "#️⃣", []string{"#️⃣"}},
+		{`\p{Basic_Emoji}+`, "v", "a☺️😀", []string{"☺️😀"}},
+		{`[\p{RGI_Emoji}--\p{RGI_Emoji_ZWJ_Sequence}]`, "v", "👨‍👩‍👧", []string{"👨"}},
+		{`(?<=\p{RGI_Emoji_Flag_Sequence})x`, "v", "🇩🇪x", []string{"x"}},
+		{`a{2,3}`, "", "aaaa", []string{"aaa"}},
+		{`a{2,3}?`, "", "aaaa", []string{"aa"}},
+		{`a{,2}`, "", "a{,2}", []string{"a{,2}"}},
+		{`x]{`, "", "x]{", []string{"x]{"}},
+		{`\c`, "", "\\c", []string{"\\c"}},
+		{`[\c_]`, "", "\x1f", []string{"\x1f"}},
+		{`\8`, "", "8", []string{"8"}},
+		{`\101`, "", "A", []string{"A"}},
+		{`(?=a)*b`, "", "b", []string{"b"}},
+		{`[^]`, "", "\n", []string{"\n"}},
+		{`[]`, "", "a", nil},
+		{`\bfoo\b`, "", "a foo.", []string{"foo"}},
+		{`\Boo`, "", "foo", []string{"oo"}},
+		{`(a)|b`, "", "b", []string{"b", "undefined"}},
+		{`\s+`, "", "a \u00a0\ufeff\u3000b", []string{" \u00a0\ufeff\u3000"}},
+	}
+
+	for _, test := range tests {
+		re, err := New(test.pattern, test.flags)
+		if err != nil {
+			t.Errorf("Failed to compile /%s/%s: %s", test.pattern, test.flags, err.Error())
+			continue
+		}
+		match, err := re.Exec(EncodeString(test.input))
+		if err != nil {
+			t.Errorf("Failed to exec /%s/%s: %s", test.pattern, test.flags, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(groups(match), test.expected) {
+			t.Errorf("/%s/%s on %q: expected %q, got %q", test.pattern, test.flags, test.input, test.expected, groups(match))
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		pattern, flags, message string
+	}{
+		{`(`, "", "Unterminated group"},
+		{`)`, "", "Unmatched ')'"},
+		{`*a`, "", "Nothing to repeat"},
+		{`a**`, "", "Nothing to repeat"},
+		{`{1}`, "", "Nothing to repeat"},
+		{`a{2,1}`, "", "numbers out of order in {} quantifier"},
+		{`{`, "u", "Lone quantifier brackets"},
+		{`a{1`, "u", "Incomplete quantifier"},
+		{`[b-a]`, "", "Range out of order in character class"},
+		{`[\d-z]`, "u", "Invalid character class"},
+		{`[a`, "", "Unterminated character class"},
+		{`\`, "", "\\ at end of pattern"},
+		{`\2(a)`, "u", "Invalid escape"},
+		{`\-`, "u", "Invalid escape"},
+		{`(?<a>x)(?<a>y)`, "", "Duplicate capture group name"},
+		{`(?:(?<a>x)|y)(?<a>z)`, "", "Duplicate capture group name"},
+		{`(?<a>x)|(?<a>y)(?<a>z)`, "", "Duplicate capture group name"},
+		{`(?<a>x(?<a>y)|z)`, "", "Duplicate capture group name"},
+		{`(?<1a>x)`, "", "Invalid capture group name"},
+		{`\k<b>(?<a>x)`, "", "Invalid named capture referenced"},
+		{`\k`, "u", "Invalid named reference"},
+		{`\p{Nope}`, "u", "Invalid property name"},
+		{`\p{RGI_Emoji}`, "u", "Invalid property name"},
+		{`\P{RGI_Emoji}`, "v", "Invalid property name"},
+		{`[^\p{RGI_Emoji}]`, "v", "Negated character class may contain strings"},
+		{`(?<=a)+`, "", "Nothing to repeat"},
+		{`(?=a)+`, "u", "Nothing to repeat"},
+		{`[a&&&b]`, "v", "Invalid set operation in character class"},
+		{`[a&&b--c]`, "v", "Invalid set operation in character class"},
+		{`[(]`, "v", "Invalid character in character class"},
+		{`[^\q{ab}]`, "v", "Negated character class may contain strings"},
+		{`(?x)`, "", "Invalid group"},
+		{`(?ii:a)`, "", "Duplicate regular expression modifiers"},
+		{`(?i-i:a)`, "", "Duplicate regular expression modifiers"},
+		{`(?-:a)`, "", "Invalid regular expression modifiers"},
+		{`(?ix:a)`, "", "Invalid regular expression modifiers"},
+		{`(?i)a`, "", "Invalid regular expression modifiers"},
+		{`a`, "gg", "Invalid flags supplied to RegExp constructor 'gg'"},
+		{`a`, "uv", "Invalid flags supplied to RegExp constructor 'uv'"},
+		{`a`, "x", "Invalid flags supplied to RegExp constructor 'x'"},
+		{strings.Repeat("(", 1001) + strings.Repeat(")", 1001), "", "Maximum nesting depth exceeded"},
+		{strings.Repeat("(?:", 1001) + strings.Repeat(")", 1001), "", "Maximum nesting depth exceeded"},
+		{strings.Repeat("[", 1001) + strings.Repeat("]", 1001), "v", "Maximum nesting depth exceeded"},
+	}
+
+	for _, test := range tests {
+		_, err := New(test.pattern, test.flags)
+		if err == nil {
+			t.Errorf("Expected /%s/%s to be invalid", test.pattern, test.flags)
+			continue
+		}
+		if !strings.HasSuffix(err.Error(), test.message) {
+			t.Errorf("/%s/%s: expected %q, got %q", test.pattern, test.flags, test.message, err.Error())
+		}
+	}
+}
+
+func TestLastIndex(t *testing.T) {
+	input := EncodeString("a1b2c3")
+
+	re := MustNew(`\d`, "g")
+	indices := []int{}
+	for {
+		match, _ := re.Exec(input)
+		if match == nil {
+			break
+		}
+		indices = append(indices, match.Index)
+	}
+	if !reflect.DeepEqual(indices, []int{1, 3, 5}) || re.LastIndex != 0 {
+		t.Errorf("Unexpected global matches %v, lastIndex %d", indices, re.LastIndex)
+	}
+
+	sticky := MustNew(`\d`, "y")
+	sticky.LastIndex = 1
+	if match, _ := sticky.Exec(input); match == nil || match.Index != 1 || sticky.LastIndex != 2 {
+		t.Error("Expected sticky match at lastIndex")
+	}
+	if match, _ := sticky.Exec(input); match != nil || sticky.LastIndex != 0 {
+		t.Error("Expected sticky match to fail away from lastIndex")
+	}
+
+	plain := MustNew(`\d`, "")
+	plain.LastIndex = 4
+	if match, _ := plain.Exec(input); match == nil || match.Index != 1 || plain.LastIndex != 4 {
+		t.Error("Expected lastIndex to be ignored and kept without g or y")
+	}
+
+	unicode := MustNew(`.`, "gu")
+	unicode.LastIndex = 1
+	if match, _ := unicode.Exec(EncodeString("😀")); match == nil || match.Index != 0 || unicode.LastIndex != 2 {
+		t.Error("Expected a unicode match to start at the surrogate pair lastIndex points into")
+	}
+}
+
+func TestIndices(t *testing.T) {
+	re := MustNew(`a(?<Z>z)?(b)`, "d")
+	if !re.HasIndices() || re.Flags() != "d" {
+		t.Fatal("Expected the d flag")
+	}
+	match, _ := re.Exec(EncodeString("xab"))
+	spans := [][]int{}
+	for i := 0; i <= match.NumGroups(); i++ {
+		if start, end, ok := match.Span(i); ok {
+			spans = append(spans, []int{start, end})
+		} else {
+			spans = append(spans, nil)
+		}
+	}
+	if !reflect.DeepEqual(spans, [][]int{{1, 3}, nil, {2, 3}}) {
+		t.Errorf("Unexpected indices %v", spans)
+	}
+	if !reflect.DeepEqual(re.GroupNames(), []string{"", "Z", ""}) {
+		t.Errorf("Unexpected group names %v", re.GroupNames())
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	re := MustNew(`(a+)+$`, "")
+	re.StepLimit = 100_000
+	_, err := re.Exec(EncodeString(strings.Repeat("a", 40) + "!"))
+	if !errors.Is(err, ErrStepLimit) {
+		t.Errorf("Expected catastrophic backtracking to hit the step limit, got %v", err)
+	}
+
+	long := EncodeString(strings.Repeat("ab", 100_000))
+	if match, err := MustNew(`(?:ab)*$`, "").Exec(long); err != nil || match == nil || match.End() != len(long) {
+		t.Errorf("Expected a long linear match to succeed, got %v", err)
+	}
+
+	// Every repetition of the group recurses, a longer input has to fail
+	// before it overflows the Go stack
+	tooLong := EncodeString(strings.Repeat("ab", MAX_MATCH_DEPTH))
+	for _, pattern := range []string{`^(?:ab)*$`, `(?:ab)*`, `^(?:(a)|b)*$`} {
+		re := MustNew(pattern, "")
+		re.StepLimit = 100 * MAX_MATCH_DEPTH
+		if _, err := re.Exec(tooLong); !errors.Is(err, ErrStackLimit) {
+			t.Errorf("Expected /%s/ to hit the stack limit, got %v", pattern, err)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := map[string]string{
+		"":       "(?:)",
+		"a/b":    `a\/b`,
+		`a\/b`:   `a\/b`,
+		"[/]":    "[/]",
+		"a\nb":   `a\nb`,
+		"\u2028": `\u2028`,
+	}
+	for pattern, expected := range tests {
+		if source := MustNew(pattern, "").Source(); source != expected {
+			t.Errorf("Expected source of %q to be %s, got %s", pattern, expected, source)
+		}
+	}
+	if s := MustNew("a", "yusmigd").String(); s != "/a/dgimsuy" {
+		t.Errorf("Unexpected %s", s)
+	}
+}
+
+func TestStringMethods(t *testing.T) {
+	s := EncodeString("John Smith, Jane Doe")
+
+	replaced, _ := MustNew(`(?<first>\w+)\s(\w+)`, "g").Replace(s, EncodeString("$2 $<first> [$&] $$ $3 $0"))
+	if DecodeString(replaced) != "Smith John [John Smith] $ $3 $0, Doe Jane [Jane Doe] $ $3 $0" {
+		t.Errorf("Unexpected replacement %q", DecodeString(replaced))
+	}
+
+	replaced, _ = MustNew(`(?<letter>a)|(?<letter>b)`, "g").Replace(EncodeString("abc"), EncodeString("[$<letter>]"))
+	if DecodeString(replaced) != "[a][b]c" {
+		t.Errorf("Unexpected replacement %q", DecodeString(replaced))
+	}
+
+	replaced, _ = MustNew(`o`, "").Replace(s, EncodeString("[$`|$']"))
+	if DecodeString(replaced) != "J[J|hn Smith, Jane Doe]hn Smith, Jane Doe" {
+		t.Errorf("Unexpected replacement %q", DecodeString(replaced))
+	}
+
+	replaced, _ = MustNew(`x*`, "g").ReplaceFunc(EncodeString("abc"), func(m *Match) []uint16 {
+		return EncodeString("-")
+	})
+	if DecodeString(replaced) != "-a-b-c-" {
+		t.Errorf("Unexpected replacement %q", DecodeString(replaced))
+	}
+
+	if _, err := MustNew(`a`, "").ReplaceAll(s, nil); err == nil {
+		t.Error("Expected replaceAll with a non-global regexp to fail")
+	}
+
+	matches, _ := MustNew(`J\w+`, "g").MatchString(s)
+	if len(matches) != 2 || DecodeString(matches[1].Input[matches[1].Index:matches[1].End()]) != "Jane" {
+		t.Errorf("Unexpected matches %v", matches)
+	}
+
+	re := MustNew(`(\w)(\w+)`, "g")
+	all, _ := re.MatchAll(s)
+	if len(all) != 4 || !reflect.DeepEqual(groups(all[3]), []string{"Doe", "D", "oe"}) || re.LastIndex != 0 {
+		t.Errorf("Unexpected matchAll results")
+	}
+
+	searched := MustNew(`Sm`, "g")
+	searched.LastIndex = 3
+	if index, _ := searched.Search(s); index != 5 || searched.LastIndex != 3 {
+		t.Errorf("Unexpected search result %d", index)
+	}
+
+	split := func(pattern, flags, input string, limit uint32) []string {
+		parts, err := MustNew(pattern, flags).Split(EncodeString(input), limit)
+		if err != nil {
+			t.Fatalf("Failed to split: %s", err.Error())
+		}
+		result := []string{}
+		for _, part := range parts {
+			if part == nil {
+				result = append(result, "undefined")
+			} else {
+				result = append(result, DecodeString(part))
+			}
+		}
+		return result
+	}
+	if parts := split(`,\s*`, "", "a, b,c", 0xFFFFFFFF); !reflect.DeepEqual(parts, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected split %q", parts)
+	}
+	if parts := split(`(-)|(\+)`, "", "1-2+3", 0xFFFFFFFF); !reflect.DeepEqual(parts, []string{"1", "-", "undefined", "2", "undefined", "+", "3"}) {
+		t.Errorf("Unexpected split %q", parts)
+	}
+	if parts := split(``, "", "abc", 2); !reflect.DeepEqual(parts, []string{"a", "b"}) {
+		t.Errorf("Unexpected split %q", parts)
+	}
+	if parts := split(``, "u", "😀x", 0xFFFFFFFF); !reflect.DeepEqual(parts, []string{"😀", "x"}) {
+		t.Errorf("Unexpected split %q", parts)
+	}
+	if parts := split(`a*`, "", "", 0xFFFFFFFF); !reflect.DeepEqual(parts, []string{}) {
+		t.Errorf("Unexpected split %q", parts)
+	}
+}
@@ -0,0 +1,261 @@
+package jsregexp
+
+import "errors"
+
+// STRING METHODS
+//
+// These are the RegExp.prototype[@@match], [@@matchAll], [@@replace],
+// [@@search] and [@@split] algorithms the String methods delegate to, for
+// regexps that don't override exec.
+
+// MatchString is String.prototype.match. Without the g flag it returns the
+// result of Exec in a one element slice, with it every match starting from 0.
+func (re *RegExp) MatchString(s []uint16) ([]*Match, error) {
+	if !re.flags.global {
+		match, err := re.Exec(s)
+		if match == nil || err != nil {
+			return nil, err
+		}
+		return []*Match{match}, nil
+	}
+	re.LastIndex = 0
+	return re.execAll(s)
+}
+
+// MatchAll is String.prototype.matchAll, it's a TypeError to call it with a
+// regexp without the g flag
+func (re *RegExp) MatchAll(s []uint16) ([]*Match, error) {
+	if !re.flags.global {
+		return nil, errors.New("String.prototype.matchAll called with a non-global RegExp argument")
+	}
+	// The iterator works on a copy that starts at lastIndex
+	clone := *re
+	return clone.execAll(s)
+}
+
+func (re *RegExp) execAll(s []uint16) ([]*Match, error) {
+	matches := []*Match{}
+	for {
+		match, err := re.Exec(s)
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			return matches, nil
+		}
+		matches = append(matches, match)
+		if match.End() == match.Index {
+			re.LastIndex = AdvanceStringIndex(s, re.LastIndex, re.flags.unicode || re.flags.unicodeSets)
+		}
+	}
+}
+
+// Search is String.prototype.search, lastIndex is left as it was
+func (re *RegExp) Search(s []uint16) (int, error) {
+	previous := re.LastIndex
+	re.LastIndex = 0
+	match, err := re.Exec(s)
+	re.LastIndex = previous
+	if match == nil || err != nil {
+		return -1, err
+	}
+	return match.Index, nil
+}
+
+// Replace is String.prototype.replace with a replacement string, in which $&,
+// $1, $<name> and the other patterns of GetSubstitution are expanded. With
+// the g flag every match is replaced.
+func (re *RegExp) Replace(s []uint16, replacement []uint16) ([]uint16, error) {
+	return re.ReplaceFunc(s, func(m *Match) []uint16 {
+		return m.Expand(replacement)
+	})
+}
+
+// ReplaceFunc is String.prototype.replace with a replacer function
+func (re *RegExp) ReplaceFunc(s []uint16, replacer func(m *Match) []uint16) ([]uint16, error) {
+	var matches []*Match
+	var err error
+	if re.flags.global {
+		re.LastIndex = 0
+		matches, err = re.execAll(s)
+	} else {
+		var match *Match
+		match, err = re.Exec(s)
+		if match != nil {
+			matches = []*Match{match}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := []uint16{}
+	next := 0
+	for _, match := range matches {
+		if match.Index < next {
+			continue
+		}
+		result = append(result, s[next:match.Index]...)
+		result = append(result, replacer(match)...)
+		next = match.End()
+	}
+	return append(result, s[next:]...), nil
+}
+
+// ReplaceAll is String.prototype.replaceAll, it's a TypeError to call it with
+// a regexp without the g flag
+func (re *RegExp) ReplaceAll(s []uint16, replacement []uint16) ([]uint16, error) {
+	if !re.flags.global {
+		return nil, errors.New("replaceAll must be called with a global RegExp")
+	}
+	return re.Replace(s, replacement)
+}
+
+// Expand substitutes the $ patterns of replacement for this match, see
+// GetSubstitution
+func (m *Match) Expand(replacement []uint16) []uint16 {
+	captures := make([][]uint16, m.NumGroups())
+	for i := range captures {
+		if group, ok := m.Group(i + 1); ok {
+			captures[i] = group
+		}
+	}
+	var named func(name string) ([]uint16, bool)
+	for _, name := range m.groupNames {
+		if name != "" {
+			named = m.NamedGroup
+			break
+		}
+	}
+	matched, _ := m.Group(0)
+	return GetSubstitution(matched, m.Input, m.Index, captures, named, replacement)
+}
+
+// GetSubstitution expands the $ patterns of a replacement string. captures
+// holds groups 1 and up, nil for the ones that didn't match. named looks up
+// named groups, it's nil when the regexp has none, which leaves $< as is.
+func GetSubstitution(matched []uint16, s []uint16, position int, captures [][]uint16, named func(name string) ([]uint16, bool), replacement []uint16) []uint16 {
+	result := []uint16{}
+	tailPos := min(position+len(matched), len(s))
+
+	for i := 0; i < len(replacement); i++ {
+		c := replacement[i]
+		if c != '$' || i+1 == len(replacement) {
+			result = append(result, c)
+			continue
+		}
+
+		next := replacement[i+1]
+		switch {
+		case next == '$':
+			result = append(result, '$')
+			i++
+		case next == '&':
+			result = append(result, matched...)
+			i++
+		case next == '`':
+			result = append(result, s[:position]...)
+			i++
+		case next == '\'':
+			result = append(result, s[tailPos:]...)
+			i++
+		case next >= '0' && next <= '9':
+			index := int(next - '0')
+			digits := 1
+			if i+2 < len(replacement) && replacement[i+2] >= '0' && replacement[i+2] <= '9' {
+				twoDigits := index*10 + int(replacement[i+2]-'0')
+				if twoDigits >= 1 && twoDigits <= len(captures) {
+					index, digits = twoDigits, 2
+				}
+			}
+			if index < 1 || index > len(captures) {
+				result = append(result, c)
+				continue
+			}
+			result = append(result, captures[index-1]...)
+			i += digits
+		case next == '<' && named != nil:
+			end := -1
+			for j := i + 2; j < len(replacement); j++ {
+				if replacement[j] == '>' {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				result = append(result, c)
+				continue
+			}
+			if group, ok := named(DecodeString(replacement[i+2 : end])); ok {
+				result = append(result, group...)
+			}
+			i = end
+		default:
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Split is String.prototype.split. limit is ToUint32 of the limit argument,
+// math.MaxUint32 when it's undefined. Captures are spliced into the
+// result, the ones that didn't match are nil while matched empty strings are
+// empty, non-nil slices.
+func (re *RegExp) Split(s []uint16, limit uint32) ([][]uint16, error) {
+	result := [][]uint16{}
+	if limit == 0 {
+		return result, nil
+	}
+
+	splitter := re.withSticky()
+	splitter.flags.global = false
+	fullUnicode := re.flags.unicode || re.flags.unicodeSets
+
+	if len(s) == 0 {
+		splitter.LastIndex = 0
+		match, err := splitter.Exec(s)
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			result = append(result, []uint16{})
+		}
+		return result, nil
+	}
+
+	p := 0
+	for q := p; q < len(s); {
+		splitter.LastIndex = q
+		match, err := splitter.Exec(s)
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			q = AdvanceStringIndex(s, q, fullUnicode)
+			continue
+		}
+		e := min(splitter.LastIndex, len(s))
+		if e == p {
+			q = AdvanceStringIndex(s, q, fullUnicode)
+			continue
+		}
+
+		result = append(result, append([]uint16{}, s[p:q]...))
+		if uint32(len(result)) == limit {
+			return result, nil
+		}
+		p = e
+		for i := 1; i <= match.NumGroups(); i++ {
+			group, ok := match.Group(i)
+			if ok {
+				group = append([]uint16{}, group...)
+			}
+			result = append(result, group)
+			if uint32(len(result)) == limit {
+				return result, nil
+			}
+		}
+		q = p
+	}
+	return append(result, append([]uint16{}, s[p:]...)), nil
+}
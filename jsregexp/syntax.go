@@ -0,0 +1,1183 @@
+package jsregexp
+
+import (
+	"math"
+	"unicode"
+)
+
+// PATTERN SYNTAX
+//
+// The grammar is ecma-262 22.2.1 with the Annex B extensions that apply when
+// neither the u nor the v flag is set.
+
+type nodeType int
+
+const (
+	NODE_EMPTY nodeType = iota
+	NODE_CHAR
+	NODE_ANY
+	NODE_CLASS
+	NODE_LINE_START
+	NODE_LINE_END
+	NODE_WORD_BOUNDARY
+	NODE_NOT_WORD_BOUNDARY
+	NODE_BACKREFERENCE
+	NODE_GROUP
+	NODE_LOOKAHEAD
+	NODE_NEGATIVE_LOOKAHEAD
+	NODE_LOOKBEHIND
+	NODE_NEGATIVE_LOOKBEHIND
+	NODE_ALTERNATION
+	NODE_CONCAT
+	NODE_REPEAT
+	NODE_MODIFIERS
+)
+
+type node struct {
+	typ      nodeType
+	ch       rune
+	class    *charClass
+	index    int    // capture group of NODE_GROUP and NODE_BACKREFERENCE
+	name     string // group name of a named backreference, resolved after parsing
+	indices  []int  // groups of a named backreference, a name can be used once per alternative
+	min, max int    // max is -1 when unbounded
+	greedy   bool
+	children []*node
+
+	// Capture groups inside a NODE_REPEAT, they're reset on every iteration
+	firstGroup, groupCount int
+
+	// Flags turned on and off by a NODE_MODIFIERS group like (?i-m:...)
+	enable, disable flags
+}
+
+// SyntaxError is returned for invalid patterns and flags
+type SyntaxError struct {
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Message
+}
+
+func syntaxError(message string) error {
+	return &SyntaxError{Message: message}
+}
+
+type syntaxParser struct {
+	// Code points in unicode mode, code units otherwise
+	src []rune
+	pos int
+
+	unicode     bool // u or v
+	unicodeSets bool // v
+	ignoreCase  bool
+
+	// Set when the pattern has named groups, which makes \k a named
+	// backreference even without the u flag (Annex B)
+	namedGroups bool
+	groupCount  int
+
+	captureIndex int
+	groupNames   []string // by group index, "" for unnamed groups
+	namedRefs    []*node
+
+	// The alternatives the parser is in, outermost first. Groups can share a
+	// name when they are in different alternatives of the same disjunction.
+	alternatives []alternative
+	disjunctions int
+	groupPaths   [][]alternative // by group index
+
+	// How many groups and v-mode classes the parser is inside
+	depth int
+}
+
+// alternative is the index of an alternative in the disjunction with the id
+// disjunction
+type alternative struct {
+	disjunction, index int
+}
+
+func parsePattern(src []rune, f flags) (*node, *syntaxParser, error) {
+	p := &syntaxParser{
+		src:         src,
+		unicode:     f.unicode || f.unicodeSets,
+		unicodeSets: f.unicodeSets,
+		ignoreCase:  f.ignoreCase,
+		groupNames:  []string{""},
+		groupPaths:  [][]alternative{nil},
+	}
+	p.countGroups()
+
+	n, err := p.parseDisjunction()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.src) {
+		if p.src[p.pos] == ')' {
+			return nil, nil, syntaxError("Unmatched ')'")
+		}
+		return nil, nil, syntaxError("Unexpected character")
+	}
+
+	for _, ref := range p.namedRefs {
+		ref.indices = p.groupIndices(ref.name)
+		if len(ref.indices) == 0 {
+			return nil, nil, syntaxError("Invalid named capture referenced")
+		}
+	}
+	return n, p, nil
+}
+
+// countGroups finds how many capture groups the pattern has before parsing,
+// a decimal escape is a backreference only when that group exists
+func (p *syntaxParser) countGroups() {
+	depth := 0
+	for i := 0; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+			if !p.unicodeSets {
+				depth = 0
+			}
+		case '(':
+			if depth > 0 {
+				continue
+			}
+			if i+1 < len(p.src) && p.src[i+1] == '?' {
+				if i+2 < len(p.src) && p.src[i+2] == '<' && i+3 < len(p.src) && p.src[i+3] != '=' && p.src[i+3] != '!' {
+					p.groupCount++
+					p.namedGroups = true
+				}
+				continue
+			}
+			p.groupCount++
+		}
+	}
+}
+
+func (p *syntaxParser) groupIndices(name string) []int {
+	indices := []int{}
+	for i, n := range p.groupNames {
+		if n == name && name != "" {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// mightBothParticipate is false when the groups at the paths a and b are in
+// different alternatives of a disjunction, see MightBothParticipate
+func mightBothParticipate(a, b []alternative) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].disjunction != b[i].disjunction {
+			return true
+		}
+		if a[i].index != b[i].index {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *syntaxParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *syntaxParser) cur() rune {
+	if p.pos >= len(p.src) {
+		return -1
+	}
+	return p.src[p.pos]
+}
+
+func (p *syntaxParser) peek(offset int) rune {
+	if p.pos+offset >= len(p.src) {
+		return -1
+	}
+	return p.src[p.pos+offset]
+}
+
+func (p *syntaxParser) lookingAt(s string) bool {
+	i := p.pos
+	for _, r := range s {
+		if i >= len(p.src) || p.src[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+func (p *syntaxParser) parseDisjunction() (*node, error) {
+	id := p.disjunctions
+	p.disjunctions++
+	alternatives := []*node{}
+	for {
+		p.alternatives = append(p.alternatives, alternative{id, len(alternatives)})
+		alternative, err := p.parseAlternative()
+		p.alternatives = p.alternatives[:len(p.alternatives)-1]
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, alternative)
+		if p.cur() != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return &node{typ: NODE_ALTERNATION, children: alternatives}, nil
+}
+
+func (p *syntaxParser) parseAlternative() (*node, error) {
+	terms := []*node{}
+	for !p.eof() && p.cur() != '|' && p.cur() != ')' {
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return &node{typ: NODE_CONCAT, children: terms}, nil
+}
+
+func (p *syntaxParser) parseTerm() (*node, error) {
+	switch {
+	case p.cur() == '^':
+		p.pos++
+		return &node{typ: NODE_LINE_START}, nil
+	case p.cur() == '$':
+		p.pos++
+		return &node{typ: NODE_LINE_END}, nil
+	case p.lookingAt(`\b`):
+		p.pos += 2
+		return &node{typ: NODE_WORD_BOUNDARY}, nil
+	case p.lookingAt(`\B`):
+		p.pos += 2
+		return &node{typ: NODE_NOT_WORD_BOUNDARY}, nil
+	case p.lookingAt("(?=") || p.lookingAt("(?!"):
+		typ := NODE_LOOKAHEAD
+		if p.peek(2) == '!' {
+			typ = NODE_NEGATIVE_LOOKAHEAD
+		}
+		groupsBefore := p.captureIndex
+		p.pos += 3
+		lookahead, err := p.parseGroupBody(typ)
+		if err != nil {
+			return nil, err
+		}
+		if p.unicode {
+			return lookahead, nil
+		}
+		// Annex B QuantifiableAssertion
+		return p.parseQuantifier(lookahead, groupsBefore)
+	case p.lookingAt("(?<=") || p.lookingAt("(?<!"):
+		typ := NODE_LOOKBEHIND
+		if p.peek(3) == '!' {
+			typ = NODE_NEGATIVE_LOOKBEHIND
+		}
+		p.pos += 4
+		return p.parseGroupBody(typ)
+	}
+
+	groupsBefore := p.captureIndex
+	atom, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	return p.parseQuantifier(atom, groupsBefore)
+}
+
+// enterDepth guards the recursion of nested groups and classes, each call
+// has to be paired with exitDepth
+func (p *syntaxParser) enterDepth() error {
+	p.depth++
+	if p.depth > MAX_NESTING_DEPTH {
+		return syntaxError("Maximum nesting depth exceeded")
+	}
+	return nil
+}
+
+func (p *syntaxParser) exitDepth() {
+	p.depth--
+}
+
+// parseGroupBody parses up to and including the closing paren
+func (p *syntaxParser) parseGroupBody(typ nodeType) (*node, error) {
+	if err := p.enterDepth(); err != nil {
+		return nil, err
+	}
+	body, err := p.parseDisjunction()
+	p.exitDepth()
+	if err != nil {
+		return nil, err
+	}
+	if p.cur() != ')' {
+		return nil, syntaxError("Unterminated group")
+	}
+	p.pos++
+	return &node{typ: typ, children: []*node{body}}, nil
+}
+
+func (p *syntaxParser) parseQuantifier(atom *node, groupsBefore int) (*node, error) {
+	var min, max int
+	switch p.cur() {
+	case '*':
+		min, max = 0, -1
+		p.pos++
+	case '+':
+		min, max = 1, -1
+		p.pos++
+	case '?':
+		min, max = 0, 1
+		p.pos++
+	case '{':
+		var ok bool
+		min, max, ok = p.tryBracedQuantifier()
+		if !ok {
+			if p.unicode {
+				return nil, syntaxError("Incomplete quantifier")
+			}
+			// Annex B, the brace is a literal and is parsed as the next atom
+			return atom, nil
+		}
+	default:
+		return atom, nil
+	}
+
+	greedy := true
+	if p.cur() == '?' {
+		greedy = false
+		p.pos++
+	}
+	if max != -1 && min > max {
+		return nil, syntaxError("numbers out of order in {} quantifier")
+	}
+
+	return &node{
+		typ:        NODE_REPEAT,
+		min:        min,
+		max:        max,
+		greedy:     greedy,
+		children:   []*node{atom},
+		firstGroup: groupsBefore + 1,
+		groupCount: p.captureIndex - groupsBefore,
+	}, nil
+}
+
+// tryBracedQuantifier reads {n}, {n,} or {n,m}. It leaves pos untouched when
+// the brace doesn't start a quantifier.
+func (p *syntaxParser) tryBracedQuantifier() (int, int, bool) {
+	start := p.pos
+	p.pos++
+	min, ok := p.readDecimal()
+	if !ok {
+		p.pos = start
+		return 0, 0, false
+	}
+	max := min
+	if p.cur() == ',' {
+		p.pos++
+		if p.cur() == '}' {
+			max = -1
+		} else if max, ok = p.readDecimal(); !ok {
+			p.pos = start
+			return 0, 0, false
+		}
+	}
+	if p.cur() != '}' {
+		p.pos = start
+		return 0, 0, false
+	}
+	p.pos++
+	return min, max, true
+}
+
+func (p *syntaxParser) readDecimal() (int, bool) {
+	start := p.pos
+	value := 0
+	for p.cur() >= '0' && p.cur() <= '9' {
+		if value < math.MaxInt32 {
+			value = value*10 + int(p.cur()-'0')
+		}
+		p.pos++
+	}
+	return min(value, math.MaxInt32), p.pos > start
+}
+
+func (p *syntaxParser) parseAtom() (*node, error) {
+	c := p.cur()
+	switch c {
+	case '.':
+		p.pos++
+		return &node{typ: NODE_ANY}, nil
+	case '(':
+		return p.parseGroup()
+	case '[':
+		p.pos++
+		class, err := p.parseClass()
+		if err != nil {
+			return nil, err
+		}
+		return &node{typ: NODE_CLASS, class: class}, nil
+	case '\\':
+		p.pos++
+		return p.parseAtomEscape()
+	case '*', '+', '?':
+		return nil, syntaxError("Nothing to repeat")
+	case '{':
+		if p.unicode {
+			if _, _, ok := p.tryBracedQuantifier(); ok {
+				return nil, syntaxError("Nothing to repeat")
+			}
+			return nil, syntaxError("Lone quantifier brackets")
+		}
+		if _, _, ok := p.tryBracedQuantifier(); ok {
+			return nil, syntaxError("Nothing to repeat")
+		}
+	case '}', ']':
+		if p.unicode {
+			return nil, syntaxError("Lone quantifier brackets")
+		}
+	}
+	p.pos++
+	return &node{typ: NODE_CHAR, ch: c}, nil
+}
+
+func (p *syntaxParser) parseGroup() (*node, error) {
+	p.pos++
+	if p.lookingAt("?:") {
+		p.pos += 2
+		body, err := p.parseGroupBody(NODE_CONCAT)
+		if err != nil {
+			return nil, err
+		}
+		return body.children[0], nil
+	}
+
+	if p.cur() == '?' && (p.peek(1) == '-' || isModifier(p.peek(1))) {
+		return p.parseModifiers()
+	}
+
+	name := ""
+	if p.cur() == '?' {
+		if p.peek(1) != '<' {
+			return nil, syntaxError("Invalid group")
+		}
+		p.pos += 2
+		var err error
+		name, err = p.parseGroupName()
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range p.groupIndices(name) {
+			if mightBothParticipate(p.groupPaths[i], p.alternatives) {
+				return nil, syntaxError("Duplicate capture group name")
+			}
+		}
+	}
+
+	p.captureIndex++
+	index := p.captureIndex
+	p.groupNames = append(p.groupNames, name)
+	p.groupPaths = append(p.groupPaths, append([]alternative(nil), p.alternatives...))
+
+	group, err := p.parseGroupBody(NODE_GROUP)
+	if err != nil {
+		return nil, err
+	}
+	group.index = index
+	return group, nil
+}
+
+// parseModifiers reads a group that changes the i, m and s flags for its
+// body, (?ims-ims:...)
+func (p *syntaxParser) parseModifiers() (*node, error) {
+	p.pos++
+	var enable, disable flags
+	current := &enable
+	seen := map[rune]bool{}
+	for p.cur() != ':' {
+		c := p.cur()
+		switch {
+		case c == '-' && current == &enable:
+			current = &disable
+		case isModifier(c):
+			if seen[c] {
+				return nil, syntaxError("Duplicate regular expression modifiers")
+			}
+			seen[c] = true
+			current.set(c)
+		default:
+			return nil, syntaxError("Invalid regular expression modifiers")
+		}
+		p.pos++
+	}
+	if current == &disable && len(seen) == 0 {
+		return nil, syntaxError("Invalid regular expression modifiers")
+	}
+	p.pos++
+
+	ignoreCase := p.ignoreCase
+	p.ignoreCase = (p.ignoreCase || enable.ignoreCase) && !disable.ignoreCase
+	body, err := p.parseGroupBody(NODE_MODIFIERS)
+	p.ignoreCase = ignoreCase
+	if err != nil {
+		return nil, err
+	}
+	body.enable, body.disable = enable, disable
+	return body, nil
+}
+
+func isModifier(c rune) bool {
+	return c == 'i' || c == 'm' || c == 's'
+}
+
+// parseGroupName reads a RegExpIdentifierName and the closing '>'
+func (p *syntaxParser) parseGroupName() (string, error) {
+	name := []rune{}
+	for {
+		if p.eof() {
+			return "", syntaxError("Invalid capture group name")
+		}
+		c := p.cur()
+		if c == '>' {
+			p.pos++
+			break
+		}
+		p.pos++
+		if c == '\\' {
+			if p.cur() != 'u' {
+				return "", syntaxError("Invalid capture group name")
+			}
+			p.pos++
+			var ok bool
+			c, ok = p.readUnicodeEscape(true)
+			if !ok {
+				return "", syntaxError("Invalid Unicode escape sequence")
+			}
+		} else if !p.unicode && isLeadSurrogate(c) && isTrailSurrogate(p.cur()) {
+			c = combineSurrogates(c, p.cur())
+			p.pos++
+		}
+
+		if len(name) == 0 && !isIdentifierStart(c) || len(name) > 0 && !isIdentifierPart(c) {
+			return "", syntaxError("Invalid capture group name")
+		}
+		name = append(name, c)
+	}
+	if len(name) == 0 {
+		return "", syntaxError("Invalid capture group name")
+	}
+	return string(name), nil
+}
+
+func isIdentifierStart(c rune) bool {
+	return c == '$' || c == '_' || unicode.In(c, unicode.L, unicode.Nl, unicode.Other_ID_Start) &&
+		!unicode.In(c, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+func isIdentifierPart(c rune) bool {
+	return isIdentifierStart(c) || c == 0x200C || c == 0x200D ||
+		unicode.In(c, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+			!unicode.In(c, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+func (p *syntaxParser) parseAtomEscape() (*node, error) {
+	if p.eof() {
+		return nil, syntaxError("\\ at end of pattern")
+	}
+
+	c := p.cur()
+	switch {
+	case c >= '1' && c <= '9':
+		start := p.pos
+		n, _ := p.readDecimal()
+		if n <= p.groupCount {
+			return &node{typ: NODE_BACKREFERENCE, index: n}, nil
+		}
+		if p.unicode {
+			return nil, syntaxError("Invalid escape")
+		}
+		p.pos = start
+		if c >= '8' {
+			p.pos++
+			return &node{typ: NODE_CHAR, ch: c}, nil
+		}
+		return &node{typ: NODE_CHAR, ch: p.readLegacyOctal()}, nil
+
+	case c == '0' && p.peek(1) >= '0' && p.peek(1) <= '9':
+		if p.unicode {
+			return nil, syntaxError("Invalid decimal escape")
+		}
+		return &node{typ: NODE_CHAR, ch: p.readLegacyOctal()}, nil
+
+	case c == 'k' && (p.unicode || p.namedGroups):
+		p.pos++
+		if p.cur() != '<' {
+			return nil, syntaxError("Invalid named reference")
+		}
+		p.pos++
+		name, err := p.parseGroupName()
+		if err != nil {
+			return nil, err
+		}
+		ref := &node{typ: NODE_BACKREFERENCE, name: name}
+		p.namedRefs = append(p.namedRefs, ref)
+		return ref, nil
+	}
+
+	class, err := p.parseClassEscape()
+	if err != nil {
+		return nil, err
+	}
+	if class != nil {
+		return &node{typ: NODE_CLASS, class: class}, nil
+	}
+
+	ch, err := p.parseCharacterEscape(false)
+	if err != nil {
+		return nil, err
+	}
+	return &node{typ: NODE_CHAR, ch: ch}, nil
+}
+
+// parseClassEscape reads \d \D \s \S \w \W and, in unicode mode, \p{..} and
+// \P{..}. It returns nil when the escape is something else.
+func (p *syntaxParser) parseClassEscape() (*charClass, error) {
+	c := p.cur()
+	switch c {
+	case 'd', 'D', 's', 'S', 'w', 'W':
+		p.pos++
+		return escapeClass(c, p.unicode && p.ignoreCase), nil
+	case 'p', 'P':
+		if !p.unicode {
+			return nil, nil
+		}
+		p.pos++
+		if p.cur() != '{' {
+			return nil, syntaxError("Invalid property name")
+		}
+		p.pos++
+		start := p.pos
+		for !p.eof() && p.cur() != '}' {
+			p.pos++
+		}
+		if p.eof() {
+			return nil, syntaxError("Invalid property name")
+		}
+		expression := string(p.src[start:p.pos])
+		p.pos++
+
+		class, err := propertyClass(expression, p.unicodeSets && c == 'p')
+		if err != nil {
+			return nil, err
+		}
+		if c == 'P' {
+			class = class.complement()
+		}
+		return class, nil
+	}
+	return nil, nil
+}
+
+// parseCharacterEscape reads the escape after a backslash that stands for a
+// single character, see CharacterEscape
+func (p *syntaxParser) parseCharacterEscape(inClass bool) (rune, error) {
+	c := p.cur()
+	switch c {
+	case 'f':
+		p.pos++
+		return '\f', nil
+	case 'n':
+		p.pos++
+		return '\n', nil
+	case 'r':
+		p.pos++
+		return '\r', nil
+	case 't':
+		p.pos++
+		return '\t', nil
+	case 'v':
+		p.pos++
+		return '\v', nil
+	case 'c':
+		next := p.peek(1)
+		if next >= 'a' && next <= 'z' || next >= 'A' && next <= 'Z' {
+			p.pos += 2
+			return next % 32, nil
+		}
+		if p.unicode {
+			return 0, syntaxError("Invalid unicode escape")
+		}
+		if inClass && (next >= '0' && next <= '9' || next == '_') {
+			p.pos += 2
+			return next % 32, nil
+		}
+		// Annex B, the backslash is a literal and `c` is read as the next
+		// character
+		return '\\', nil
+	case '0':
+		if p.peek(1) < '0' || p.peek(1) > '9' {
+			p.pos++
+			return 0, nil
+		}
+	case 'x':
+		p.pos++
+		if value, ok := p.readHex(2); ok {
+			return value, nil
+		}
+		if p.unicode {
+			return 0, syntaxError("Invalid escape")
+		}
+		return 'x', nil
+	case 'u':
+		p.pos++
+		if value, ok := p.readUnicodeEscape(p.unicode); ok {
+			return value, nil
+		}
+		if p.unicode {
+			return 0, syntaxError("Invalid Unicode escape")
+		}
+		return 'u', nil
+	}
+
+	if p.unicode {
+		if isSyntaxCharacter(c) || c == '/' || inClass && c == '-' {
+			p.pos++
+			return c, nil
+		}
+		if p.unicodeSets && inClass && isClassSetReservedPunctuator(c) {
+			p.pos++
+			return c, nil
+		}
+		return 0, syntaxError("Invalid escape")
+	}
+	if c == 'k' && p.namedGroups {
+		return 0, syntaxError("Invalid named reference")
+	}
+	p.pos++
+	return c, nil
+}
+
+// readLegacyOctal reads an Annex B octal escape, up to \377
+func (p *syntaxParser) readLegacyOctal() rune {
+	value := rune(0)
+	for i := 0; i < 3 && p.cur() >= '0' && p.cur() <= '7'; i++ {
+		next := value*8 + p.cur() - '0'
+		if next > 0377 {
+			break
+		}
+		value = next
+		p.pos++
+	}
+	return value
+}
+
+func (p *syntaxParser) readHex(length int) (rune, bool) {
+	start := p.pos
+	value := rune(0)
+	for i := 0; i < length; i++ {
+		digit := hexValue(p.cur())
+		if digit < 0 {
+			p.pos = start
+			return 0, false
+		}
+		value = value*16 + digit
+		p.pos++
+	}
+	return value, true
+}
+
+// readUnicodeEscape reads what follows \u. In unicode mode it also accepts
+// \u{...} and joins an escaped surrogate pair into one code point.
+func (p *syntaxParser) readUnicodeEscape(unicodeMode bool) (rune, bool) {
+	start := p.pos
+	if unicodeMode && p.cur() == '{' {
+		p.pos++
+		value := rune(0)
+		digits := 0
+		for hexValue(p.cur()) >= 0 {
+			value = value*16 + hexValue(p.cur())
+			if value > unicode.MaxRune {
+				p.pos = start
+				return 0, false
+			}
+			digits++
+			p.pos++
+		}
+		if digits == 0 || p.cur() != '}' {
+			p.pos = start
+			return 0, false
+		}
+		p.pos++
+		return value, true
+	}
+
+	value, ok := p.readHex(4)
+	if !ok {
+		return 0, false
+	}
+	if unicodeMode && isLeadSurrogate(value) && p.lookingAt(`\u`) {
+		afterLead := p.pos
+		p.pos += 2
+		if trail, ok := p.readHex(4); ok && isTrailSurrogate(trail) {
+			return combineSurrogates(value, trail), true
+		}
+		p.pos = afterLead
+	}
+	return value, true
+}
+
+func hexValue(c rune) rune {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10
+	}
+	return -1
+}
+
+func isSyntaxCharacter(c rune) bool {
+	switch c {
+	case '^', '$', '\\', '.', '*', '+', '?', '(', ')', '[', ']', '{', '}', '|':
+		return true
+	}
+	return false
+}
+
+// CHARACTER CLASSES
+
+func (p *syntaxParser) parseClass() (*charClass, error) {
+	if p.unicodeSets {
+		return p.parseClassSet()
+	}
+
+	negate := false
+	if p.cur() == '^' {
+		negate = true
+		p.pos++
+	}
+
+	class := &charClass{}
+	for {
+		if p.eof() {
+			return nil, syntaxError("Unterminated character class")
+		}
+		if p.cur() == ']' {
+			p.pos++
+			break
+		}
+
+		from, fromClass, err := p.parseClassAtom()
+		if err != nil {
+			return nil, err
+		}
+		if p.cur() != '-' || p.peek(1) == ']' || p.peek(1) == -1 {
+			class.addAtom(from, fromClass)
+			continue
+		}
+
+		p.pos++
+		to, toClass, err := p.parseClassAtom()
+		if err != nil {
+			return nil, err
+		}
+		if fromClass != nil || toClass != nil {
+			if p.unicode {
+				return nil, syntaxError("Invalid character class")
+			}
+			// Annex B, `[\d-x]` is \d, '-' and 'x'
+			class.addAtom(from, fromClass)
+			class.addRange('-', '-')
+			class.addAtom(to, toClass)
+			continue
+		}
+		if from > to {
+			return nil, syntaxError("Range out of order in character class")
+		}
+		class.addRange(from, to)
+	}
+
+	class.normalize()
+	class.negate = negate
+	return class, nil
+}
+
+// parseClassAtom returns either a character or, for class escapes, a class
+func (p *syntaxParser) parseClassAtom() (rune, *charClass, error) {
+	c := p.cur()
+	if c != '\\' {
+		p.pos++
+		return c, nil, nil
+	}
+
+	p.pos++
+	if p.eof() {
+		return 0, nil, syntaxError("\\ at end of pattern")
+	}
+	c = p.cur()
+	switch {
+	case c == 'b':
+		p.pos++
+		return '\b', nil, nil
+	case c == '-' && p.unicode:
+		p.pos++
+		return '-', nil, nil
+	case c >= '0' && c <= '9' && !(c == '0' && (p.peek(1) < '0' || p.peek(1) > '9')):
+		if p.unicode {
+			return 0, nil, syntaxError("Invalid class escape")
+		}
+		if c >= '8' {
+			p.pos++
+			return c, nil, nil
+		}
+		return p.readLegacyOctal(), nil, nil
+	}
+
+	class, err := p.parseClassEscape()
+	if err != nil || class != nil {
+		return 0, class, err
+	}
+	ch, err := p.parseCharacterEscape(true)
+	return ch, nil, err
+}
+
+// parseClassSet parses a v-mode class with nested classes, set operations and
+// \q{...} strings, see ClassSetExpression
+func (p *syntaxParser) parseClassSet() (*charClass, error) {
+	if err := p.enterDepth(); err != nil {
+		return nil, err
+	}
+	defer p.exitDepth()
+
+	negate := false
+	if p.cur() == '^' {
+		negate = true
+		p.pos++
+	}
+
+	class, err := p.parseClassSetContents()
+	if err != nil {
+		return nil, err
+	}
+	if negate {
+		if len(class.strings) > 0 {
+			return nil, syntaxError("Negated character class may contain strings")
+		}
+		class.negate = true
+	}
+	return class, nil
+}
+
+func (p *syntaxParser) parseClassSetContents() (*charClass, error) {
+	if p.cur() == ']' {
+		p.pos++
+		return &charClass{}, nil
+	}
+
+	first, isRange, err := p.parseClassSetOperand(true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Operands can be shared classes like \d, the result is always a copy
+	result := (&charClass{}).union(first)
+	if !isRange && (p.lookingAt("&&") || p.lookingAt("--")) {
+		operator := p.cur()
+		for p.lookingAt(string([]rune{operator, operator})) {
+			p.pos += 2
+			if operator == '&' && p.cur() == '&' {
+				return nil, syntaxError("Invalid set operation in character class")
+			}
+			operand, _, err := p.parseClassSetOperand(false)
+			if err != nil {
+				return nil, err
+			}
+			if operator == '&' {
+				result = result.intersect(operand)
+			} else {
+				result = result.subtract(operand)
+			}
+		}
+		if p.cur() != ']' {
+			if p.eof() {
+				return nil, syntaxError("Unterminated character class")
+			}
+			return nil, syntaxError("Invalid set operation in character class")
+		}
+		p.pos++
+		return result, nil
+	}
+
+	for {
+		if p.eof() {
+			return nil, syntaxError("Unterminated character class")
+		}
+		if p.cur() == ']' {
+			p.pos++
+			break
+		}
+		if p.lookingAt("&&") || p.lookingAt("--") {
+			return nil, syntaxError("Invalid set operation in character class")
+		}
+		operand, _, err := p.parseClassSetOperand(true)
+		if err != nil {
+			return nil, err
+		}
+		result = result.union(operand)
+	}
+	return result, nil
+}
+
+// parseClassSetOperand reads a nested class, a class escape, \q{...}, a
+// character or, when allowRange is set, a range of characters
+func (p *syntaxParser) parseClassSetOperand(allowRange bool) (*charClass, bool, error) {
+	if p.eof() {
+		return nil, false, syntaxError("Unterminated character class")
+	}
+
+	if p.cur() == '[' {
+		p.pos++
+		class, err := p.parseClassSet()
+		if err != nil {
+			return nil, false, err
+		}
+		if class.negate {
+			class = class.complement()
+		}
+		return class, false, nil
+	}
+
+	if p.cur() == '\\' {
+		p.pos++
+		if p.eof() {
+			return nil, false, syntaxError("\\ at end of pattern")
+		}
+		if p.cur() == 'q' && p.peek(1) == '{' {
+			p.pos += 2
+			class, err := p.parseClassStrings()
+			return class, false, err
+		}
+		class, err := p.parseClassEscape()
+		if err != nil {
+			return nil, false, err
+		}
+		if class != nil {
+			if class.negate {
+				class = class.complement()
+			}
+			return class, false, nil
+		}
+		p.pos--
+	}
+
+	from, err := p.parseClassSetCharacter()
+	if err != nil {
+		return nil, false, err
+	}
+	if !allowRange || p.cur() != '-' || p.peek(1) == '-' {
+		class := &charClass{}
+		class.addRange(from, from)
+		return class, false, nil
+	}
+
+	p.pos++
+	to, err := p.parseClassSetCharacter()
+	if err != nil {
+		return nil, false, err
+	}
+	if from > to {
+		return nil, false, syntaxError("Range out of order in character class")
+	}
+	class := &charClass{}
+	class.addRange(from, to)
+	return class, true, nil
+}
+
+func (p *syntaxParser) parseClassSetCharacter() (rune, error) {
+	if p.eof() {
+		return 0, syntaxError("Unterminated character class")
+	}
+	c := p.cur()
+	if c == '\\' {
+		p.pos++
+		if p.eof() {
+			return 0, syntaxError("\\ at end of pattern")
+		}
+		if p.cur() == 'b' {
+			p.pos++
+			return '\b', nil
+		}
+		return p.parseCharacterEscape(true)
+	}
+
+	switch c {
+	case '(', ')', '[', ']', '{', '}', '/', '-', '|':
+		return 0, syntaxError("Invalid character in character class")
+	}
+	if isClassSetReservedDoublePunctuator(c) && p.peek(1) == c {
+		return 0, syntaxError("Invalid set operation in character class")
+	}
+	p.pos++
+	return c, nil
+}
+
+// parseClassStrings reads the alternatives of \q{...}
+func (p *syntaxParser) parseClassStrings() (*charClass, error) {
+	class := &charClass{}
+	current := []rune{}
+	for {
+		if p.eof() {
+			return nil, syntaxError("Unterminated character class")
+		}
+		c := p.cur()
+		if c == '}' || c == '|' {
+			p.pos++
+			class.addString(current)
+			current = []rune{}
+			if c == '}' {
+				break
+			}
+			continue
+		}
+		ch, err := p.parseClassSetCharacter()
+		if err != nil {
+			return nil, err
+		}
+		current = append(current, ch)
+	}
+	class.normalize()
+	return class, nil
+}
+
+func isClassSetReservedDoublePunctuator(c rune) bool {
+	switch c {
+	case '&', '!', '#', '$', '%', '*', '+', ',', '.', ':', ';', '<', '=', '>', '?', '@', '^', '`', '~':
+		return true
+	}
+	return false
+}
+
+func isClassSetReservedPunctuator(c rune) bool {
+	switch c {
+	case '&', '-', '!', '#', '%', ',', ':', ';', '<', '=', '>', '@', '`', '~':
+		return true
+	}
+	return false
+}
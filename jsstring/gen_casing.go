@@ -0,0 +1,116 @@
+//go:build ignore
+
+// gen_casing writes casing_tables.go, the full case mappings that
+// toUpperCase and toLowerCase need on top of the unicode package, from the
+// SpecialCasing.txt of the Unicode character database:
+//
+//	go run gen_casing.go path/to/SpecialCasing.txt
+//
+// Only the unconditional mappings are kept, the language sensitive ones are
+// for toLocaleUpperCase and Final_Sigma is handled in code.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func parseCodePoints(field string) []rune {
+	seq := []rune{}
+	for _, s := range strings.Fields(field) {
+		cp, err := strconv.ParseUint(s, 16, 32)
+		if err != nil {
+			log.Fatal(err)
+		}
+		seq = append(seq, rune(cp))
+	}
+	return seq
+}
+
+func writeTable(b *bytes.Buffer, name string, table map[rune]string) {
+	codes := []rune{}
+	for code := range table {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+
+	fmt.Fprintf(b, "var %s = map[rune]string{\n", name)
+	for i, code := range codes {
+		if i%4 == 0 {
+			b.WriteString("\t")
+		}
+		fmt.Fprintf(b, "0x%04X: %s,", code, strconv.QuoteToASCII(table[code]))
+		if i%4 == 3 || i == len(codes)-1 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	b.WriteString("}\n\n")
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("Usage: go run gen_casing.go SpecialCasing.txt")
+	}
+	file, err := os.Open(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	version := ""
+	versionLine := regexp.MustCompile(`^# SpecialCasing-(\S+)\.txt`)
+	upper, lower := map[rune]string{}, map[rune]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := versionLine.FindStringSubmatch(line); match != nil {
+			version = match[1]
+		}
+		data, _, _ := strings.Cut(line, "#")
+		fields := strings.Split(data, ";")
+		// code; lower; title; upper; [conditions;]
+		if len(fields) < 5 || strings.TrimSpace(fields[4]) != "" {
+			continue
+		}
+		code := parseCodePoints(fields[0])[0]
+
+		// Entries that only exist for the titlecase mapping repeat the
+		// simple mappings
+		if s := string(parseCodePoints(fields[1])); s != string(unicode.ToLower(code)) {
+			lower[code] = s
+		}
+		if s := string(parseCodePoints(fields[3])); s != string(unicode.ToUpper(code)) {
+			upper[code] = s
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by gen_casing.go from SpecialCasing-%s.txt. DO NOT EDIT.\n\n", version)
+	b.WriteString("package jsstring\n\n")
+	b.WriteString("// The unconditional mappings of SpecialCasing.txt that differ from the\n")
+	b.WriteString("// simple case mappings of the unicode package\n")
+	writeTable(&b, "upperSpecialCasing", upper)
+	writeTable(&b, "lowerSpecialCasing", lower)
+
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("casing_tables.go", source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,419 @@
+package jsstring
+
+import (
+	"slices"
+	"unicode"
+
+	"go_js/jsregexp"
+)
+
+// STRING.PROTOTYPE
+//
+// The String.prototype methods from ecma-262 22.1.3, on arguments the
+// caller already converted. Positions are the result of
+// ToIntegerOrInfinity, clamped to the int range; the methods take care of
+// clamping them to the string.
+
+func clamp(pos, length int) int {
+	return min(max(pos, 0), length)
+}
+
+// relative resolves a relative index like slice and at do, negative
+// positions count from the end
+func relative(pos, length int) int {
+	if pos < 0 {
+		return max(length+pos, 0)
+	}
+	return min(pos, length)
+}
+
+// At is String.prototype.at
+func (s String) At(index int) (String, bool) {
+	if index < 0 {
+		index += s.Len()
+	}
+	if index < 0 || index >= s.Len() {
+		return String{}, false
+	}
+	return s.slice(index, index+1), true
+}
+
+// CharAt is String.prototype.charAt, out of range positions give the empty
+// string
+func (s String) CharAt(pos int) String {
+	if pos < 0 || pos >= s.Len() {
+		return String{}
+	}
+	return s.slice(pos, pos+1)
+}
+
+// CharCodeAt is String.prototype.charCodeAt, out of range positions report
+// false where JS returns NaN
+func (s String) CharCodeAt(pos int) (uint16, bool) {
+	if pos < 0 || pos >= s.Len() {
+		return 0, false
+	}
+	return s.Unit(pos), true
+}
+
+// CodePointAt is String.prototype.codePointAt, out of range positions report
+// false where JS returns undefined
+func (s String) CodePointAt(pos int) (rune, bool) {
+	if pos < 0 || pos >= s.Len() {
+		return 0, false
+	}
+	code, _ := s.codePoint(pos)
+	return code, true
+}
+
+// Concat is String.prototype.concat
+func (s String) Concat(others ...String) String {
+	var b Builder
+	b.Append(s)
+	for _, other := range others {
+		b.Append(other)
+	}
+	return b.String()
+}
+
+func (s String) hasAt(search String, pos int) bool {
+	if pos < 0 || pos+search.Len() > s.Len() {
+		return false
+	}
+	if s.wide == search.wide {
+		if !s.wide {
+			return s.data[pos:pos+search.Len()] == search.data
+		}
+		return s.data[2*pos:2*(pos+search.Len())] == search.data
+	}
+	for i := 0; i < search.Len(); i++ {
+		if s.Unit(pos+i) != search.Unit(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// IndexOf is String.prototype.indexOf, it returns -1 when search isn't found
+func (s String) IndexOf(search String, position int) int {
+	for i := clamp(position, s.Len()); i+search.Len() <= s.Len(); i++ {
+		if s.hasAt(search, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// LastIndexOf is String.prototype.lastIndexOf, position is the length of
+// the string when JS gets NaN
+func (s String) LastIndexOf(search String, position int) int {
+	for i := min(clamp(position, s.Len()), s.Len()-search.Len()); i >= 0; i-- {
+		if s.hasAt(search, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Includes is String.prototype.includes
+func (s String) Includes(search String, position int) bool {
+	return s.IndexOf(search, position) >= 0
+}
+
+// StartsWith is String.prototype.startsWith
+func (s String) StartsWith(search String, position int) bool {
+	return s.hasAt(search, clamp(position, s.Len()))
+}
+
+// EndsWith is String.prototype.endsWith, endPosition is the length of the
+// string when JS gets undefined
+func (s String) EndsWith(search String, endPosition int) bool {
+	return s.hasAt(search, clamp(endPosition, s.Len())-search.Len())
+}
+
+// Slice is String.prototype.slice, negative positions count from the end
+func (s String) Slice(start, end int) String {
+	from, to := relative(start, s.Len()), relative(end, s.Len())
+	if from >= to {
+		return String{}
+	}
+	return s.slice(from, to)
+}
+
+// Substring is String.prototype.substring
+func (s String) Substring(start, end int) String {
+	from, to := clamp(start, s.Len()), clamp(end, s.Len())
+	return s.slice(min(from, to), max(from, to))
+}
+
+// Repeat is String.prototype.repeat, count must not be negative
+func (s String) Repeat(count int) String {
+	var b Builder
+	for i := 0; i < count; i++ {
+		b.Append(s)
+	}
+	return b.String()
+}
+
+// pad is StringPad from ecma-262 22.1.3.17.2
+func (s String) pad(maxLength int, fill String, atStart bool) String {
+	if maxLength <= s.Len() || fill.Len() == 0 {
+		return s
+	}
+	var b Builder
+	if !atStart {
+		b.Append(s)
+	}
+	for fillLen := maxLength - s.Len(); fillLen > 0; fillLen -= fill.Len() {
+		b.Append(fill.slice(0, min(fill.Len(), fillLen)))
+	}
+	if atStart {
+		b.Append(s)
+	}
+	return b.String()
+}
+
+// PadStart is String.prototype.padStart, fill is " " when JS gets undefined
+func (s String) PadStart(maxLength int, fill String) String {
+	return s.pad(maxLength, fill, true)
+}
+
+// PadEnd is String.prototype.padEnd, fill is " " when JS gets undefined
+func (s String) PadEnd(maxLength int, fill String) String {
+	return s.pad(maxLength, fill, false)
+}
+
+// IsWhiteSpace reports whether unit is WhiteSpace or a LineTerminator, the
+// code units trim removes
+func IsWhiteSpace(unit uint16) bool {
+	switch unit {
+	case '\t', '\n', '\v', '\f', '\r', ' ', 0xA0, 0x1680, 0x2028, 0x2029, 0x202F, 0x205F, 0x3000, 0xFEFF:
+		return true
+	}
+	return unit >= 0x2000 && unit <= 0x200A
+}
+
+// Trim is String.prototype.trim
+func (s String) Trim() String {
+	return s.TrimStart().TrimEnd()
+}
+
+// TrimStart is String.prototype.trimStart
+func (s String) TrimStart() String {
+	start := 0
+	for start < s.Len() && IsWhiteSpace(s.Unit(start)) {
+		start++
+	}
+	return s.slice(start, s.Len())
+}
+
+// TrimEnd is String.prototype.trimEnd
+func (s String) TrimEnd() String {
+	end := s.Len()
+	for end > 0 && IsWhiteSpace(s.Unit(end-1)) {
+		end--
+	}
+	return s.slice(0, end)
+}
+
+func (s String) mapCase(special map[rune]string, mapping func(rune) rune, finalSigma bool) String {
+	var b Builder
+	for i := 0; i < s.Len(); {
+		code, size := s.codePoint(i)
+		i += size
+		if code == 'Σ' && finalSigma && s.isFinalSigma(i-size, i) {
+			b.AppendCodePoint('ς')
+			continue
+		}
+		if replacement, found := special[code]; found {
+			b.AppendString(replacement)
+			continue
+		}
+		b.AppendCodePoint(mapping(code))
+	}
+	return b.String()
+}
+
+// ToUpperCase is String.prototype.toUpperCase, with the unconditional
+// mappings of the Unicode Default Case Conversion. Lone surrogates are kept.
+func (s String) ToUpperCase() String {
+	return s.mapCase(upperSpecialCasing, unicode.ToUpper, false)
+}
+
+// ToLowerCase is String.prototype.toLowerCase, with the unconditional
+// mappings and the Final_Sigma rule of the Unicode Default Case Conversion
+func (s String) ToLowerCase() String {
+	return s.mapCase(lowerSpecialCasing, unicode.ToLower, true)
+}
+
+// Word_Break=MidLetter, MidNumLet and Single_Quote, which are
+// Case_Ignorable without being marks, formats or modifiers
+var caseIgnorablePunctuation = []rune{'\'', '.', ':', 0xB7, 0x387, 0x55F, 0x5F4, 0x2018, 0x2019, 0x2024, 0x2027, 0xFE13, 0xFE52, 0xFE55, 0xFF07, 0xFF0E, 0xFF1A}
+
+func isCased(code rune) bool {
+	return unicode.In(code, unicode.Lower, unicode.Upper, unicode.Lt, unicode.Other_Lowercase, unicode.Other_Uppercase)
+}
+
+func isCaseIgnorable(code rune) bool {
+	return unicode.In(code, unicode.Mn, unicode.Me, unicode.Cf, unicode.Lm, unicode.Sk) || slices.Contains(caseIgnorablePunctuation, code)
+}
+
+// isFinalSigma is the Final_Sigma condition of the Unicode standard, table
+// 3-17, for the sigma from start to end: a cased letter comes before it and
+// none after it, skipping case ignorable characters
+func (s String) isFinalSigma(start, end int) bool {
+	before := false
+	for i := start; i > 0; {
+		code, size := s.codePointBefore(i)
+		i -= size
+		if !isCaseIgnorable(code) {
+			before = isCased(code)
+			break
+		}
+	}
+	if !before {
+		return false
+	}
+	for i := end; i < s.Len(); {
+		code, size := s.codePoint(i)
+		i += size
+		if !isCaseIgnorable(code) {
+			return !isCased(code)
+		}
+	}
+	return true
+}
+
+// IsWellFormed is String.prototype.isWellFormed, it reports whether s has
+// no lone surrogates
+func (s String) IsWellFormed() bool {
+	if !s.wide {
+		return true
+	}
+	for i := 0; i < s.Len(); {
+		code, size := s.codePoint(i)
+		if isSurrogate(code) {
+			return false
+		}
+		i += size
+	}
+	return true
+}
+
+// ToWellFormed is String.prototype.toWellFormed, lone surrogates are
+// replaced with U+FFFD
+func (s String) ToWellFormed() String {
+	if s.IsWellFormed() {
+		return s
+	}
+	var b Builder
+	for i := 0; i < s.Len(); {
+		code, size := s.codePoint(i)
+		if isSurrogate(code) {
+			code = 0xFFFD
+		}
+		b.AppendCodePoint(code)
+		i += size
+	}
+	return b.String()
+}
+
+// Split is String.prototype.split with a string separator. limit is
+// ToUint32 of the limit argument, math.MaxUint32 when it's undefined.
+func (s String) Split(separator String, limit uint32) []String {
+	parts := []String{}
+	if limit == 0 {
+		return parts
+	}
+	if separator.Len() == 0 {
+		for i := 0; i < s.Len() && uint32(len(parts)) < limit; i++ {
+			parts = append(parts, s.slice(i, i+1))
+		}
+		return parts
+	}
+	if s.Len() == 0 {
+		return append(parts, s)
+	}
+
+	start := 0
+	for i := s.IndexOf(separator, 0); i >= 0; i = s.IndexOf(separator, start) {
+		parts = append(parts, s.slice(start, i))
+		if uint32(len(parts)) == limit {
+			return parts
+		}
+		start = i + separator.Len()
+	}
+	return append(parts, s.slice(start, s.Len()))
+}
+
+// Replace is String.prototype.replace with a string pattern, only the
+// first occurrence is replaced. The $ patterns of the replacement are
+// expanded by GetSubstitution.
+func (s String) Replace(search, replacement String) String {
+	return s.ReplaceFunc(search, func(position int) String {
+		return s.substitution(search, position, replacement)
+	})
+}
+
+// ReplaceFunc is String.prototype.replace with a replacer function, it's
+// called with the position of the match
+func (s String) ReplaceFunc(search String, replacer func(position int) String) String {
+	position := s.IndexOf(search, 0)
+	if position < 0 {
+		return s
+	}
+	return s.slice(0, position).Concat(replacer(position), s.slice(position+search.Len(), s.Len()))
+}
+
+// ReplaceAll is String.prototype.replaceAll with a string pattern
+func (s String) ReplaceAll(search, replacement String) String {
+	return s.ReplaceAllFunc(search, func(position int) String {
+		return s.substitution(search, position, replacement)
+	})
+}
+
+// ReplaceAllFunc is String.prototype.replaceAll with a replacer function
+func (s String) ReplaceAllFunc(search String, replacer func(position int) String) String {
+	advanceBy := max(1, search.Len())
+	positions := []int{}
+	for position := s.IndexOf(search, 0); position >= 0; position = s.IndexOf(search, position+advanceBy) {
+		positions = append(positions, position)
+		if position+advanceBy > s.Len() {
+			break
+		}
+	}
+
+	var b Builder
+	endOfLastMatch := 0
+	for _, position := range positions {
+		b.Append(s.slice(endOfLastMatch, position))
+		b.Append(replacer(position))
+		endOfLastMatch = position + search.Len()
+	}
+	b.Append(s.slice(endOfLastMatch, s.Len()))
+	return b.String()
+}
+
+func (s String) substitution(search String, position int, replacement String) String {
+	return FromUTF16(jsregexp.GetSubstitution(search.UTF16(), s.UTF16(), position, nil, nil, replacement.UTF16()))
+}
+
+// Compare orders strings by their code units like IsLessThan does, it
+// returns -1, 0 or 1
+func Compare(a, b String) int {
+	for i := 0; i < min(a.Len(), b.Len()); i++ {
+		if x, y := a.Unit(i), b.Unit(i); x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case a.Len() < b.Len():
+		return -1
+	case a.Len() > b.Len():
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,366 @@
+package jsstring
+
+import (
+	"encoding/json"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// String is an ECMAScript String value, a sequence of UTF-16 code units
+// that may contain lone surrogates. Strings where every code unit fits in a
+// byte (ASCII and Latin-1, most of them in practice) are stored one byte per
+// unit, other strings two bytes per unit in little endian order.
+//
+// The representation is canonical, a string is only wide when it has a code
+// unit above 0xFF, so Strings can be compared with == and used as map keys.
+// The zero value is the empty string.
+type String struct {
+	data string
+	wide bool
+}
+
+// New converts a Go string to a String. Invalid UTF-8 is decoded to U+FFFD.
+func New(s string) String {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			var b Builder
+			b.AppendString(s)
+			return b.String()
+		}
+	}
+	return String{data: s}
+}
+
+// FromUTF16 creates a String from UTF-16 code units, surrogates don't have
+// to be paired
+func FromUTF16(units []uint16) String {
+	var b Builder
+	for _, unit := range units {
+		b.AppendUnit(unit)
+	}
+	return b.String()
+}
+
+// FromCodePoint is String.fromCodePoint for a single code point
+func FromCodePoint(code rune) String {
+	var b Builder
+	b.AppendCodePoint(code)
+	return b.String()
+}
+
+// Len is the length property, the number of code units
+func (s String) Len() int {
+	if s.wide {
+		return len(s.data) / 2
+	}
+	return len(s.data)
+}
+
+// Unit returns the code unit at index i, which must be in range
+func (s String) Unit(i int) uint16 {
+	if s.wide {
+		return uint16(s.data[2*i]) | uint16(s.data[2*i+1])<<8
+	}
+	return uint16(s.data[i])
+}
+
+// IsLatin1 reports whether every code unit of s is below 0x100
+func (s String) IsLatin1() bool {
+	return !s.wide
+}
+
+// codePoint is CodePointAt from ecma-262 7.1.4.1, it returns the code point
+// at index i and the number of code units it takes
+func (s String) codePoint(i int) (rune, int) {
+	first := s.Unit(i)
+	if !isLeadingSurrogate(first) || i+1 == s.Len() {
+		return rune(first), 1
+	}
+	second := s.Unit(i + 1)
+	if !isTrailingSurrogate(second) {
+		return rune(first), 1
+	}
+	return utf16.DecodeRune(rune(first), rune(second)), 2
+}
+
+// codePointBefore returns the code point that ends at index i and the
+// number of code units it takes
+func (s String) codePointBefore(i int) (rune, int) {
+	last := s.Unit(i - 1)
+	if !isTrailingSurrogate(last) || i == 1 {
+		return rune(last), 1
+	}
+	first := s.Unit(i - 2)
+	if !isLeadingSurrogate(first) {
+		return rune(last), 1
+	}
+	return utf16.DecodeRune(rune(first), rune(last)), 2
+}
+
+// slice returns the code units from start up to end, both must be in range
+func (s String) slice(start, end int) String {
+	if !s.wide {
+		return String{data: s.data[start:end]}
+	}
+	for i := start; i < end; i++ {
+		if s.Unit(i) > 0xFF {
+			return String{data: s.data[2*start : 2*end], wide: true}
+		}
+	}
+	narrow := make([]byte, end-start)
+	for i := range narrow {
+		narrow[i] = byte(s.Unit(start + i))
+	}
+	return String{data: string(narrow)}
+}
+
+// UTF16 returns the code units of s
+func (s String) UTF16() []uint16 {
+	units := make([]uint16, s.Len())
+	for i := range units {
+		units[i] = s.Unit(i)
+	}
+	return units
+}
+
+// String converts s to UTF-8, lone surrogates become U+FFFD
+func (s String) String() string {
+	if !s.wide {
+		for i := 0; i < len(s.data); i++ {
+			if s.data[i] >= utf8.RuneSelf {
+				return string(s.appendUTF8(make([]byte, 0, len(s.data)+8)))
+			}
+		}
+		return s.data
+	}
+	return string(s.appendUTF8(make([]byte, 0, len(s.data))))
+}
+
+func (s String) appendUTF8(b []byte) []byte {
+	for i := 0; i < s.Len(); {
+		code, size := s.codePoint(i)
+		if isSurrogate(code) {
+			code = utf8.RuneError
+		}
+		b = utf8.AppendRune(b, code)
+		i += size
+	}
+	return b
+}
+
+// GoString shows the code units of s, escaping lone surrogates so they
+// don't get lost when printing
+func (s String) GoString() string {
+	if s.IsWellFormed() {
+		return strconv.Quote(s.String())
+	}
+	b := []byte{'"'}
+	for i := 0; i < s.Len(); {
+		code, size := s.codePoint(i)
+		if isSurrogate(code) {
+			b = append(b, `\u`...)
+			b = append(b, hexDigits(uint16(code))...)
+		} else {
+			quoted := strconv.QuoteRune(code)
+			b = append(b, quoted[1:len(quoted)-1]...)
+		}
+		i += size
+	}
+	return string(append(b, '"'))
+}
+
+// MarshalJSON encodes s as a JSON string the way JSON.stringify does, see
+// QuoteJSONString in ecma-262 25.5.2.3. Lone surrogates are written as \u
+// escapes. json.Marshal still escapes <, > and & on top of this, use an
+// Encoder with SetEscapeHTML(false) to get the exact output.
+func (s String) MarshalJSON() ([]byte, error) {
+	b := []byte{'"'}
+	for i := 0; i < s.Len(); {
+		code, size := s.codePoint(i)
+		i += size
+		switch {
+		case code == '\b':
+			b = append(b, `\b`...)
+		case code == '\t':
+			b = append(b, `\t`...)
+		case code == '\n':
+			b = append(b, `\n`...)
+		case code == '\f':
+			b = append(b, `\f`...)
+		case code == '\r':
+			b = append(b, `\r`...)
+		case code == '"' || code == '\\':
+			b = append(b, '\\', byte(code))
+		case code < 0x20 || isSurrogate(code):
+			b = append(b, `\u`...)
+			b = append(b, hexDigits(uint16(code))...)
+		default:
+			b = utf8.AppendRune(b, code)
+		}
+	}
+	return append(b, '"'), nil
+}
+
+// UnmarshalJSON decodes a JSON string, keeping lone surrogates written as
+// \u escapes
+func (s *String) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if !hasSurrogateEscape(data) {
+		*s = New(raw)
+		return nil
+	}
+
+	var b Builder
+	for i := 1; i < len(data)-1; i++ {
+		c := data[i]
+		if c != '\\' {
+			r, size := utf8.DecodeRune(data[i:])
+			b.AppendCodePoint(r)
+			i += size - 1
+			continue
+		}
+		i++
+		switch data[i] {
+		case 'u':
+			unit, _ := strconv.ParseUint(string(data[i+1:i+5]), 16, 16)
+			b.AppendUnit(uint16(unit))
+			i += 4
+		case 'b':
+			b.AppendUnit('\b')
+		case 'f':
+			b.AppendUnit('\f')
+		case 'n':
+			b.AppendUnit('\n')
+		case 'r':
+			b.AppendUnit('\r')
+		case 't':
+			b.AppendUnit('\t')
+		default:
+			b.AppendUnit(uint16(data[i]))
+		}
+	}
+	*s = b.String()
+	return nil
+}
+
+func hasSurrogateEscape(data []byte) bool {
+	for i := 0; i+5 < len(data); i++ {
+		if data[i] == '\\' {
+			if data[i+1] == 'u' && (data[i+2] == 'd' || data[i+2] == 'D') && data[i+3] >= '8' {
+				return true
+			}
+			i++
+		}
+	}
+	return false
+}
+
+func hexDigits(unit uint16) string {
+	const digits = "0123456789abcdef"
+	return string([]byte{digits[unit>>12], digits[unit>>8&0xF], digits[unit>>4&0xF], digits[unit&0xF]})
+}
+
+func isSurrogate(code rune) bool {
+	return code >= 0xD800 && code <= 0xDFFF
+}
+
+func isLeadingSurrogate(unit uint16) bool {
+	return unit >= 0xD800 && unit <= 0xDBFF
+}
+
+func isTrailingSurrogate(unit uint16) bool {
+	return unit >= 0xDC00 && unit <= 0xDFFF
+}
+
+// Builder builds a String one piece at a time, it stays narrow until a code
+// unit above 0xFF is appended. The zero value is ready to use.
+type Builder struct {
+	narrow []byte
+	units  []uint16
+	wide   bool
+}
+
+// AppendUnit appends a single code unit
+func (b *Builder) AppendUnit(unit uint16) {
+	if b.wide {
+		b.units = append(b.units, unit)
+		return
+	}
+	if unit <= 0xFF {
+		b.narrow = append(b.narrow, byte(unit))
+		return
+	}
+	b.widen()
+	b.units = append(b.units, unit)
+}
+
+func (b *Builder) widen() {
+	b.units = make([]uint16, len(b.narrow), 2*len(b.narrow)+8)
+	for i, c := range b.narrow {
+		b.units[i] = uint16(c)
+	}
+	b.narrow = nil
+	b.wide = true
+}
+
+// AppendCodePoint appends code as UTF16EncodeCodePoint does, code points
+// up to 0xFFFF take a single code unit, surrogates included
+func (b *Builder) AppendCodePoint(code rune) {
+	if code <= 0xFFFF {
+		b.AppendUnit(uint16(code))
+		return
+	}
+	first, second := utf16.EncodeRune(code)
+	b.AppendUnit(uint16(first))
+	b.AppendUnit(uint16(second))
+}
+
+// AppendString appends a Go string, invalid UTF-8 is decoded to U+FFFD
+func (b *Builder) AppendString(s string) {
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			b.AppendUnit(uint16(c))
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		b.AppendCodePoint(r)
+		i += size
+	}
+}
+
+// Append appends the code units of s
+func (b *Builder) Append(s String) {
+	if !s.wide && !b.wide {
+		b.narrow = append(b.narrow, s.data...)
+		return
+	}
+	for i := 0; i < s.Len(); i++ {
+		b.AppendUnit(s.Unit(i))
+	}
+}
+
+// Len is the number of code units appended so far
+func (b *Builder) Len() int {
+	if b.wide {
+		return len(b.units)
+	}
+	return len(b.narrow)
+}
+
+// String returns the String built so far
+func (b *Builder) String() String {
+	if !b.wide {
+		return String{data: string(b.narrow)}
+	}
+	data := make([]byte, 2*len(b.units))
+	for i, unit := range b.units {
+		data[2*i] = byte(unit)
+		data[2*i+1] = byte(unit >> 8)
+	}
+	return String{data: string(data), wide: true}
+}
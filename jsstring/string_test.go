@@ -0,0 +1,151 @@
+package jsstring
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRepresentation(t *testing.T) {
+	if s := New("😀"); s.Len() != 2 || s.Unit(0) != 0xD83D || s.Unit(1) != 0xDE00 || s.IsLatin1() {
+		t.Errorf("Expected a surrogate pair, got %#v", s)
+	}
+	if s := New("café"); s.Len() != 4 || !s.IsLatin1() || s.String() != "café" {
+		t.Errorf("Expected a Latin-1 string, got %#v", s)
+	}
+	if New("€a").Slice(1, 2) != New("a") {
+		t.Error("Expected a slice of a wide string to be narrowed")
+	}
+	if FromUTF16([]uint16{'a', 0x20AC}) != New("a€") {
+		t.Error("Expected equal strings to compare equal")
+	}
+
+	lone := FromUTF16([]uint16{'a', 0xD800})
+	if lone.Len() != 2 || lone.IsWellFormed() || lone.String() != "a�" {
+		t.Errorf("Unexpected lone surrogate string %#v", lone)
+	}
+	if lone.ToWellFormed() != New("a�") {
+		t.Error("Expected toWellFormed to replace the lone surrogate")
+	}
+	if lone.Concat(FromCodePoint(0xDC00)) != New("a\U00010000") {
+		t.Error("Expected concatenated surrogates to form a pair")
+	}
+
+	var b Builder
+	b.AppendString("x")
+	b.AppendCodePoint(0x1F600)
+	b.AppendUnit(0xDBFF)
+	if got := b.String().UTF16(); !reflect.DeepEqual(got, []uint16{'x', 0xD83D, 0xDE00, 0xDBFF}) {
+		t.Errorf("Unexpected code units %x", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := map[String]string{
+		New("a\"b"):                       `"a\"b"`,
+		New("😀"):                          `"😀"`,
+		FromUTF16([]uint16{0xD800}):       `"\ud800"`,
+		FromUTF16([]uint16{0xDE00, '\n'}): `"\ude00\n"`,
+		New("<&>\u2028\x01\x7f\b\\"):      "\"<&>\u2028\\u0001\x7f\\b\\\\\"",
+	}
+	for s, expected := range tests {
+		b, err := s.MarshalJSON()
+		if err != nil || string(b) != expected {
+			t.Errorf("Expected %s, got %s", expected, b)
+			continue
+		}
+		var decoded String
+		if err := json.Unmarshal(b, &decoded); err != nil || decoded != s {
+			t.Errorf("Expected %s to decode to %#v, got %#v", b, s, decoded)
+		}
+	}
+	if b, _ := json.Marshal([]String{FromUTF16([]uint16{'a', 0xD800})}); string(b) != `["a\ud800"]` {
+		t.Errorf("Expected json.Marshal to keep the lone surrogate, got %s", b)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	s := New("a😀bab")
+
+	if c, _ := s.At(-1); c != New("b") {
+		t.Errorf("Unexpected at(-1) %#v", c)
+	}
+	if _, ok := s.At(6); ok {
+		t.Error("Expected at(6) to be undefined")
+	}
+	if c, _ := s.CharCodeAt(1); c != 0xD83D {
+		t.Errorf("Unexpected charCodeAt(1) %x", c)
+	}
+	if c, _ := s.CodePointAt(1); c != 0x1F600 {
+		t.Errorf("Unexpected codePointAt(1) %x", c)
+	}
+	if c, _ := s.CodePointAt(2); c != 0xDE00 {
+		t.Errorf("Unexpected codePointAt(2) %x", c)
+	}
+	if s.IndexOf(New("b"), 0) != 3 || s.IndexOf(New("b"), 4) != 5 || s.LastIndexOf(New("a"), 6) != 4 || s.IndexOf(New(""), 9) != 6 {
+		t.Error("Unexpected indexOf results")
+	}
+	if !s.StartsWith(New("😀"), 1) || !s.EndsWith(New("a"), 5) || s.Includes(New("c"), 0) {
+		t.Error("Unexpected startsWith, endsWith or includes results")
+	}
+	if s.Slice(-2, 100) != New("ab") || s.Substring(4, 1) != New("😀b") || s.Slice(3, 1) != New("") {
+		t.Error("Unexpected slice or substring results")
+	}
+	if New("ab").Repeat(3) != New("ababab") || New("5").PadStart(3, New("0")) != New("005") || New("a").PadEnd(6, New("xy")) != New("axyxyx") {
+		t.Error("Unexpected repeat or pad results")
+	}
+	if New(" \u00a0\ufeff x \u2028\n").Trim() != New("x") {
+		t.Error("Unexpected trim result")
+	}
+	cases := []struct{ s, upper, lower string }{
+		{"straße ﬁ", "STRASSE FI", "straße ﬁ"},
+		{"İΣ", "İΣ", "i̇ς"},
+		{"ᾳ ᾀ ὒ ῷ ᾼ", "ΑΙ ἈΙ Υ̓̀ Ω͂Ι ΑΙ", "ᾳ ᾀ ὒ ῷ ᾳ"},
+		{"ΑΣ", "ΑΣ", "ας"},
+		{"ΑΣ.", "ΑΣ.", "ας."},
+		{"ΑΣ'Α", "ΑΣ'Α", "ασ'α"},
+		{"Σ", "Σ", "σ"},
+		{" Σ", " Σ", " σ"},
+		{"ΑΣ\u0301 Σ", "ΑΣ\u0301 Σ", "ας\u0301 σ"},
+		{"𐐀Σ", "𐐀Σ", "𐐨ς"},
+	}
+	for _, test := range cases {
+		if upper := New(test.s).ToUpperCase(); upper != New(test.upper) {
+			t.Errorf("Expected %q to upper case to %q, got %q", test.s, test.upper, upper)
+		}
+		if lower := New(test.s).ToLowerCase(); lower != New(test.lower) {
+			t.Errorf("Expected %q to lower case to %q, got %q", test.s, test.lower, lower)
+		}
+	}
+
+	split := func(s, separator string, limit uint32) []string {
+		parts := []string{}
+		for _, part := range New(s).Split(New(separator), limit) {
+			parts = append(parts, part.String())
+		}
+		return parts
+	}
+	if parts := split("a,b,,c", ",", 0xFFFFFFFF); !reflect.DeepEqual(parts, []string{"a", "b", "", "c"}) {
+		t.Errorf("Unexpected split %q", parts)
+	}
+	if parts := split("abc", "", 2); !reflect.DeepEqual(parts, []string{"a", "b"}) {
+		t.Errorf("Unexpected split %q", parts)
+	}
+	if parts := split("", ",", 0xFFFFFFFF); !reflect.DeepEqual(parts, []string{""}) {
+		t.Errorf("Unexpected split %q", parts)
+	}
+
+	if r := New("a-b-c").Replace(New("-"), New("[$&$`$']")); r != New("a[-ab-c]b-c") {
+		t.Errorf("Unexpected replace %#v", r)
+	}
+	if r := New("a-b-c").ReplaceAll(New("-"), New("$$")); r != New("a$b$c") {
+		t.Errorf("Unexpected replaceAll %#v", r)
+	}
+	if r := New("ab").ReplaceAll(New(""), New("_")); r != New("_a_b_") {
+		t.Errorf("Unexpected replaceAll %#v", r)
+	}
+
+	if Compare(New("a"), New("b")) != -1 || Compare(New("\uffff"), New("😀")) != 1 || Compare(New("ab"), New("a")) != 1 {
+		t.Error("Expected strings to be ordered by code units")
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"encoding/json"
 	"go_js/parser"
+	"go_js/sourcemap"
 	"log"
 	"os"
+	"path/filepath"
 )
 
 func main() {
@@ -19,8 +21,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	node, err := parser.GetAst(b, &parser.Options{SourceType: "module"}, 0)
+	node, err := parser.GetAst(b, &parser.Options{SourceType: "module", AllowHashBang: true}, 0)
 	if err != nil {
+		err = sourcemap.RemapError(err, os.DirFS(filepath.Dir(os.Args[1])), filepath.Base(os.Args[1]), b)
 		println("Error while parsing file")
 		log.Fatal(err)
 	}
@@ -0,0 +1,400 @@
+package module
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"go_js/parser"
+)
+
+// The function a CommonJS module body is wrapped in. The runtime compiles
+// Wrapper() and calls the result with the arguments named here.
+const (
+	COMMONJS_WRAPPER_HEAD = "(function (exports, require, module, __filename, __dirname) { "
+	COMMONJS_WRAPPER_TAIL = "\n});"
+)
+
+// CommonJSModule is the `module` object of a CommonJS module
+type CommonJSModule struct {
+	Path     string
+	Source   []byte
+	Ast      *parser.Node
+	Parent   *CommonJSModule
+	Children []*CommonJSModule
+
+	// Exports is module.exports. It starts as an empty map standing in for
+	// `{}`, the executor replaces it with the runtime's exports object before
+	// running the body so that cyclic requires see the partial exports.
+	Exports any
+	Loaded  bool
+
+	// ExportNames are the names found assigned to exports in the source, they
+	// become the named exports when the module is imported from an ES module.
+	// Reexports are specifiers whose exports are copied wholesale, as in
+	// `module.exports = require('./x')`.
+	ExportNames []string
+	Reexports   []string
+
+	started bool
+}
+
+// CommonJSExecutor runs CommonJS module bodies. require resolves specifiers
+// relative to m and returns the value of module.exports.
+type CommonJSExecutor interface {
+	ExecuteCommonJS(m *CommonJSModule, require func(specifier string) (any, error)) error
+}
+
+func (m *CommonJSModule) Filename() string {
+	return m.Path
+}
+
+func (m *CommonJSModule) Dirname() string {
+	return path.Dir(m.Path)
+}
+
+// Wrapper returns the source of m wrapped in the CommonJS module function.
+// The head is on the first line, so line numbers match the file.
+func (m *CommonJSModule) Wrapper() []byte {
+	wrapped := make([]byte, 0, len(COMMONJS_WRAPPER_HEAD)+len(m.Source)+len(COMMONJS_WRAPPER_TAIL))
+	wrapped = append(wrapped, COMMONJS_WRAPPER_HEAD...)
+	wrapped = append(wrapped, m.Source...)
+	return append(wrapped, COMMONJS_WRAPPER_TAIL...)
+}
+
+// Require is the host side of `require()`. parent is the requiring module, nil
+// for the entry point. Modules are cached by path: requiring a module again
+// returns the same exports, and requiring one that is still running, in a
+// cycle, returns what it has exported so far. ES modules without top-level
+// await can be required when exec also implements Executor, the result is
+// their namespace.
+func (l *Loader) Require(specifier string, parent *CommonJSModule, exec CommonJSExecutor) (any, error) {
+	referrer := ""
+	if parent != nil {
+		referrer = parent.Path
+	}
+	resolver := l.RequireResolver
+	if resolver == nil {
+		resolver = l.Resolver
+	}
+	resolved, err := resolver.Resolve(specifier, referrer)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l.format(resolved) {
+	case FORMAT_MODULE:
+		return l.requireModule(resolved, exec)
+	case FORMAT_JSON:
+		return l.requireJSON(resolved, parent)
+	}
+
+	m, err := l.commonJS(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil && !m.started {
+		m.Parent = parent
+		parent.Children = append(parent.Children, m)
+	}
+	return l.executeCommonJS(m, exec)
+}
+
+// format returns the format of the file at name. Without a Format func only
+// .cjs files are CommonJS, the loader treats everything else as ES modules.
+func (l *Loader) format(name string) string {
+	if l.Format != nil {
+		return l.Format(name)
+	}
+	switch path.Ext(name) {
+	case ".cjs":
+		return FORMAT_COMMONJS
+	case ".json":
+		return FORMAT_JSON
+	}
+	return FORMAT_MODULE
+}
+
+// commonJS returns the record of the CommonJS module at name, parsing it the
+// first time. The body isn't run.
+func (l *Loader) commonJS(name string) (*CommonJSModule, error) {
+	if m, found := l.commonJSModules[name]; found {
+		return m, nil
+	}
+
+	source, err := l.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ast, err := l.parse(name, source, &parser.Options{AllowReturnOutsideFunction: true, AllowHashBang: true})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &CommonJSModule{Path: name, Source: source, Ast: ast, Exports: map[string]any{}}
+	m.ExportNames, m.Reexports = commonJSExports(ast)
+	l.commonJSModules[name] = m
+	return m, nil
+}
+
+func (l *Loader) executeCommonJS(m *CommonJSModule, exec CommonJSExecutor) (any, error) {
+	if m.started {
+		return m.Exports, nil
+	}
+
+	m.started = true
+	err := exec.ExecuteCommonJS(m, func(specifier string) (any, error) {
+		return l.Require(specifier, m, exec)
+	})
+	if err != nil {
+		// Like Node, a module that threw is dropped so requiring it again
+		// runs it again
+		m.started = false
+		m.Exports = map[string]any{}
+		return nil, err
+	}
+	m.Loaded = true
+	return m.Exports, nil
+}
+
+func (l *Loader) requireJSON(name string, parent *CommonJSModule) (any, error) {
+	if m, found := l.commonJSModules[name]; found {
+		return m.Exports, nil
+	}
+
+	source, err := l.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	value, err := ParseJSON(source)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load json module '%s': %w", name, err)
+	}
+	m := &CommonJSModule{Path: name, Source: source, Parent: parent, Exports: value, Loaded: true, started: true}
+	if parent != nil {
+		parent.Children = append(parent.Children, m)
+	}
+	l.commonJSModules[name] = m
+	return value, nil
+}
+
+// requireModule loads and runs an ES module graph synchronously for require(),
+// which is only possible when nothing in it uses top-level await
+func (l *Loader) requireModule(name string, exec CommonJSExecutor) (any, error) {
+	esmExec, ok := exec.(Executor)
+	if !ok {
+		return nil, fmt.Errorf("require() of ES module '%s' is not supported", name)
+	}
+
+	m, err := l.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Link()
+	if err != nil {
+		return nil, err
+	}
+	if m.hasAsyncGraph(map[*Module]bool{}) {
+		return nil, fmt.Errorf("require() cannot be used on ES module '%s' because it uses top-level await", name)
+	}
+
+	p := m.Evaluate(esmExec)
+	if p.Err() != nil {
+		return nil, p.Err()
+	}
+	return m.GetNamespace(), nil
+}
+
+func (m *Module) hasAsyncGraph(visited map[*Module]bool) bool {
+	if visited[m] || m.Status == STATUS_EVALUATED {
+		return false
+	}
+	visited[m] = true
+	if m.HasTLA {
+		return true
+	}
+	for _, request := range m.RequestedModules {
+		if m.getImportedModule(request).hasAsyncGraph(visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCommonJSFacade creates the ES module that stands for a CommonJS module
+// when it is imported. Following Node, its default export is module.exports
+// and the names found by commonJSExports are provided as named exports, read
+// from module.exports once the body has run.
+func (l *Loader) newCommonJSFacade(cjs *CommonJSModule) *Module {
+	m := newSyntheticModule(cjs.Path, MODULE_TYPE_COMMONJS, cjs.Source, nil)
+	m.commonJS = cjs
+	for _, name := range l.commonJSExportNames(cjs, map[*CommonJSModule]bool{}) {
+		m.LocalExportEntries = append(m.LocalExportEntries, &ExportEntry{ExportName: name, LocalName: name})
+	}
+	return m
+}
+
+// commonJSExportNames collects the export names of cjs and of the modules it
+// reexports. Reexports that can't be resolved are skipped, their names are
+// still reachable through the default export.
+func (l *Loader) commonJSExportNames(cjs *CommonJSModule, visited map[*CommonJSModule]bool) []string {
+	if visited[cjs] {
+		return nil
+	}
+	visited[cjs] = true
+
+	resolver := l.RequireResolver
+	if resolver == nil {
+		resolver = l.Resolver
+	}
+
+	seen := map[string]bool{"default": true}
+	names := []string{}
+	add := func(list []string) {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	add(cjs.ExportNames)
+	for _, specifier := range cjs.Reexports {
+		resolved, err := resolver.Resolve(specifier, cjs.Path)
+		if err != nil || l.format(resolved) != FORMAT_COMMONJS {
+			continue
+		}
+		reexported, err := l.commonJS(resolved)
+		if err != nil {
+			continue
+		}
+		add(l.commonJSExportNames(reexported, visited))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// evaluateCommonJS runs the CommonJS module behind a facade
+func (l *Loader) evaluateCommonJS(m *Module, exec Executor) error {
+	cjsExec, ok := exec.(CommonJSExecutor)
+	if !ok {
+		return fmt.Errorf("Cannot import CommonJS module '%s', the executor doesn't run CommonJS", m.Path)
+	}
+	exports, err := l.executeCommonJS(m.commonJS, cjsExec)
+	if err != nil {
+		return err
+	}
+	m.Value = exports
+	return nil
+}
+
+// commonJSExports finds the names a CommonJS module exports by looking at how
+// it assigns to exports, the way Node's cjs-module-lexer does. It recognizes
+// `exports.a = `, `module.exports.a = `, `Object.defineProperty(exports, 'a'`,
+// `module.exports = { a, b: c }` and reexports through
+// `module.exports = require('x')` or `...require('x')`.
+func commonJSExports(ast *parser.Node) (names []string, reexports []string) {
+	seen := map[string]bool{}
+	addName := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	var walk func(node *parser.Node)
+	walk = func(node *parser.Node) {
+		if node == nil {
+			return
+		}
+
+		switch node.Type {
+		case parser.NODE_ASSIGNMENT_EXPRESSION:
+			if node.AssignmentOperator != parser.ASSIGN || node.Left == nil || node.Left.Type != parser.NODE_MEMBER_EXPRESSION {
+				break
+			}
+			if isExportsObject(node.Left.Object) {
+				addName(memberName(node.Left))
+			} else if isModuleExports(node.Left) {
+				if specifier, ok := requireCall(node.Right); ok {
+					reexports = append(reexports, specifier)
+				} else if node.Right != nil && node.Right.Type == parser.NODE_OBJECT_EXPRESSION {
+					for _, prop := range node.Right.Properties {
+						if prop.Type == parser.NODE_SPREAD_ELEMENT {
+							if specifier, ok := requireCall(prop.Argument); ok {
+								reexports = append(reexports, specifier)
+							}
+							continue
+						}
+						if !prop.Computed && prop.Key != nil {
+							addName(exportName(prop.Key))
+						}
+					}
+				}
+			}
+
+		case parser.NODE_CALL_EXPRESSION:
+			callee := node.Callee
+			if callee != nil && callee.Type == parser.NODE_MEMBER_EXPRESSION && !callee.Computed &&
+				callee.Object != nil && callee.Object.Type == parser.NODE_IDENTIFIER && callee.Object.Name == "Object" &&
+				memberName(callee) == "defineProperty" && len(node.Arguments) >= 2 &&
+				isExportsObject(node.Arguments[0]) && node.Arguments[1].Type == parser.NODE_LITERAL {
+				addName(stringValue(node.Arguments[1]))
+			}
+		}
+
+		for _, child := range children(node) {
+			walk(child)
+		}
+	}
+	walk(ast)
+	return names, reexports
+}
+
+func isExportsObject(node *parser.Node) bool {
+	if node == nil {
+		return false
+	}
+	if node.Type == parser.NODE_IDENTIFIER {
+		return node.Name == "exports"
+	}
+	return isModuleExports(node)
+}
+
+func isModuleExports(node *parser.Node) bool {
+	return node != nil && node.Type == parser.NODE_MEMBER_EXPRESSION &&
+		node.Object != nil && node.Object.Type == parser.NODE_IDENTIFIER && node.Object.Name == "module" &&
+		memberName(node) == "exports"
+}
+
+// memberName is the property name of a member expression, `a.b` or `a['b']`
+func memberName(node *parser.Node) string {
+	if node.Property == nil {
+		return ""
+	}
+	if !node.Computed {
+		if node.Property.Type == parser.NODE_IDENTIFIER {
+			return node.Property.Name
+		}
+		return ""
+	}
+	if node.Property.Type == parser.NODE_LITERAL {
+		return stringValue(node.Property)
+	}
+	return ""
+}
+
+func requireCall(node *parser.Node) (string, bool) {
+	if node == nil || node.Type != parser.NODE_CALL_EXPRESSION || len(node.Arguments) != 1 {
+		return "", false
+	}
+	if node.Callee == nil || node.Callee.Type != parser.NODE_IDENTIFIER || node.Callee.Name != "require" {
+		return "", false
+	}
+	arg := node.Arguments[0]
+	if arg.Type != parser.NODE_LITERAL {
+		return "", false
+	}
+	specifier := stringValue(arg)
+	return specifier, specifier != ""
+}
@@ -0,0 +1,304 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// asyncEvaluationOrder of a module whose async evaluation has finished
+const ASYNC_EVALUATION_DONE = -1
+
+// Executor runs module bodies, this is the part of evaluation that needs a
+// runtime. Modules without top-level await are run with Execute. Modules with
+// top-level await are started with ExecuteAsync, which must call done exactly
+// once, on the loader's goroutine, when the body settles.
+type Executor interface {
+	Execute(m *Module) error
+	ExecuteAsync(m *Module, done func(error))
+}
+
+// Promise stands in for the promise Evaluate returns until the runtime has
+// real ones. Callbacks registered with Then run once it settles.
+type Promise struct {
+	settled   bool
+	err       error
+	callbacks []func(error)
+}
+
+func (p *Promise) Settled() bool {
+	return p.settled
+}
+
+func (p *Promise) Err() error {
+	return p.err
+}
+
+func (p *Promise) Then(callback func(error)) {
+	if p.settled {
+		callback(p.err)
+		return
+	}
+	p.callbacks = append(p.callbacks, callback)
+}
+
+func (p *Promise) settle(err error) {
+	if p.settled {
+		return
+	}
+	p.settled = true
+	p.err = err
+	callbacks := p.callbacks
+	p.callbacks = nil
+	for _, callback := range callbacks {
+		callback(err)
+	}
+}
+
+// Evaluate runs the linked graph rooted at m, see ecma-262 16.2.1.5.3. The
+// returned promise settles once every module, including the ones waiting on
+// top-level await, has finished.
+func (m *Module) Evaluate(exec Executor) *Promise {
+	module := m
+	switch module.Status {
+	case STATUS_LINKED, STATUS_EVALUATING_ASYNC, STATUS_EVALUATED:
+	default:
+		p := &Promise{}
+		p.settle(fmt.Errorf("Module '%s' must be linked before it is evaluated", m.Path))
+		return p
+	}
+
+	if module.Status == STATUS_EVALUATING_ASYNC || module.Status == STATUS_EVALUATED {
+		// Modules that threw synchronously never get a cycle root, they
+		// only keep their error
+		if module.cycleRoot == nil {
+			p := &Promise{}
+			p.settle(module.EvaluationError)
+			return p
+		}
+		module = module.cycleRoot
+	}
+	if module.topLevelCapability != nil {
+		return module.topLevelCapability
+	}
+
+	l := module.loader
+	capability := &Promise{}
+	module.topLevelCapability = capability
+
+	// Completions of async modules are queued until the synchronous part of
+	// the evaluation is over, the same way promise jobs would be
+	nested := l.runningJobs
+	l.runningJobs = true
+	stack := []*Module{}
+	_, err := l.innerModuleEvaluation(exec, module, &stack, 0)
+	if err != nil {
+		for _, evaluating := range stack {
+			evaluating.Status = STATUS_EVALUATED
+			evaluating.EvaluationError = err
+		}
+		capability.settle(err)
+	} else if module.Status == STATUS_EVALUATED {
+		capability.settle(nil)
+	}
+	if !nested {
+		l.runJobs()
+	}
+
+	return capability
+}
+
+func (l *Loader) enqueueJob(job func()) {
+	l.jobs = append(l.jobs, job)
+	if !l.runningJobs {
+		l.runJobs()
+	}
+}
+
+func (l *Loader) runJobs() {
+	l.runningJobs = true
+	for len(l.jobs) > 0 {
+		job := l.jobs[0]
+		l.jobs = l.jobs[1:]
+		job()
+	}
+	l.runningJobs = false
+}
+
+func (l *Loader) innerModuleEvaluation(exec Executor, module *Module, stack *[]*Module, index int) (int, error) {
+	switch module.Status {
+	case STATUS_EVALUATING_ASYNC, STATUS_EVALUATED:
+		return index, module.EvaluationError
+	case STATUS_EVALUATING:
+		return index, nil
+	case STATUS_LINKED:
+	default:
+		return index, errors.New("Module '" + module.Path + "' must be linked before it is evaluated")
+	}
+
+	module.Status = STATUS_EVALUATING
+	module.dfsIndex = index
+	module.dfsAncestorIndex = index
+	module.pendingAsyncDependencies = 0
+	index++
+	*stack = append(*stack, module)
+
+	for _, request := range module.RequestedModules {
+		required := module.getImportedModule(request)
+
+		var err error
+		index, err = l.innerModuleEvaluation(exec, required, stack, index)
+		if err != nil {
+			return index, err
+		}
+
+		if required.Status == STATUS_EVALUATING {
+			module.dfsAncestorIndex = min(module.dfsAncestorIndex, required.dfsAncestorIndex)
+		} else {
+			required = required.cycleRoot
+			if required.EvaluationError != nil {
+				return index, required.EvaluationError
+			}
+		}
+
+		if required.asyncEvaluationOrder > 0 {
+			module.pendingAsyncDependencies++
+			required.asyncParentModules = append(required.asyncParentModules, module)
+		}
+	}
+
+	if module.pendingAsyncDependencies > 0 || module.HasTLA {
+		l.asyncEvaluationCount++
+		module.asyncEvaluationOrder = l.asyncEvaluationCount
+		if module.pendingAsyncDependencies == 0 {
+			l.executeAsyncModule(exec, module)
+		}
+	} else if module.commonJS != nil {
+		err := l.evaluateCommonJS(module, exec)
+		if err != nil {
+			return index, err
+		}
+	} else if !module.Synthetic() {
+		err := exec.Execute(module)
+		if err != nil {
+			return index, err
+		}
+	}
+
+	if module.dfsAncestorIndex == module.dfsIndex {
+		for {
+			required := (*stack)[len(*stack)-1]
+			*stack = (*stack)[:len(*stack)-1]
+			if required.asyncEvaluationOrder == 0 {
+				required.Status = STATUS_EVALUATED
+			} else {
+				required.Status = STATUS_EVALUATING_ASYNC
+			}
+			required.cycleRoot = module
+			if required == module {
+				break
+			}
+		}
+	}
+	return index, nil
+}
+
+func (l *Loader) executeAsyncModule(exec Executor, module *Module) {
+	called := false
+	exec.ExecuteAsync(module, func(err error) {
+		if called {
+			return
+		}
+		called = true
+		l.enqueueJob(func() {
+			if err != nil {
+				l.asyncModuleExecutionRejected(module, err)
+			} else {
+				l.asyncModuleExecutionFulfilled(exec, module)
+			}
+		})
+	})
+}
+
+// gatherAvailableAncestors collects the modules that can run now that module
+// has finished, see ecma-262 16.2.1.5.3.2
+func gatherAvailableAncestors(module *Module, execList *[]*Module) {
+	for _, m := range module.asyncParentModules {
+		// Parents that threw synchronously have no cycle root, only their
+		// own error
+		if containsModule(*execList, m) || m.EvaluationError != nil || m.cycleRoot.EvaluationError != nil {
+			continue
+		}
+		m.pendingAsyncDependencies--
+		if m.pendingAsyncDependencies == 0 {
+			*execList = append(*execList, m)
+			if !m.HasTLA {
+				gatherAvailableAncestors(m, execList)
+			}
+		}
+	}
+}
+
+func containsModule(modules []*Module, m *Module) bool {
+	for _, module := range modules {
+		if module == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Loader) asyncModuleExecutionFulfilled(exec Executor, module *Module) {
+	if module.Status == STATUS_EVALUATED {
+		// Already rejected through another dependency
+		return
+	}
+
+	module.asyncEvaluationOrder = ASYNC_EVALUATION_DONE
+	module.Status = STATUS_EVALUATED
+	if module.topLevelCapability != nil {
+		module.topLevelCapability.settle(nil)
+	}
+
+	execList := []*Module{}
+	gatherAvailableAncestors(module, &execList)
+	sort.SliceStable(execList, func(i, j int) bool {
+		return execList[i].asyncEvaluationOrder < execList[j].asyncEvaluationOrder
+	})
+
+	for _, m := range execList {
+		if m.Status == STATUS_EVALUATED {
+			continue
+		}
+		if m.HasTLA {
+			l.executeAsyncModule(exec, m)
+			continue
+		}
+		err := exec.Execute(m)
+		if err != nil {
+			l.asyncModuleExecutionRejected(m, err)
+			continue
+		}
+		m.asyncEvaluationOrder = ASYNC_EVALUATION_DONE
+		m.Status = STATUS_EVALUATED
+		if m.topLevelCapability != nil {
+			m.topLevelCapability.settle(nil)
+		}
+	}
+}
+
+func (l *Loader) asyncModuleExecutionRejected(module *Module, err error) {
+	if module.Status == STATUS_EVALUATED {
+		return
+	}
+
+	module.EvaluationError = err
+	module.asyncEvaluationOrder = ASYNC_EVALUATION_DONE
+	module.Status = STATUS_EVALUATED
+	for _, m := range module.asyncParentModules {
+		l.asyncModuleExecutionRejected(m, err)
+	}
+	if module.topLevelCapability != nil {
+		module.topLevelCapability.settle(err)
+	}
+}
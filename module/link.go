@@ -0,0 +1,266 @@
+package module
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// ResolvedBinding is where an exported name lives. When Namespace is set the
+// binding is the namespace object of Module instead of one of its locals.
+type ResolvedBinding struct {
+	Module      *Module
+	BindingName string
+	Namespace   bool
+}
+
+// Namespace describes a module namespace object, Exports is sorted in code
+// unit order as the spec requires
+type Namespace struct {
+	Module   *Module
+	Exports  []string
+	bindings map[string]*ResolvedBinding
+}
+
+func (ns *Namespace) Binding(name string) (*ResolvedBinding, bool) {
+	binding, found := ns.bindings[name]
+	return binding, found
+}
+
+// Link resolves every import of the graph rooted at m, see ecma-262 16.2.1.5.1
+func (m *Module) Link() error {
+	stack := []*Module{}
+	_, err := m.innerModuleLinking(&stack, 0)
+	if err != nil {
+		for _, linking := range stack {
+			linking.Status = STATUS_UNLINKED
+			linking.ImportBindings = map[string]*ResolvedBinding{}
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *Module) innerModuleLinking(stack *[]*Module, index int) (int, error) {
+	switch m.Status {
+	case STATUS_LINKING, STATUS_LINKED, STATUS_EVALUATING_ASYNC, STATUS_EVALUATED:
+		return index, nil
+	case STATUS_NEW:
+		return index, fmt.Errorf("Module '%s' has not been loaded", m.Path)
+	}
+
+	m.Status = STATUS_LINKING
+	m.dfsIndex = index
+	m.dfsAncestorIndex = index
+	index++
+	*stack = append(*stack, m)
+
+	for _, request := range m.RequestedModules {
+		required := m.getImportedModule(request)
+
+		var err error
+		index, err = required.innerModuleLinking(stack, index)
+		if err != nil {
+			return index, err
+		}
+
+		if required.Status == STATUS_LINKING {
+			m.dfsAncestorIndex = min(m.dfsAncestorIndex, required.dfsAncestorIndex)
+		}
+	}
+
+	err := m.initializeEnvironment()
+	if err != nil {
+		return index, err
+	}
+
+	if m.dfsAncestorIndex == m.dfsIndex {
+		for {
+			required := (*stack)[len(*stack)-1]
+			*stack = (*stack)[:len(*stack)-1]
+			required.Status = STATUS_LINKED
+			if required == m {
+				break
+			}
+		}
+	}
+	return index, nil
+}
+
+// initializeEnvironment checks that every import and indirect export can be
+// resolved and records where imported bindings live, see ecma-262 16.2.1.6.4
+func (m *Module) initializeEnvironment() error {
+	for _, e := range m.IndirectExportEntries {
+		_, err := m.resolveOrError(e.ExportName, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ie := range m.ImportEntries {
+		imported := m.getImportedModule(ie.ModuleRequest)
+		if ie.Namespace {
+			imported.GetNamespace()
+			m.ImportBindings[ie.LocalName] = &ResolvedBinding{Module: imported, Namespace: true}
+			continue
+		}
+
+		resolution, err := imported.resolveOrError(ie.ImportName, m)
+		if err != nil {
+			return err
+		}
+		if resolution.Namespace {
+			resolution.Module.GetNamespace()
+		}
+		m.ImportBindings[ie.LocalName] = resolution
+	}
+	return nil
+}
+
+func (m *Module) resolveOrError(exportName string, importer *Module) (*ResolvedBinding, error) {
+	resolution, ambiguous := m.ResolveExport(exportName)
+	if ambiguous {
+		return nil, fmt.Errorf("The requested module '%s' contains conflicting star exports for name '%s' (imported by '%s')", m.Path, exportName, importer.Path)
+	}
+	if resolution == nil {
+		return nil, fmt.Errorf("The requested module '%s' does not provide an export named '%s' (imported by '%s')", m.Path, exportName, importer.Path)
+	}
+	return resolution, nil
+}
+
+type resolvedName struct {
+	module     *Module
+	exportName string
+}
+
+// ResolveExport finds the binding exportName refers to. It returns nil when the
+// name can't be resolved, and ambiguous when star exports provide more than one
+// binding for it. See ecma-262 16.2.1.6.3
+func (m *Module) ResolveExport(exportName string) (resolution *ResolvedBinding, ambiguous bool) {
+	return m.resolveExport(exportName, []resolvedName{})
+}
+
+func (m *Module) resolveExport(exportName string, resolveSet []resolvedName) (*ResolvedBinding, bool) {
+	for _, r := range resolveSet {
+		if r.module == m && r.exportName == exportName {
+			// Circular import request
+			return nil, false
+		}
+	}
+	resolveSet = append(resolveSet, resolvedName{module: m, exportName: exportName})
+
+	for _, e := range m.LocalExportEntries {
+		if e.ExportName == exportName {
+			return &ResolvedBinding{Module: m, BindingName: e.LocalName}, false
+		}
+	}
+
+	for _, e := range m.IndirectExportEntries {
+		if e.ExportName == exportName {
+			imported := m.getImportedModule(e.ModuleRequest)
+			if e.ImportKind == IMPORT_ALL {
+				return &ResolvedBinding{Module: imported, Namespace: true}, false
+			}
+			return imported.resolveExport(e.ImportName, resolveSet)
+		}
+	}
+
+	if exportName == "default" {
+		// A default export cannot be provided by export * from
+		return nil, false
+	}
+
+	var starResolution *ResolvedBinding
+	for _, e := range m.StarExportEntries {
+		imported := m.getImportedModule(e.ModuleRequest)
+		resolution, ambiguous := imported.resolveExport(exportName, resolveSet)
+		if ambiguous {
+			return nil, true
+		}
+		if resolution == nil {
+			continue
+		}
+		if starResolution == nil {
+			starResolution = resolution
+			continue
+		}
+		if resolution.Module != starResolution.Module ||
+			resolution.Namespace != starResolution.Namespace ||
+			resolution.BindingName != starResolution.BindingName {
+			return nil, true
+		}
+	}
+	return starResolution, false
+}
+
+// GetExportedNames lists every name m exports, including the ones provided by
+// star exports, see ecma-262 16.2.1.6.2
+func (m *Module) GetExportedNames() []string {
+	return m.getExportedNames(map[*Module]bool{})
+}
+
+func (m *Module) getExportedNames(exportStarSet map[*Module]bool) []string {
+	if exportStarSet[m] {
+		// Circular star export
+		return []string{}
+	}
+	exportStarSet[m] = true
+
+	names := []string{}
+	for _, e := range m.LocalExportEntries {
+		names = append(names, e.ExportName)
+	}
+	for _, e := range m.IndirectExportEntries {
+		names = append(names, e.ExportName)
+	}
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, e := range m.StarExportEntries {
+		requested := m.getImportedModule(e.ModuleRequest)
+		for _, name := range requested.getExportedNames(exportStarSet) {
+			if name != "default" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// GetNamespace returns the namespace of m, creating it on first use. Names that
+// resolve ambiguously are left out. See ecma-262 16.2.1.10
+func (m *Module) GetNamespace() *Namespace {
+	if m.namespace != nil {
+		return m.namespace
+	}
+
+	ns := &Namespace{Module: m, Exports: []string{}, bindings: map[string]*ResolvedBinding{}}
+	for _, name := range m.GetExportedNames() {
+		resolution, ambiguous := m.ResolveExport(name)
+		if resolution != nil && !ambiguous {
+			ns.Exports = append(ns.Exports, name)
+			ns.bindings[name] = resolution
+		}
+	}
+	sort.Slice(ns.Exports, func(i, j int) bool {
+		return compareCodeUnits(ns.Exports[i], ns.Exports[j]) < 0
+	})
+
+	m.namespace = ns
+	return ns
+}
+
+// compareCodeUnits orders strings the way JS does, by UTF-16 code units
+// instead of by UTF-8 bytes
+func compareCodeUnits(a, b string) int {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return int(ua[i]) - int(ub[i])
+		}
+	}
+	return len(ua) - len(ub)
+}
@@ -0,0 +1,353 @@
+package module
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"go_js/parser"
+	"go_js/sourcemap"
+)
+
+// Resolver turns an import specifier into a path in the loader's file system.
+// referrer is the path of the importing module.
+type Resolver interface {
+	Resolve(specifier string, referrer string) (string, error)
+}
+
+type ResolverFunc func(specifier string, referrer string) (string, error)
+
+func (f ResolverFunc) Resolve(specifier string, referrer string) (string, error) {
+	return f(specifier, referrer)
+}
+
+// PathResolver resolves relative specifiers ("./x.js", "../x.js") against the
+// directory of the referrer, and absolute ones ("/x.js") against the root of
+// the file system. Bare specifiers are rejected.
+var PathResolver = ResolverFunc(func(specifier string, referrer string) (string, error) {
+	var resolved string
+
+	switch {
+	case strings.HasPrefix(specifier, "/"):
+		resolved = path.Clean(strings.TrimLeft(specifier, "/"))
+	case strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../"):
+		resolved = path.Join(path.Dir(referrer), specifier)
+	default:
+		return "", fmt.Errorf("Cannot resolve module specifier '%s'", specifier)
+	}
+
+	if !fs.ValidPath(resolved) {
+		return "", fmt.Errorf("Cannot resolve module specifier '%s' from '%s'", specifier, referrer)
+	}
+	return resolved, nil
+})
+
+// ModuleTypeParser turns the source of a non-JavaScript module into the value
+// of its default export
+type ModuleTypeParser func(source []byte) (any, error)
+
+// Loader owns the module map. It reads modules from FS, parses them and
+// loads their dependencies so the resulting graph can be linked.
+type Loader struct {
+	FS       fs.FS
+	Resolver Resolver
+
+	// ImportMetaHook is called when import.meta of a module is first used,
+	// it can add properties to meta or replace the default ones
+	ImportMetaHook func(m *Module, meta map[string]any)
+
+	// RequireResolver resolves require() specifiers, Resolver is used when
+	// it's nil. Format tells which files are CommonJS, see (*Loader).format.
+	// Set them to NewRequireResolver and (*NodeResolver).Format for Node's
+	// behavior.
+	RequireResolver Resolver
+	Format          func(name string) string
+
+	modules              map[moduleKey]*Module
+	commonJSModules      map[string]*CommonJSModule
+	moduleTypes          map[string]ModuleTypeParser
+	asyncEvaluationCount int
+	jobs                 []func()
+	runningJobs          bool
+}
+
+// The module map is keyed by path and module type, importing the same file
+// as JavaScript and as JSON gives two different modules
+type moduleKey struct {
+	path string
+	typ  string
+}
+
+func NewLoader(fsys fs.FS, resolver Resolver) *Loader {
+	if resolver == nil {
+		resolver = PathResolver
+	}
+	return &Loader{
+		FS:              fsys,
+		Resolver:        resolver,
+		modules:         map[moduleKey]*Module{},
+		commonJSModules: map[string]*CommonJSModule{},
+		moduleTypes: map[string]ModuleTypeParser{
+			MODULE_TYPE_JSON: ParseJSON,
+		},
+	}
+}
+
+// RegisterModuleType makes `with { type: typ }` imports load through parse.
+// "json" is registered by default and can be replaced.
+func (l *Loader) RegisterModuleType(typ string, parse ModuleTypeParser) {
+	l.moduleTypes[typ] = parse
+}
+
+// ParseJSON is the parser of the json module type, objects are JSONObject
+// so their keys stay in source order
+func ParseJSON(source []byte) (any, error) {
+	return decodeOrderedJSON(source)
+}
+
+// ParseText can be registered as a module type to import files as strings
+func ParseText(source []byte) (any, error) {
+	return string(source), nil
+}
+
+// ParseBytes can be registered as a module type to import files as raw bytes,
+// the runtime exposes them as a Uint8Array
+func ParseBytes(source []byte) (any, error) {
+	return source, nil
+}
+
+// moduleType validates the attributes of request and returns the type of the
+// module it asks for, see ecma-262 16.2.1.8 HostGetSupportedImportAttributes
+func (l *Loader) moduleType(request *ModuleRequest) (string, error) {
+	typ := MODULE_TYPE_JAVASCRIPT
+	for key, value := range request.Attributes {
+		if key != "type" {
+			return "", fmt.Errorf("Import attribute '%s' is not supported (importing '%s')", key, request.Specifier)
+		}
+		if _, found := l.moduleTypes[value]; !found {
+			return "", fmt.Errorf("Import attribute type '%s' is not supported (importing '%s')", value, request.Specifier)
+		}
+		typ = value
+	}
+	return typ, nil
+}
+
+// Load parses the module at name and every module it depends on. name is a
+// path in the loader's file system, it isn't passed through the Resolver.
+func (l *Loader) Load(name string) (*Module, error) {
+	root, err := l.module(path.Clean(name), MODULE_TYPE_JAVASCRIPT)
+	if err != nil {
+		return nil, err
+	}
+	return root, l.loadRequestedModules(root)
+}
+
+func (l *Loader) loadRequestedModules(root *Module) error {
+	pending := []*Module{root}
+	for len(pending) > 0 {
+		m := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for _, request := range m.RequestedModules {
+			if _, loaded := m.loadedModules[request.key()]; loaded {
+				continue
+			}
+			required, err := l.resolveModule(request, m.Path)
+			if err != nil {
+				return err
+			}
+			m.loadedModules[request.key()] = required
+			if required.Status == STATUS_NEW {
+				pending = append(pending, required)
+			}
+		}
+		if m.Status == STATUS_NEW {
+			m.Status = STATUS_UNLINKED
+		}
+	}
+	return nil
+}
+
+func (l *Loader) resolveModule(request *ModuleRequest, referrer string) (*Module, error) {
+	typ, err := l.moduleType(request)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := l.Resolver.Resolve(request.Specifier, referrer)
+	if err != nil {
+		return nil, err
+	}
+	return l.module(resolved, typ)
+}
+
+// Module returns the already loaded JavaScript module at name
+func (l *Loader) Module(name string) (*Module, bool) {
+	m, found := l.modules[moduleKey{path: path.Clean(name), typ: MODULE_TYPE_JAVASCRIPT}]
+	return m, found
+}
+
+func (l *Loader) module(name string, typ string) (*Module, error) {
+	key := moduleKey{path: name, typ: typ}
+	if m, found := l.modules[key]; found {
+		return m, nil
+	}
+
+	var m *Module
+	if typ == MODULE_TYPE_JAVASCRIPT {
+		switch l.format(name) {
+		case FORMAT_COMMONJS:
+			cjs, err := l.commonJS(name)
+			if err != nil {
+				return nil, err
+			}
+			m = l.newCommonJSFacade(cjs)
+			m.loader = l
+			l.modules[key] = m
+			return m, nil
+		case FORMAT_JSON:
+			return nil, fmt.Errorf("Module '%s' needs an import attribute of type \"json\"", name)
+		}
+	}
+
+	source, err := l.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ == MODULE_TYPE_JAVASCRIPT {
+		ast, err := l.parse(name, source, &parser.Options{SourceType: "module", AllowHashBang: true})
+		if err != nil {
+			return nil, err
+		}
+		m = ParseModule(name, source, ast)
+	} else {
+		value, err := l.moduleTypes[typ](source)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load %s module '%s': %w", typ, name, err)
+		}
+		m = newSyntheticModule(name, typ, source, value)
+	}
+
+	m.loader = l
+	l.modules[key] = m
+	return m, nil
+}
+
+// parse parses the JavaScript module name. Syntax errors in generated code
+// are reported at the original position when the file has a source map.
+func (l *Loader) parse(name string, source []byte, options *parser.Options) (*parser.Node, error) {
+	options.SourceFile = &name
+	ast, err := parser.GetAst(source, options, 0)
+	if err != nil {
+		return nil, sourcemap.RemapError(err, l.FS, name, source)
+	}
+	return ast, nil
+}
+
+func (l *Loader) readFile(name string) ([]byte, error) {
+	source, err := fs.ReadFile(l.FS, name)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load module '%s': %w", name, err)
+	}
+	return source, nil
+}
+
+// getImportedModule returns the module loaded for request, see ecma-262 16.2.1.7
+func (m *Module) getImportedModule(request *ModuleRequest) *Module {
+	imported, found := m.loadedModules[request.key()]
+	if !found {
+		panic("module '" + request.Specifier + "' was not loaded for '" + m.Path + "'")
+	}
+	return imported
+}
+
+// Import is the host side of `import()`, it loads, links and evaluates the
+// module specifier refers to. referrer is the importing module, nil when
+// called from a script. attributes come from the `with` key of the options
+// argument. callback receives the namespace once the module has been
+// evaluated. When Import is called while a graph is being evaluated, the
+// work is queued until that evaluation is over, like a promise job would be.
+func (l *Loader) Import(specifier string, referrer *Module, attributes map[string]string, exec Executor, callback func(*Namespace, error)) {
+	request := &ModuleRequest{Specifier: specifier, Attributes: attributes}
+
+	l.enqueueJob(func() {
+		m, err := l.importedModule(request, referrer)
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+
+		err = m.Link()
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+
+		m.Evaluate(exec).Then(func(err error) {
+			if err != nil {
+				callback(nil, err)
+				return
+			}
+			callback(m.GetNamespace(), nil)
+		})
+	})
+}
+
+func (l *Loader) importedModule(request *ModuleRequest, referrer *Module) (*Module, error) {
+	referrerPath := ""
+	if referrer != nil {
+		if m, loaded := referrer.loadedModules[request.key()]; loaded {
+			return m, nil
+		}
+		referrerPath = referrer.Path
+	}
+
+	m, err := l.resolveModule(request, referrerPath)
+	if err != nil {
+		return nil, err
+	}
+	err = l.loadRequestedModules(m)
+	if err != nil {
+		return nil, err
+	}
+	if referrer != nil {
+		referrer.loadedModules[request.key()] = m
+	}
+	return m, nil
+}
+
+// ImportMeta returns the properties of import.meta for m. They're created the
+// first time import.meta is used: url, filename and dirname describe where
+// the module was loaded from, and resolve is a func(string) (string, error)
+// resolving specifiers relative to m. The loader's ImportMetaHook runs last.
+func (m *Module) ImportMeta() map[string]any {
+	if m.importMeta != nil {
+		return m.importMeta
+	}
+
+	l := m.loader
+	meta := map[string]any{
+		"url":      fileURL(m.Path),
+		"filename": m.Path,
+		"dirname":  path.Dir(m.Path),
+		"resolve": func(specifier string) (string, error) {
+			resolved, err := l.Resolver.Resolve(specifier, m.Path)
+			if err != nil {
+				return "", err
+			}
+			return fileURL(resolved), nil
+		},
+	}
+	if l.ImportMetaHook != nil {
+		l.ImportMetaHook(m, meta)
+	}
+
+	m.importMeta = meta
+	return meta
+}
+
+func fileURL(name string) string {
+	return (&url.URL{Scheme: "file", Path: "/" + name}).String()
+}
@@ -0,0 +1,410 @@
+package module
+
+import (
+	"sort"
+	"strings"
+
+	"go_js/jsstring"
+	"go_js/parser"
+)
+
+// Status tracks a module through linking and evaluation, this is the
+// [[Status]] field of a Cyclic Module Record (ecma-262 16.2.1.5)
+type Status int
+
+const (
+	STATUS_NEW Status = iota
+	STATUS_UNLINKED
+	STATUS_LINKING
+	STATUS_LINKED
+	STATUS_EVALUATING
+	STATUS_EVALUATING_ASYNC
+	STATUS_EVALUATED
+)
+
+// ImportKind tells how an export entry refers to the module it re-exports from
+type ImportKind int
+
+const (
+	IMPORT_NONE            ImportKind = iota // local export, `export { x }`
+	IMPORT_NAME                              // `export { x } from '...'`
+	IMPORT_ALL                               // `export * as ns from '...'`
+	IMPORT_ALL_BUT_DEFAULT                   // `export * from '...'`
+)
+
+// Local name given to anonymous default exports, see ecma-262 16.2.3.7
+const DEFAULT_EXPORT_LOCAL_NAME = "*default*"
+
+// Module types, selected with the `type` import attribute
+const (
+	MODULE_TYPE_JAVASCRIPT = "javascript"
+	MODULE_TYPE_JSON       = "json"
+	MODULE_TYPE_COMMONJS   = "commonjs" // not selectable, see newCommonJSFacade
+)
+
+type ModuleRequest struct {
+	Specifier  string
+	Attributes map[string]string
+}
+
+// key identifies the request in a module's loaded modules, two requests with
+// the same specifier but different attributes can load different modules
+func (r *ModuleRequest) key() string {
+	if len(r.Attributes) == 0 {
+		return r.Specifier
+	}
+	keys := make([]string, 0, len(r.Attributes))
+	for k := range r.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(r.Specifier)
+	for _, k := range keys {
+		sb.WriteString("\x00" + k + "\x00" + r.Attributes[k])
+	}
+	return sb.String()
+}
+
+type ImportEntry struct {
+	ModuleRequest *ModuleRequest
+	ImportName    string
+	Namespace     bool // `import * as ns from '...'`
+	LocalName     string
+	Node          *parser.Node
+}
+
+type ExportEntry struct {
+	ExportName    string
+	ModuleRequest *ModuleRequest
+	ImportName    string
+	ImportKind    ImportKind
+	LocalName     string
+	Node          *parser.Node
+}
+
+// Module is a Source Text Module Record, it's created by the Loader and
+// carries everything needed to link the module graph. Running the module body
+// is left to an Executor.
+type Module struct {
+	Path                  string
+	Type                  string
+	Source                []byte
+	Ast                   *parser.Node
+	RequestedModules      []*ModuleRequest
+	ImportEntries         []*ImportEntry
+	LocalExportEntries    []*ExportEntry
+	IndirectExportEntries []*ExportEntry
+	StarExportEntries     []*ExportEntry
+	HasTLA                bool
+	Status                Status
+	EvaluationError       error
+
+	// Value is the default export of a synthetic module, one whose Type isn't
+	// javascript. The default binding is never reassigned, and the runtime
+	// exposes objects and arrays in it frozen.
+	Value any
+
+	// Filled in by Link, maps every imported local name to the binding it
+	// resolves to. These are live bindings: the runtime should read through
+	// them instead of copying values.
+	ImportBindings map[string]*ResolvedBinding
+
+	loader        *Loader
+	loadedModules map[string]*Module
+	commonJS      *CommonJSModule
+	namespace     *Namespace
+	importMeta    map[string]any
+
+	dfsIndex                 int
+	dfsAncestorIndex         int
+	cycleRoot                *Module
+	asyncEvaluationOrder     int // 0 when unset, ASYNC_EVALUATION_DONE when done
+	pendingAsyncDependencies int
+	asyncParentModules       []*Module
+	topLevelCapability       *Promise
+}
+
+// ParseModule collects the import and export entries of a parsed module,
+// see ecma-262 16.2.1.6.1
+func ParseModule(path string, source []byte, ast *parser.Node) *Module {
+	m := &Module{
+		Path:           path,
+		Type:           MODULE_TYPE_JAVASCRIPT,
+		Source:         source,
+		Ast:            ast,
+		Status:         STATUS_NEW,
+		ImportBindings: map[string]*ResolvedBinding{},
+		loadedModules:  map[string]*Module{},
+	}
+
+	requests := map[string]*ModuleRequest{}
+	request := func(node *parser.Node) *ModuleRequest {
+		r := &ModuleRequest{Specifier: stringValue(node.Source), Attributes: attributes(node.Attributes)}
+		if existing, found := requests[r.key()]; found {
+			return existing
+		}
+		requests[r.key()] = r
+		m.RequestedModules = append(m.RequestedModules, r)
+		return r
+	}
+
+	var exportEntries []*ExportEntry
+
+	for _, stmt := range ast.Body {
+		switch stmt.Type {
+		case parser.NODE_IMPORT_DECLARATION:
+			r := request(stmt)
+			for _, spec := range stmt.Specifiers {
+				entry := &ImportEntry{ModuleRequest: r, LocalName: spec.Local.Name, Node: spec}
+				switch spec.Type {
+				case parser.NODE_IMPORT_DEFAULT_SPECIFIER:
+					entry.ImportName = "default"
+				case parser.NODE_IMPORT_NAMESPACE_SPECIFIER:
+					entry.Namespace = true
+				default:
+					entry.ImportName = exportName(spec.Imported)
+				}
+				m.ImportEntries = append(m.ImportEntries, entry)
+			}
+
+		case parser.NODE_EXPORT_NAMED_DECLARATION:
+			if stmt.Declaration != nil {
+				for _, name := range declarationNames(stmt.Declaration) {
+					exportEntries = append(exportEntries, &ExportEntry{ExportName: name, LocalName: name, Node: stmt})
+				}
+				continue
+			}
+
+			if stmt.Source == nil {
+				for _, spec := range stmt.Specifiers {
+					exportEntries = append(exportEntries, &ExportEntry{
+						ExportName: exportName(spec.Exported),
+						LocalName:  exportName(spec.Local),
+						Node:       spec,
+					})
+				}
+				continue
+			}
+
+			r := request(stmt)
+			for _, spec := range stmt.Specifiers {
+				exportEntries = append(exportEntries, &ExportEntry{
+					ExportName:    exportName(spec.Exported),
+					ModuleRequest: r,
+					ImportName:    exportName(spec.Local),
+					ImportKind:    IMPORT_NAME,
+					Node:          spec,
+				})
+			}
+
+		case parser.NODE_EXPORT_ALL_DECLARATION:
+			r := request(stmt)
+			if stmt.Exported == nil {
+				exportEntries = append(exportEntries, &ExportEntry{ModuleRequest: r, ImportKind: IMPORT_ALL_BUT_DEFAULT, Node: stmt})
+			} else {
+				exportEntries = append(exportEntries, &ExportEntry{
+					ExportName:    exportName(stmt.Exported),
+					ModuleRequest: r,
+					ImportKind:    IMPORT_ALL,
+					Node:          stmt,
+				})
+			}
+
+		case parser.NODE_EXPORT_DEFAULT_DECLARATION:
+			localName := DEFAULT_EXPORT_LOCAL_NAME
+			decl := stmt.Declaration
+			if (decl.Type == parser.NODE_FUNCTION_DECLARATION || decl.Type == parser.NODE_CLASS_DECLARATION) && decl.Identifier != nil {
+				localName = decl.Identifier.Name
+			}
+			exportEntries = append(exportEntries, &ExportEntry{ExportName: "default", LocalName: localName, Node: stmt})
+		}
+	}
+
+	imports := map[string]*ImportEntry{}
+	for _, ie := range m.ImportEntries {
+		imports[ie.LocalName] = ie
+	}
+
+	for _, ee := range exportEntries {
+		switch {
+		case ee.ModuleRequest == nil:
+			ie, imported := imports[ee.LocalName]
+			if !imported || ie.Namespace {
+				m.LocalExportEntries = append(m.LocalExportEntries, ee)
+			} else {
+				// Re-export of an imported binding, resolve it through the
+				// module it was imported from
+				m.IndirectExportEntries = append(m.IndirectExportEntries, &ExportEntry{
+					ExportName:    ee.ExportName,
+					ModuleRequest: ie.ModuleRequest,
+					ImportName:    ie.ImportName,
+					ImportKind:    IMPORT_NAME,
+					Node:          ee.Node,
+				})
+			}
+		case ee.ImportKind == IMPORT_ALL_BUT_DEFAULT:
+			m.StarExportEntries = append(m.StarExportEntries, ee)
+		default:
+			m.IndirectExportEntries = append(m.IndirectExportEntries, ee)
+		}
+	}
+
+	m.HasTLA = containsAwait(ast.Body)
+	return m
+}
+
+// newSyntheticModule creates the record of a module whose only export is
+// default, like JSON modules (ecma-262 16.2.1.8 CreateDefaultExportSyntheticModule)
+func newSyntheticModule(path string, typ string, source []byte, value any) *Module {
+	return &Module{
+		Path:               path,
+		Type:               typ,
+		Source:             source,
+		Value:              value,
+		Status:             STATUS_NEW,
+		LocalExportEntries: []*ExportEntry{{ExportName: "default", LocalName: "default"}},
+		ImportBindings:     map[string]*ResolvedBinding{},
+		loadedModules:      map[string]*Module{},
+	}
+}
+
+// Synthetic reports whether m was created from a value instead of from
+// JavaScript source, evaluating it doesn't run any code. The facades of
+// CommonJS modules aren't synthetic, evaluating them runs the module.
+func (m *Module) Synthetic() bool {
+	return m.Type != MODULE_TYPE_JAVASCRIPT && m.Type != MODULE_TYPE_COMMONJS
+}
+
+func stringValue(node *parser.Node) string {
+	switch v := node.Value.(type) {
+	case jsstring.String:
+		return v.String()
+	case string:
+		return v
+	}
+	return ""
+}
+
+func exportName(node *parser.Node) string {
+	if node.Type == parser.NODE_IDENTIFIER {
+		return node.Name
+	}
+	return stringValue(node)
+}
+
+func attributes(nodes []*parser.Node) map[string]string {
+	if len(nodes) == 0 {
+		return nil
+	}
+	attrs := map[string]string{}
+	for _, attr := range nodes {
+		if value, ok := attr.Value.(*parser.Node); ok {
+			attrs[exportName(attr.Key)] = stringValue(value)
+		}
+	}
+	return attrs
+}
+
+func declarationNames(decl *parser.Node) []string {
+	if decl.Type == parser.NODE_VARIABLE_DECLARATION {
+		names := []string{}
+		for _, declarator := range decl.Declarations {
+			names = appendBoundNames(names, declarator.Identifier)
+		}
+		return names
+	}
+	if decl.Identifier != nil {
+		return []string{decl.Identifier.Name}
+	}
+	return nil
+}
+
+func appendBoundNames(names []string, pattern *parser.Node) []string {
+	if pattern == nil {
+		return names
+	}
+	switch pattern.Type {
+	case parser.NODE_IDENTIFIER:
+		names = append(names, pattern.Name)
+	case parser.NODE_OBJECT_PATTERN:
+		for _, prop := range pattern.Properties {
+			names = appendBoundNames(names, prop)
+		}
+	case parser.NODE_ARRAY_PATTERN:
+		for _, elt := range pattern.Elements {
+			names = appendBoundNames(names, elt)
+		}
+	case parser.NODE_PROPERTY:
+		if value, ok := pattern.Value.(*parser.Node); ok {
+			names = appendBoundNames(names, value)
+		}
+	case parser.NODE_ASSIGNMENT_PATTERN:
+		names = appendBoundNames(names, pattern.Left)
+	case parser.NODE_REST_ELEMENT:
+		names = appendBoundNames(names, pattern.Argument)
+	}
+	return names
+}
+
+// containsAwait reports whether the statements use `await` outside of any
+// function, which makes the module async ([[HasTLA]])
+func containsAwait(nodes []*parser.Node) bool {
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		switch node.Type {
+		case parser.NODE_AWAIT_EXPRESSION:
+			return true
+		case parser.NODE_FOR_OF_STATEMENT:
+			if node.Await {
+				return true
+			}
+		case parser.NODE_FUNCTION, parser.NODE_FUNCTION_DECLARATION, parser.NODE_FUNCTION_EXPRESSION, parser.NODE_ARROW_FUNCTION_EXPRESSION:
+			continue
+		case parser.NODE_CLASS_DECLARATION, parser.NODE_CLASS_EXPRESSION:
+			// Only the heritage and computed keys are evaluated in the
+			// enclosing scope, everything else runs inside functions
+			if containsAwait([]*parser.Node{node.SuperClass}) {
+				return true
+			}
+			if node.BodyNode != nil {
+				for _, element := range node.BodyNode.Body {
+					if element.Computed && containsAwait([]*parser.Node{element.Key}) {
+						return true
+					}
+				}
+			}
+			continue
+		}
+		if containsAwait(children(node)) {
+			return true
+		}
+	}
+	return false
+}
+
+func children(node *parser.Node) []*parser.Node {
+	nodes := []*parser.Node{
+		node.BodyNode, node.Identifier, node.Expression, node.Object, node.Argument,
+		node.Label, node.Test, node.Consequent, node.Alternate, node.Discriminant,
+		node.Block, node.Handler, node.Finalizer, node.Param, node.Initializer,
+		node.Update, node.Key, node.Left, node.Right, node.MemberProperty,
+		node.Callee, node.Quasi, node.Tag, node.SuperClass, node.Meta,
+		node.Property, node.Source, node.Imported, node.Local, node.Declaration,
+		node.Exported, node.Options,
+	}
+	if value, ok := node.Value.(*parser.Node); ok {
+		nodes = append(nodes, value)
+	}
+	for _, list := range [][]*parser.Node{
+		node.Body, node.Params, node.Cases, node.ConsequentSlice, node.Declarations,
+		node.Elements, node.Properties, node.Arguments, node.Expressions, node.Quasis,
+		node.Specifiers, node.Attributes,
+	} {
+		nodes = append(nodes, list...)
+	}
+	return nodes
+}
@@ -0,0 +1,732 @@
+package module
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"go_js/parser"
+)
+
+type recordingExecutor struct {
+	order   []string
+	pending map[string]func(error)
+	fail    map[string]error
+}
+
+func newRecordingExecutor() *recordingExecutor {
+	return &recordingExecutor{pending: map[string]func(error){}, fail: map[string]error{}}
+}
+
+func (e *recordingExecutor) Execute(m *Module) error {
+	e.order = append(e.order, m.Path)
+	return e.fail[m.Path]
+}
+
+func (e *recordingExecutor) ExecuteAsync(m *Module, done func(error)) {
+	e.order = append(e.order, m.Path+" (async)")
+	e.pending[m.Path] = done
+}
+
+func load(t *testing.T, files map[string]string, entry string) (*Loader, *Module) {
+	loader := NewLoader(mapFS(files), nil)
+	m, err := loader.Load(entry)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %s", entry, err.Error())
+	}
+	return loader, m
+}
+
+func TestModuleEntries(t *testing.T) {
+	_, m := load(t, map[string]string{
+		"main.js": `
+			import def, { a as b, "c d" as e } from "./dep.js";
+			import * as ns from "./dep.js";
+			export { b as reexported, ns };
+			export * from "./star.js";
+			export * as starNs from "./star.js";
+			export { x as y } from "./star.js";
+			export const [one, { two }] = [1, { two: 2 }];
+			export default function named() {}
+		`,
+		"dep.js":  `export default 1; export const a = 1; const c = 2; export { c as "c d" };`,
+		"star.js": `export const x = 1;`,
+	}, "main.js")
+
+	specifiers := []string{}
+	for _, r := range m.RequestedModules {
+		specifiers = append(specifiers, r.Specifier)
+	}
+	if !reflect.DeepEqual(specifiers, []string{"./dep.js", "./star.js"}) {
+		t.Errorf("Unexpected requested modules %v", specifiers)
+	}
+
+	imports := []string{}
+	for _, ie := range m.ImportEntries {
+		imports = append(imports, ie.ImportName+">"+ie.LocalName)
+	}
+	if !reflect.DeepEqual(imports, []string{"default>def", "a>b", "c d>e", ">ns"}) {
+		t.Errorf("Unexpected import entries %v", imports)
+	}
+
+	locals := []string{}
+	for _, e := range m.LocalExportEntries {
+		locals = append(locals, e.LocalName+">"+e.ExportName)
+	}
+	if !reflect.DeepEqual(locals, []string{"ns>ns", "one>one", "two>two", "named>default"}) {
+		t.Errorf("Unexpected local export entries %v", locals)
+	}
+
+	indirect := []string{}
+	for _, e := range m.IndirectExportEntries {
+		indirect = append(indirect, e.ModuleRequest.Specifier+":"+e.ImportName+">"+e.ExportName)
+	}
+	if !reflect.DeepEqual(indirect, []string{"./dep.js:a>reexported", "./star.js:>starNs", "./star.js:x>y"}) {
+		t.Errorf("Unexpected indirect export entries %v", indirect)
+	}
+
+	if len(m.StarExportEntries) != 1 || m.HasTLA {
+		t.Errorf("Expected one star export and no top-level await")
+	}
+}
+
+func TestTopLevelAwait(t *testing.T) {
+	cases := map[string]bool{
+		`await 1;`:                               true,
+		`for await (const x of []) {}`:           true,
+		`const f = async () => { await 1 };`:     false,
+		`async function f() { await 1 }`:         false,
+		`class A { [await 1]() {} }`:             true,
+		`class A { async m() { await 1 } }`:      false,
+		`export default await Promise.resolve()`: true,
+	}
+	for source, hasTLA := range cases {
+		_, m := load(t, map[string]string{"main.js": source}, "main.js")
+		if m.HasTLA != hasTLA {
+			t.Errorf("Expected HasTLA to be %v for `%s`", hasTLA, source)
+		}
+	}
+}
+
+func TestLinkCycle(t *testing.T) {
+	_, m := load(t, map[string]string{
+		"a.js": `import { b } from "./b.js"; export const a = "a";`,
+		"b.js": `import { a } from "./a.js"; export const b = "b";`,
+	}, "a.js")
+
+	err := m.Link()
+	if err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+
+	b := m.getImportedModule(m.RequestedModules[0])
+	if binding := b.ImportBindings["a"]; binding == nil || binding.Module != m || binding.BindingName != "a" {
+		t.Errorf("Expected b.js to import the `a` binding of a.js")
+	}
+	if m.Status != STATUS_LINKED || b.Status != STATUS_LINKED {
+		t.Errorf("Expected both modules to be linked")
+	}
+
+	exec := newRecordingExecutor()
+	promise := m.Evaluate(exec)
+	if !promise.Settled() || promise.Err() != nil {
+		t.Errorf("Expected evaluation to succeed")
+	}
+	if !reflect.DeepEqual(exec.order, []string{"b.js", "a.js"}) {
+		t.Errorf("Unexpected evaluation order %v", exec.order)
+	}
+}
+
+func TestLinkMissingExport(t *testing.T) {
+	_, m := load(t, map[string]string{
+		"main.js": `import { missing } from "./dep.js";`,
+		"dep.js":  `export const present = 1;`,
+	}, "main.js")
+
+	err := m.Link()
+	if err == nil {
+		t.Fatal("Expected linking to fail")
+	}
+	expected := "The requested module 'dep.js' does not provide an export named 'missing' (imported by 'main.js')"
+	if err.Error() != expected {
+		t.Errorf("Expected: `%s` Got: %s", expected, err.Error())
+	}
+	if m.Status != STATUS_UNLINKED {
+		t.Errorf("Expected module to be unlinked after a failed link")
+	}
+}
+
+func TestSyntaxErrorSourceMap(t *testing.T) {
+	// A map from tsc for src/util.ts, line 1 maps to line 3 of the original
+	loader := NewLoader(mapFS(map[string]string{
+		"dist/main.js":     "import './util.js'",
+		"dist/util.js":     "export let a = ;\n//# sourceMappingURL=util.js.map",
+		"dist/util.js.map": `{"version":3,"file":"util.js","sources":["../src/util.ts"],"names":[],"mappings":"AAEA,eAAiB"}`,
+		"dist/plain.js":    "export let a = ;",
+		"dist/unmapped.js": "export let a = ;\n//# sourceMappingURL=missing.js.map",
+	}), nil)
+
+	tests := map[string]string{
+		"dist/main.js":     " (3:17) in src/util.ts",
+		"dist/plain.js":    " (1:15) in dist/plain.js",
+		"dist/unmapped.js": " (1:15) in dist/unmapped.js",
+	}
+	for name, expected := range tests {
+		_, err := loader.Load(name)
+		var syntaxErr *parser.SyntaxError
+		if !errors.As(err, &syntaxErr) || !strings.HasSuffix(err.Error(), expected) {
+			t.Errorf("Expected a syntax error ending in `%s` for %s, got %v", expected, name, err)
+		}
+	}
+}
+
+func TestAmbiguousStarExport(t *testing.T) {
+	_, m := load(t, map[string]string{
+		"main.js": `import * as ns from "./both.js";`,
+		"both.js": `export * from "./x.js"; export * from "./y.js"; export * from "./z.js";`,
+		"x.js":    `export const dup = 1, fromX = 1;`,
+		"y.js":    `export const dup = 2; export default 1;`,
+		"z.js":    `export { fromX } from "./x.js";`,
+	}, "main.js")
+
+	err := m.Link()
+	if err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+
+	ns := m.ImportBindings["ns"].Module.GetNamespace()
+	if !reflect.DeepEqual(ns.Exports, []string{"fromX"}) {
+		t.Errorf("Expected only `fromX` in the namespace, got %v", ns.Exports)
+	}
+
+	_, m = load(t, map[string]string{
+		"main.js": `import { dup } from "./both.js";`,
+		"both.js": `export * from "./x.js"; export * from "./y.js";`,
+		"x.js":    `export const dup = 1;`,
+		"y.js":    `export const dup = 2;`,
+	}, "main.js")
+	err = m.Link()
+	if err == nil || !strings.Contains(err.Error(), "conflicting star exports for name 'dup'") {
+		t.Errorf("Expected ambiguous export error, got %v", err)
+	}
+}
+
+func TestEvaluateAsync(t *testing.T) {
+	_, m := load(t, map[string]string{
+		"main.js":  `import "./slow.js"; import "./fast.js"; import "./after.js";`,
+		"slow.js":  `await 1;`,
+		"fast.js":  `export const fast = true;`,
+		"after.js": `import "./slow.js";`,
+	}, "main.js")
+	if err := m.Link(); err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+
+	exec := newRecordingExecutor()
+	promise := m.Evaluate(exec)
+	if promise.Settled() {
+		t.Fatal("Expected evaluation to wait for slow.js")
+	}
+	if !reflect.DeepEqual(exec.order, []string{"slow.js (async)", "fast.js"}) {
+		t.Errorf("Unexpected evaluation order %v", exec.order)
+	}
+
+	exec.pending["slow.js"](nil)
+	if !promise.Settled() || promise.Err() != nil {
+		t.Fatal("Expected evaluation to finish once slow.js did")
+	}
+	if !reflect.DeepEqual(exec.order, []string{"slow.js (async)", "fast.js", "after.js", "main.js"}) {
+		t.Errorf("Unexpected evaluation order %v", exec.order)
+	}
+}
+
+func TestEvaluateError(t *testing.T) {
+	_, m := load(t, map[string]string{
+		"main.js": `import "./dep.js";`,
+		"dep.js":  `await 1;`,
+	}, "main.js")
+	if err := m.Link(); err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+
+	exec := newRecordingExecutor()
+	promise := m.Evaluate(exec)
+	thrown := errors.New("thrown")
+	exec.pending["dep.js"](thrown)
+
+	if promise.Err() != thrown || m.EvaluationError != thrown {
+		t.Errorf("Expected the error of dep.js to reject main.js")
+	}
+	if len(exec.order) != 1 {
+		t.Errorf("Expected main.js not to run, got %v", exec.order)
+	}
+	if again := m.Evaluate(exec); again.Err() != thrown {
+		t.Errorf("Expected evaluating again to return the same error")
+	}
+
+	loader, m := load(t, map[string]string{
+		"a.js": `import "./b.js";`,
+		"b.js": `throw 1;`,
+	}, "a.js")
+	if err := m.Link(); err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+	exec = newRecordingExecutor()
+	exec.fail["b.js"] = thrown
+	if promise := m.Evaluate(exec); promise.Err() != thrown {
+		t.Errorf("Expected the error of b.js to reject a.js, got %v", promise.Err())
+	}
+	if again := m.Evaluate(exec); again.Err() != thrown {
+		t.Errorf("Expected evaluating a.js again to return the same error")
+	}
+	var importErr error
+	loader.Import("./a.js", nil, nil, exec, func(ns *Namespace, err error) {
+		importErr = err
+	})
+	if importErr != thrown {
+		t.Errorf("Expected importing a.js again to return the same error, got %v", importErr)
+	}
+
+	// An async dependency finishing after its parent threw synchronously
+	_, m = load(t, map[string]string{
+		"a.js": `import "./b.js"; import "./c.js";`,
+		"b.js": `await 1;`,
+		"c.js": `throw 1;`,
+	}, "a.js")
+	if err := m.Link(); err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+	exec = newRecordingExecutor()
+	exec.fail["c.js"] = thrown
+	if promise := m.Evaluate(exec); promise.Err() != thrown {
+		t.Errorf("Expected the error of c.js to reject a.js, got %v", promise.Err())
+	}
+	exec.pending["b.js"](nil)
+	if !reflect.DeepEqual(exec.order, []string{"b.js (async)", "c.js"}) {
+		t.Errorf("Expected a.js not to run, got %v", exec.order)
+	}
+}
+
+func TestPathResolver(t *testing.T) {
+	cases := map[[2]string]string{
+		{"./b.js", "lib/a.js"}:     "lib/b.js",
+		{"../b.js", "lib/a.js"}:    "b.js",
+		{"/vendor/c.js", "a.js"}:   "vendor/c.js",
+		{"./x/../y.js", "main.js"}: "y.js",
+	}
+	for input, expected := range cases {
+		resolved, err := PathResolver.Resolve(input[0], input[1])
+		if err != nil || resolved != expected {
+			t.Errorf("Expected %s to resolve to %s, got %s (%v)", input[0], expected, resolved, err)
+		}
+	}
+
+	if _, err := PathResolver.Resolve("lodash", "main.js"); err == nil {
+		t.Error("Expected bare specifier to be rejected")
+	}
+	if _, err := PathResolver.Resolve("../../escape.js", "main.js"); err == nil {
+		t.Error("Expected specifier outside of the file system to be rejected")
+	}
+}
+
+type importingExecutor struct {
+	*recordingExecutor
+	loader    *Loader
+	namespace *Namespace
+	err       error
+}
+
+func (e *importingExecutor) Execute(m *Module) error {
+	e.recordingExecutor.Execute(m)
+	if m.Path == "main.js" {
+		e.loader.Import("./plugins/lazy.js", m, nil, e, func(ns *Namespace, err error) {
+			e.order = append(e.order, "imported")
+			e.namespace, e.err = ns, err
+		})
+	}
+	return nil
+}
+
+func TestDynamicImport(t *testing.T) {
+	loader, m := load(t, map[string]string{
+		"main.js":         `import("./plugins/lazy.js", { with: {} }).then(() => {});`,
+		"plugins/lazy.js": `import { helper } from "../helper.js"; export const name = "lazy"; export { helper };`,
+		"helper.js":       `export function helper() {}`,
+	}, "main.js")
+	if err := m.Link(); err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+	if _, loaded := loader.Module("plugins/lazy.js"); loaded {
+		t.Fatal("Expected dynamically imported module to be loaded lazily")
+	}
+
+	exec := &importingExecutor{recordingExecutor: newRecordingExecutor(), loader: loader}
+	m.Evaluate(exec)
+
+	if exec.err != nil {
+		t.Fatalf("Failed to import: %s", exec.err.Error())
+	}
+	if !reflect.DeepEqual(exec.order, []string{"main.js", "helper.js", "plugins/lazy.js", "imported"}) {
+		t.Errorf("Unexpected evaluation order %v", exec.order)
+	}
+	if exec.namespace == nil || !reflect.DeepEqual(exec.namespace.Exports, []string{"helper", "name"}) {
+		t.Errorf("Expected namespace of plugins/lazy.js, got %v", exec.namespace)
+	}
+
+	var err error
+	loader.Import("./missing.js", m, nil, exec, func(_ *Namespace, e error) { err = e })
+	if err == nil {
+		t.Error("Expected importing a missing module to fail")
+	}
+}
+
+func TestImportMeta(t *testing.T) {
+	loader, m := load(t, map[string]string{
+		"lib/main.js": `export const meta = import.meta;`,
+	}, "lib/main.js")
+	loader.ImportMetaHook = func(m *Module, meta map[string]any) {
+		meta["env"] = "test"
+	}
+
+	meta := m.ImportMeta()
+	if meta["url"] != "file:///lib/main.js" || meta["filename"] != "lib/main.js" || meta["dirname"] != "lib" || meta["env"] != "test" {
+		t.Errorf("Unexpected import.meta %v", meta)
+	}
+
+	resolve := meta["resolve"].(func(string) (string, error))
+	resolved, err := resolve("../other.js")
+	if err != nil || resolved != "file:///other.js" {
+		t.Errorf("Expected ../other.js to resolve to file:///other.js, got %s (%v)", resolved, err)
+	}
+
+	if m.ImportMeta()["env"] != "test" {
+		t.Error("Expected import.meta to be created once")
+	}
+}
+
+func TestJSONModule(t *testing.T) {
+	loader, m := load(t, map[string]string{
+		"main.js":     `import config from "./config.json" with { type: "json" }; export { config };`,
+		"config.json": `{"name": "app", "tags": ["a", "b"], "b": 1, "a": 2, "b": 3}`,
+	}, "main.js")
+	if err := m.Link(); err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+	exec := newRecordingExecutor()
+	if err := m.Evaluate(exec).Err(); err != nil {
+		t.Fatalf("Failed to evaluate: %s", err.Error())
+	}
+	if !reflect.DeepEqual(exec.order, []string{"main.js"}) {
+		t.Errorf("Expected only main.js to be executed, got %v", exec.order)
+	}
+
+	binding := m.ImportBindings["config"]
+	if binding == nil || binding.BindingName != "default" || binding.Module.Type != MODULE_TYPE_JSON {
+		t.Fatalf("Expected config to be bound to the default export of the json module, got %v", binding)
+	}
+	if !binding.Module.Synthetic() {
+		t.Error("Expected the json module to be synthetic")
+	}
+	expected := JSONObject{{"name", "app"}, {"tags", []any{"a", "b"}}, {"b", float64(3)}, {"a", float64(2)}}
+	if !reflect.DeepEqual(binding.Module.Value, expected) {
+		t.Errorf("Expected %v, got %v", expected, binding.Module.Value)
+	}
+	if _, loaded := loader.Module("config.json"); loaded {
+		t.Error("Expected config.json not to be loaded as a JavaScript module")
+	}
+}
+
+func TestImportAttributes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"unknown.js": {Data: []byte(`import data from "./data.txt" with { type: "yaml" };`)},
+		"key.js":     {Data: []byte(`import data from "./data.txt" with { type: "json", integrity: "x" };`)},
+		"invalid.js": {Data: []byte(`import data from "./data.txt" with { type: "json" };`)},
+		"text.js":    {Data: []byte(`import text from "./data.txt" with { type: "text" }; import bytes from "./data.txt" with { type: "bytes" };`)},
+		"data.txt":   {Data: []byte(`hello`)},
+	}
+
+	for _, entry := range []string{"unknown.js", "key.js", "invalid.js"} {
+		_, err := NewLoader(fsys, nil).Load(entry)
+		if err == nil {
+			t.Errorf("Expected loading %s to fail", entry)
+		}
+	}
+
+	loader := NewLoader(fsys, nil)
+	loader.RegisterModuleType("text", ParseText)
+	loader.RegisterModuleType("bytes", ParseBytes)
+	m, err := loader.Load("text.js")
+	if err != nil {
+		t.Fatalf("Failed to load text.js: %s", err.Error())
+	}
+	if err := m.Link(); err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+	text, bytes := m.ImportBindings["text"].Module, m.ImportBindings["bytes"].Module
+	if text == bytes {
+		t.Fatal("Expected each module type to get its own module")
+	}
+	if text.Value != "hello" || !reflect.DeepEqual(bytes.Value, []byte("hello")) {
+		t.Errorf("Unexpected module values %v and %v", text.Value, bytes.Value)
+	}
+}
+
+func mapFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, source := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(source)}
+	}
+	return fsys
+}
+
+func TestNodeResolver(t *testing.T) {
+	fsys := mapFS(map[string]string{
+		"app/package.json":                               `{"name": "app", "exports": {"./util": "./lib/util.js"}, "imports": {"#config": {"node": "./config.node.js", "default": "./config.js"}, "#dep": "dep"}}`,
+		"app/main.js":                                    ``,
+		"app/lib/util.js":                                ``,
+		"app/lib/helper.js":                              ``,
+		"app/lib/dir/index.js":                           ``,
+		"app/data.json":                                  `{}`,
+		"app/config.js":                                  ``,
+		"app/config.node.js":                             ``,
+		"app/node_modules/dep/package.json":              `{"exports": {".": {"import": "./dep.mjs", "require": "./dep.cjs"}, "./features/*.js": "./src/features/*.js", "./features/private/*": null}}`,
+		"app/node_modules/dep/dep.mjs":                   ``,
+		"app/node_modules/dep/dep.cjs":                   ``,
+		"app/node_modules/dep/src/features/a.js":         ``,
+		"app/node_modules/dep/src/features/private/b.js": ``,
+		"node_modules/legacy/package.json":               `{"main": "./lib/main"}`,
+		"node_modules/legacy/lib/main.js":                ``,
+		"node_modules/legacy/other.js":                   ``,
+		"node_modules/@scope/pkg/index.js":               ``,
+	})
+
+	tests := []struct {
+		resolver  *NodeResolver
+		specifier string
+		expected  string
+	}{
+		{NewRequireResolver(fsys), "./lib/helper", "app/lib/helper.js"},
+		{NewRequireResolver(fsys), "./data", "app/data.json"},
+		{NewRequireResolver(fsys), "./lib/dir", "app/lib/dir/index.js"},
+		{NewRequireResolver(fsys), "dep", "app/node_modules/dep/dep.cjs"},
+		{NewImportResolver(fsys), "dep", "app/node_modules/dep/dep.mjs"},
+		{NewImportResolver(fsys), "dep/features/a.js", "app/node_modules/dep/src/features/a.js"},
+		{NewImportResolver(fsys), "legacy", "node_modules/legacy/lib/main.js"},
+		{NewImportResolver(fsys), "legacy/other.js", "node_modules/legacy/other.js"},
+		{NewRequireResolver(fsys), "@scope/pkg", "node_modules/@scope/pkg/index.js"},
+		{NewImportResolver(fsys), "app/util", "app/lib/util.js"},
+		{NewImportResolver(fsys), "#config", "app/config.node.js"},
+		{NewRequireResolver(fsys), "#dep", "app/node_modules/dep/dep.cjs"},
+	}
+	for _, test := range tests {
+		resolved, err := test.resolver.Resolve(test.specifier, "app/main.js")
+		if err != nil {
+			t.Errorf("Failed to resolve %s: %s", test.specifier, err.Error())
+			continue
+		}
+		if resolved != test.expected {
+			t.Errorf("Expected %s to resolve to %s, got %s", test.specifier, test.expected, resolved)
+		}
+	}
+
+	for _, specifier := range []string{"./lib/helper", "./lib/dir", "dep/package.json", "dep/features/private/b.js", "app/lib/helper.js", "#missing", "missing"} {
+		if resolved, err := NewImportResolver(fsys).Resolve(specifier, "app/main.js"); err == nil {
+			t.Errorf("Expected %s not to resolve, got %s", specifier, resolved)
+		}
+	}
+}
+
+func TestNodeFormat(t *testing.T) {
+	resolver := NewImportResolver(mapFS(map[string]string{
+		"esm/package.json": `{"type": "module"}`,
+		"esm/a.js":         ``,
+		"esm/b.cjs":        ``,
+		"cjs/a.js":         ``,
+		"cjs/b.mjs":        ``,
+	}))
+	for name, expected := range map[string]string{
+		"esm/a.js":  FORMAT_MODULE,
+		"esm/b.cjs": FORMAT_COMMONJS,
+		"cjs/a.js":  FORMAT_COMMONJS,
+		"cjs/b.mjs": FORMAT_MODULE,
+		"x.json":    FORMAT_JSON,
+	} {
+		if format := resolver.Format(name); format != expected {
+			t.Errorf("Expected %s to be %s, got %s", name, expected, format)
+		}
+	}
+}
+
+func TestCommonJSExports(t *testing.T) {
+	ast, err := parser.GetAst([]byte(`
+		exports.a = 1;
+		module.exports.b = 2;
+		exports["c"] = 3;
+		Object.defineProperty(exports, "d", { value: 4 });
+		if (x) module.exports = { e, f: 5, "g": 6, ...require("./h") };
+		module.exports = require("./i");
+		exports.a += 1;
+		other.z = 1;
+		return;
+	`), &parser.Options{AllowReturnOutsideFunction: true}, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse: %s", err.Error())
+	}
+
+	names, reexports := commonJSExports(ast)
+	if !reflect.DeepEqual(names, []string{"a", "b", "c", "d", "e", "f", "g"}) {
+		t.Errorf("Unexpected export names %v", names)
+	}
+	if !reflect.DeepEqual(reexports, []string{"./h", "./i"}) {
+		t.Errorf("Unexpected reexports %v", reexports)
+	}
+}
+
+// commonJSExecutor runs CommonJS modules with Go funcs standing in for their
+// bodies, and ES modules like recordingExecutor
+type commonJSExecutor struct {
+	*recordingExecutor
+	bodies map[string]func(exports map[string]any, require func(string) (any, error)) error
+}
+
+func (e *commonJSExecutor) ExecuteCommonJS(m *CommonJSModule, require func(string) (any, error)) error {
+	e.order = append(e.order, m.Path)
+	return e.bodies[m.Path](m.Exports.(map[string]any), require)
+}
+
+func TestRequire(t *testing.T) {
+	fsys := mapFS(map[string]string{
+		"main.cjs":   `const a = require("./a.cjs");`,
+		"a.cjs":      `exports.done = false; const b = require("./b.cjs"); exports.done = true;`,
+		"b.cjs":      `const a = require("./a.cjs"); exports.sawA = a.done;`,
+		"data.json":  `[1, {"b": 1, "a": 2}]`,
+		"broken.cjs": `throw new Error();`,
+		"lib.mjs":    `export const x = 1;`,
+		"tla.mjs":    `await null;`,
+	})
+	loader := NewLoader(fsys, nil)
+
+	exec := &commonJSExecutor{recordingExecutor: newRecordingExecutor()}
+	exec.bodies = map[string]func(map[string]any, func(string) (any, error)) error{
+		"main.cjs": func(exports map[string]any, require func(string) (any, error)) error {
+			_, err := require("./a.cjs")
+			return err
+		},
+		"a.cjs": func(exports map[string]any, require func(string) (any, error)) error {
+			exports["done"] = false
+			if _, err := require("./b.cjs"); err != nil {
+				return err
+			}
+			exports["done"] = true
+			return nil
+		},
+		"b.cjs": func(exports map[string]any, require func(string) (any, error)) error {
+			a, err := require("./a.cjs")
+			if err != nil {
+				return err
+			}
+			exports["sawA"] = a.(map[string]any)["done"]
+			return nil
+		},
+		"broken.cjs": func(exports map[string]any, require func(string) (any, error)) error {
+			return errors.New("broken")
+		},
+	}
+
+	if _, err := loader.Require("/main.cjs", nil, exec); err != nil {
+		t.Fatalf("Failed to require: %s", err.Error())
+	}
+	if !reflect.DeepEqual(exec.order, []string{"main.cjs", "a.cjs", "b.cjs"}) {
+		t.Errorf("Unexpected execution order %v", exec.order)
+	}
+	b, _ := loader.Require("/b.cjs", nil, exec)
+	if b.(map[string]any)["sawA"] != false {
+		t.Error("Expected b.cjs to see the partial exports of a.cjs")
+	}
+	if len(exec.order) != 3 {
+		t.Error("Expected required modules to be cached")
+	}
+	main := loader.commonJSModules["main.cjs"]
+	if !main.Loaded || len(main.Children) != 1 || main.Children[0].Path != "a.cjs" {
+		t.Errorf("Unexpected module tree %v", main.Children)
+	}
+
+	data, err := loader.Require("/data.json", nil, exec)
+	if err != nil || !reflect.DeepEqual(data, []any{1.0, JSONObject{{"b", 1.0}, {"a", 2.0}}}) {
+		t.Errorf("Unexpected json module %v (%v)", data, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := loader.Require("/broken.cjs", nil, exec); err == nil {
+			t.Error("Expected requiring broken.cjs to fail")
+		}
+	}
+	if exec.order[len(exec.order)-1] != "broken.cjs" || exec.order[len(exec.order)-2] != "broken.cjs" {
+		t.Error("Expected a module that threw to run again")
+	}
+
+	ns, err := loader.Require("/lib.mjs", nil, exec)
+	if err != nil || !reflect.DeepEqual(ns.(*Namespace).Exports, []string{"x"}) {
+		t.Errorf("Expected the namespace of lib.mjs, got %v (%v)", ns, err)
+	}
+	if _, err := loader.Require("/tla.mjs", nil, exec); err == nil {
+		t.Error("Expected requiring an ES module with top-level await to fail")
+	}
+}
+
+func TestImportCommonJS(t *testing.T) {
+	fsys := mapFS(map[string]string{
+		"main.mjs":                      `import lib, { named } from "lib"; import * as ns from "./local.js";`,
+		"local.js":                      `module.exports = { local: 1, ...require("./more") };`,
+		"more.js":                       `exports.more = 2;`,
+		"node_modules/lib/package.json": `{"main": "index.js"}`,
+		"node_modules/lib/index.js":     `exports.named = function () {};`,
+	})
+	resolver := NewImportResolver(fsys)
+	loader := NewLoader(fsys, resolver)
+	loader.RequireResolver = NewRequireResolver(fsys)
+	loader.Format = resolver.Format
+
+	m, err := loader.Load("main.mjs")
+	if err != nil {
+		t.Fatalf("Failed to load: %s", err.Error())
+	}
+	if err := m.Link(); err != nil {
+		t.Fatalf("Failed to link: %s", err.Error())
+	}
+
+	lib := m.ImportBindings["lib"].Module
+	if lib.Type != MODULE_TYPE_COMMONJS || m.ImportBindings["lib"].BindingName != "default" || m.ImportBindings["named"].BindingName != "named" {
+		t.Errorf("Unexpected bindings %v", m.ImportBindings)
+	}
+	if lib.Synthetic() {
+		t.Error("Expected the CommonJS facade not to be synthetic")
+	}
+	if !reflect.DeepEqual(m.ImportBindings["ns"].Module.GetNamespace().Exports, []string{"default", "local", "more"}) {
+		t.Errorf("Unexpected namespace %v", m.ImportBindings["ns"].Module.GetNamespace().Exports)
+	}
+
+	exec := &commonJSExecutor{recordingExecutor: newRecordingExecutor()}
+	exec.bodies = map[string]func(map[string]any, func(string) (any, error)) error{
+		"node_modules/lib/index.js": func(exports map[string]any, require func(string) (any, error)) error {
+			exports["named"] = "fn"
+			return nil
+		},
+		"local.js": func(exports map[string]any, require func(string) (any, error)) error {
+			_, err := require("./more")
+			return err
+		},
+		"more.js": func(exports map[string]any, require func(string) (any, error)) error { return nil },
+	}
+	if err := m.Evaluate(exec).Err(); err != nil {
+		t.Fatalf("Failed to evaluate: %s", err.Error())
+	}
+	if !reflect.DeepEqual(exec.order, []string{"node_modules/lib/index.js", "local.js", "more.js", "main.mjs"}) {
+		t.Errorf("Unexpected evaluation order %v", exec.order)
+	}
+	if !reflect.DeepEqual(lib.Value, map[string]any{"named": "fn"}) {
+		t.Errorf("Expected the default export to be module.exports, got %v", lib.Value)
+	}
+}
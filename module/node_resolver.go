@@ -0,0 +1,541 @@
+package module
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Module formats, the format of a file decides which loader handles it
+const (
+	FORMAT_MODULE   = "module"
+	FORMAT_COMMONJS = "commonjs"
+	FORMAT_JSON     = "json"
+)
+
+// NodeResolver implements Node's resolution algorithm on top of a file system:
+// node_modules lookup, package.json "main", "exports" and "imports", and file
+// extension probing. Conditions are matched against conditional exports in the
+// order the package lists them, "default" always matches.
+type NodeResolver struct {
+	FS         fs.FS
+	Conditions []string
+
+	// Extensions are tried in order when a relative specifier or a subpath
+	// doesn't name a file. Empty for import, which requires full paths.
+	Extensions []string
+
+	packages map[string]*packageJSON
+}
+
+// NewImportResolver resolves specifiers the way Node resolves `import`
+func NewImportResolver(fsys fs.FS) *NodeResolver {
+	return &NodeResolver{FS: fsys, Conditions: []string{"node", "import"}, packages: map[string]*packageJSON{}}
+}
+
+// NewRequireResolver resolves specifiers the way Node resolves `require()`
+func NewRequireResolver(fsys fs.FS) *NodeResolver {
+	return &NodeResolver{
+		FS:         fsys,
+		Conditions: []string{"node", "require"},
+		Extensions: []string{".js", ".json"},
+		packages:   map[string]*packageJSON{},
+	}
+}
+
+// Extensions probed when loading the "main" of a package without "exports",
+// Node does this for import too
+var legacyMainExtensions = []string{".js", ".json"}
+
+type packageJSON struct {
+	dir     string
+	Name    string
+	Main    string
+	Type    string
+	Exports any
+	Imports any
+}
+
+func (r *NodeResolver) Resolve(specifier string, referrer string) (string, error) {
+	switch {
+	case strings.HasPrefix(specifier, "/"):
+		return r.resolvePath(path.Clean(strings.TrimLeft(specifier, "/")), specifier, referrer)
+	case specifier == "." || specifier == ".." || strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../"):
+		resolved := path.Join(path.Dir(referrer), specifier)
+		if !fs.ValidPath(resolved) {
+			return "", fmt.Errorf("Cannot find module '%s' from '%s'", specifier, referrer)
+		}
+		return r.resolvePath(resolved, specifier, referrer)
+	case strings.HasPrefix(specifier, "#"):
+		return r.resolveImports(specifier, referrer)
+	}
+	return r.resolvePackage(specifier, referrer)
+}
+
+// Format returns whether the file at name is an ES module, CommonJS or JSON.
+// .mjs and .cjs files say so themselves, other files follow the "type" of the
+// closest package.json, which defaults to commonjs.
+func (r *NodeResolver) Format(name string) string {
+	switch path.Ext(name) {
+	case ".mjs":
+		return FORMAT_MODULE
+	case ".cjs":
+		return FORMAT_COMMONJS
+	case ".json":
+		return FORMAT_JSON
+	}
+	pkg, err := r.packageScope(path.Dir(name))
+	if err == nil && pkg != nil && pkg.Type == "module" {
+		return FORMAT_MODULE
+	}
+	return FORMAT_COMMONJS
+}
+
+func (r *NodeResolver) resolvePath(name string, specifier string, referrer string) (string, error) {
+	if r.isFile(name) {
+		return name, nil
+	}
+	if len(r.Extensions) == 0 {
+		if r.isDir(name) {
+			return "", fmt.Errorf("Directory import '%s' is not supported (imported from '%s')", specifier, referrer)
+		}
+		return "", fmt.Errorf("Cannot find module '%s' from '%s'", specifier, referrer)
+	}
+
+	if resolved, found := r.probeFile(name, r.Extensions); found {
+		return resolved, nil
+	}
+	if r.isDir(name) {
+		resolved, err := r.loadDirectory(name)
+		if err != nil {
+			return "", err
+		}
+		if resolved != "" {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("Cannot find module '%s' from '%s'", specifier, referrer)
+}
+
+// probeFile is LOAD_AS_FILE, it tries name and name with each extension
+func (r *NodeResolver) probeFile(name string, extensions []string) (string, bool) {
+	if r.isFile(name) {
+		return name, true
+	}
+	for _, ext := range extensions {
+		if r.isFile(name + ext) {
+			return name + ext, true
+		}
+	}
+	return "", false
+}
+
+// loadDirectory is LOAD_AS_DIRECTORY, it follows "main" and then falls back to
+// index files. It returns an empty string when nothing is found.
+func (r *NodeResolver) loadDirectory(dir string) (string, error) {
+	pkg, err := r.readPackage(dir)
+	if err != nil {
+		return "", err
+	}
+	if pkg != nil && pkg.Main != "" {
+		main := path.Join(dir, pkg.Main)
+		if resolved, found := r.probeFile(main, legacyMainExtensions); found {
+			return resolved, nil
+		}
+		if resolved, found := r.probeFile(path.Join(main, "index"), legacyMainExtensions); found {
+			return resolved, nil
+		}
+	}
+	if resolved, found := r.probeFile(path.Join(dir, "index"), legacyMainExtensions); found {
+		return resolved, nil
+	}
+	return "", nil
+}
+
+func (r *NodeResolver) resolvePackage(specifier string, referrer string) (string, error) {
+	name, subpath, err := parsePackageSpecifier(specifier)
+	if err != nil {
+		return "", err
+	}
+
+	// A package can import itself by name through its own "exports"
+	scope, err := r.packageScope(path.Dir(referrer))
+	if err != nil {
+		return "", err
+	}
+	if scope != nil && scope.Name == name && scope.Exports != nil {
+		return r.resolveExports(scope, subpath, specifier)
+	}
+
+	dir := path.Dir(referrer)
+	for {
+		pkgDir := path.Join(dir, "node_modules", name)
+		if r.isDir(pkgDir) {
+			pkg, err := r.readPackage(pkgDir)
+			if err != nil {
+				return "", err
+			}
+			if pkg != nil && pkg.Exports != nil {
+				return r.resolveExports(pkg, subpath, specifier)
+			}
+			if subpath == "." {
+				resolved, err := r.loadDirectory(pkgDir)
+				if err != nil {
+					return "", err
+				}
+				if resolved != "" {
+					return resolved, nil
+				}
+				return "", fmt.Errorf("Cannot find module '%s' from '%s'", specifier, referrer)
+			}
+			return r.resolvePath(path.Join(pkgDir, subpath), specifier, referrer)
+		}
+		if dir == "." {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+	return "", fmt.Errorf("Cannot find module '%s' from '%s'", specifier, referrer)
+}
+
+// parsePackageSpecifier splits a bare specifier into the package name and the
+// subpath inside the package, "@scope/pkg/lib/x.js" gives "@scope/pkg" and
+// "./lib/x.js"
+func parsePackageSpecifier(specifier string) (string, string, error) {
+	parts := strings.SplitN(specifier, "/", 3)
+	nameParts := 1
+	if strings.HasPrefix(specifier, "@") {
+		if len(parts) < 2 || parts[1] == "" {
+			return "", "", fmt.Errorf("Invalid module specifier '%s'", specifier)
+		}
+		nameParts = 2
+	}
+	name := strings.Join(parts[:min(nameParts, len(parts))], "/")
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, "\\%") {
+		return "", "", fmt.Errorf("Invalid module specifier '%s'", specifier)
+	}
+	return name, "." + specifier[len(name):], nil
+}
+
+// resolveExports is PACKAGE_EXPORTS_RESOLVE
+func (r *NodeResolver) resolveExports(pkg *packageJSON, subpath string, specifier string) (string, error) {
+	exports := pkg.Exports
+	obj, isObject := exports.(JSONObject)
+	if isObject && !obj.hasSubpathKeys() {
+		// Conditions of the main export, `"exports": { "import": "./x.mjs" }`
+		exports = JSONObject{{Key: ".", Value: obj}}
+	} else if !isObject {
+		exports = JSONObject{{Key: ".", Value: exports}}
+	}
+
+	resolved, err := r.resolveImportsExports(subpath, exports.(JSONObject), pkg, false)
+	if err != nil {
+		return "", err
+	}
+	if resolved == "" {
+		return "", fmt.Errorf("Package subpath '%s' is not defined by \"exports\" in %s (importing '%s')", subpath, path.Join(pkg.dir, "package.json"), specifier)
+	}
+	if !r.isFile(resolved) {
+		return "", fmt.Errorf("Cannot find module '%s' resolved from '%s'", resolved, specifier)
+	}
+	return resolved, nil
+}
+
+// resolveImports is PACKAGE_IMPORTS_RESOLVE, for "#name" specifiers mapped by
+// the "imports" of the referrer's package
+func (r *NodeResolver) resolveImports(specifier string, referrer string) (string, error) {
+	if specifier == "#" || strings.HasPrefix(specifier, "#/") {
+		return "", fmt.Errorf("Invalid module specifier '%s'", specifier)
+	}
+	pkg, err := r.packageScope(path.Dir(referrer))
+	if err != nil {
+		return "", err
+	}
+	if pkg != nil {
+		if imports, ok := pkg.Imports.(JSONObject); ok {
+			resolved, err := r.resolveImportsExports(specifier, imports, pkg, true)
+			if err != nil {
+				return "", err
+			}
+			if resolved != "" {
+				if !r.isFile(resolved) {
+					return "", fmt.Errorf("Cannot find module '%s' resolved from '%s'", resolved, specifier)
+				}
+				return resolved, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Package import specifier '%s' is not defined (imported from '%s')", specifier, referrer)
+}
+
+// resolveImportsExports is PACKAGE_IMPORTS_EXPORTS_RESOLVE, it looks matchKey
+// up in an "exports" or "imports" map, trying exact keys before patterns
+func (r *NodeResolver) resolveImportsExports(matchKey string, matchObj JSONObject, pkg *packageJSON, isImports bool) (string, error) {
+	if target, found := matchObj.get(matchKey); found && !strings.Contains(matchKey, "*") {
+		return r.resolveTarget(target, "", pkg, isImports)
+	}
+
+	patterns := []string{}
+	for _, member := range matchObj {
+		if strings.Count(member.Key, "*") == 1 {
+			patterns = append(patterns, member.Key)
+		}
+	}
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patternKeyCompare(patterns[i], patterns[j]) < 0
+	})
+
+	for _, key := range patterns {
+		star := strings.Index(key, "*")
+		base, trailer := key[:star], key[star+1:]
+		if !strings.HasPrefix(matchKey, base) || matchKey == base {
+			continue
+		}
+		if trailer != "" && (!strings.HasSuffix(matchKey, trailer) || len(matchKey) < len(key)) {
+			continue
+		}
+		target, _ := matchObj.get(key)
+		return r.resolveTarget(target, matchKey[len(base):len(matchKey)-len(trailer)], pkg, isImports)
+	}
+	return "", nil
+}
+
+// patternKeyCompare orders pattern keys so the most specific one comes first,
+// see PATTERN_KEY_COMPARE
+func patternKeyCompare(a, b string) int {
+	baseA, baseB := strings.Index(a, "*")+1, strings.Index(b, "*")+1
+	if baseA != baseB {
+		return baseB - baseA
+	}
+	return len(b) - len(a)
+}
+
+// resolveTarget is PACKAGE_TARGET_RESOLVE. An empty result without error
+// means the target is null or no condition matched.
+func (r *NodeResolver) resolveTarget(target any, patternMatch string, pkg *packageJSON, isImports bool) (string, error) {
+	switch target := target.(type) {
+	case string:
+		if !strings.HasPrefix(target, "./") {
+			if isImports && !strings.HasPrefix(target, "../") && !strings.HasPrefix(target, "/") {
+				// "imports" can map to other packages
+				return r.resolvePackage(strings.ReplaceAll(target, "*", patternMatch), path.Join(pkg.dir, "package.json"))
+			}
+			return "", fmt.Errorf("Invalid package target '%s' in %s", target, path.Join(pkg.dir, "package.json"))
+		}
+		for _, segment := range strings.Split(target[2:], "/") {
+			if segment == "." || segment == ".." || segment == "node_modules" {
+				return "", fmt.Errorf("Invalid package target '%s' in %s", target, path.Join(pkg.dir, "package.json"))
+			}
+		}
+		for _, segment := range strings.Split(patternMatch, "/") {
+			if segment == "." || segment == ".." || segment == "node_modules" {
+				return "", fmt.Errorf("Invalid module specifier '%s' for package %s", patternMatch, path.Join(pkg.dir, "package.json"))
+			}
+		}
+		return path.Join(pkg.dir, strings.ReplaceAll(target, "*", patternMatch)), nil
+
+	case []any:
+		var lastErr error
+		for _, alternative := range target {
+			resolved, err := r.resolveTarget(alternative, patternMatch, pkg, isImports)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if resolved != "" {
+				return resolved, nil
+			}
+		}
+		return "", lastErr
+
+	case JSONObject:
+		for _, member := range target {
+			if member.Key != "default" && !r.hasCondition(member.Key) {
+				continue
+			}
+			resolved, err := r.resolveTarget(member.Value, patternMatch, pkg, isImports)
+			if err != nil {
+				return "", err
+			}
+			if resolved != "" {
+				return resolved, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (r *NodeResolver) hasCondition(condition string) bool {
+	for _, c := range r.Conditions {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// packageScope finds the closest package.json at or above dir
+func (r *NodeResolver) packageScope(dir string) (*packageJSON, error) {
+	for {
+		if path.Base(dir) == "node_modules" {
+			return nil, nil
+		}
+		pkg, err := r.readPackage(dir)
+		if err != nil || pkg != nil {
+			return pkg, err
+		}
+		if dir == "." {
+			return nil, nil
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// readPackage reads dir/package.json, it returns nil when there's none
+func (r *NodeResolver) readPackage(dir string) (*packageJSON, error) {
+	if pkg, found := r.packages[dir]; found {
+		return pkg, nil
+	}
+
+	source, err := fs.ReadFile(r.FS, path.Join(dir, "package.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		r.packages[dir] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := decodeOrderedJSON(source)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid package config %s: %w", path.Join(dir, "package.json"), err)
+	}
+	pkg := &packageJSON{dir: dir}
+	if obj, ok := value.(JSONObject); ok {
+		for _, member := range obj {
+			switch member.Key {
+			case "name":
+				pkg.Name, _ = member.Value.(string)
+			case "main":
+				pkg.Main, _ = member.Value.(string)
+			case "type":
+				pkg.Type, _ = member.Value.(string)
+			case "exports":
+				pkg.Exports = member.Value
+			case "imports":
+				pkg.Imports = member.Value
+			}
+		}
+	}
+	if obj, ok := pkg.Exports.(JSONObject); ok {
+		for _, member := range obj {
+			if strings.HasPrefix(member.Key, ".") != obj.hasSubpathKeys() {
+				return nil, fmt.Errorf("Invalid package config %s: \"exports\" cannot mix subpaths and conditions", path.Join(dir, "package.json"))
+			}
+		}
+	}
+
+	r.packages[dir] = pkg
+	return pkg, nil
+}
+
+func (r *NodeResolver) isFile(name string) bool {
+	info, err := fs.Stat(r.FS, name)
+	return err == nil && !info.IsDir()
+}
+
+func (r *NodeResolver) isDir(name string) bool {
+	info, err := fs.Stat(r.FS, name)
+	return err == nil && info.IsDir()
+}
+
+// JSONObject keeps the members of a JSON object in source order, like
+// JSON.parse does. Conditional exports are matched in the order the package
+// lists them, and json modules keep the order of their keys.
+type JSONObject []JSONMember
+
+type JSONMember struct {
+	Key   string
+	Value any
+}
+
+func (o JSONObject) get(key string) (any, bool) {
+	if i := o.index(key); i >= 0 {
+		return o[i].Value, true
+	}
+	return nil, false
+}
+
+func (o JSONObject) index(key string) int {
+	for i, member := range o {
+		if member.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (o JSONObject) hasSubpathKeys() bool {
+	return len(o) > 0 && strings.HasPrefix(o[0].Key, ".")
+}
+
+// decodeOrderedJSON decodes like json.Unmarshal into any, except that objects
+// become JSONObject instead of maps
+func decodeOrderedJSON(source []byte) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(string(source)))
+	value, err := decodeOrderedValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+func decodeOrderedValue(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := JSONObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			// A repeated key keeps its first position and its last value
+			if i := obj.index(key.(string)); i >= 0 {
+				obj[i].Value = value
+			} else {
+				obj = append(obj, JSONMember{Key: key.(string), Value: value})
+			}
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return token, nil
+}
@@ -2,8 +2,11 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"regexp"
 	"strings"
+
+	"go_js/jsstring"
 )
 
 // EXPRESSION PARSING
@@ -24,10 +27,13 @@ func (p *Parser) checkPropClash(prop *Node, propHash *PropertyHash, refDestructu
 	case NODE_IDENTIFIER:
 		name = key.Name
 	case NODE_LITERAL:
-		if val, ok := key.Value.(string); ok {
+		switch val := key.Value.(type) {
+		case string:
 			name = val
-		} else {
-			panic("Node was incorrectly typed expected string value from NODE_LITERAL")
+		case jsstring.String:
+			name = val.String()
+		default:
+			name = fmt.Sprint(val)
 		}
 	default:
 		return nil
@@ -102,6 +108,10 @@ func (p *Parser) parseExpression(forInit string, refDestructuringErrors *Destruc
 func (p *Parser) parseMaybeAssign(forInit string, refDestructuringErrors *DestructuringErrors, afterLeftParse *struct {
 	call func(p *Parser, l *Node, s int, sl *Location) (*Node, error)
 }) (*Node, error) {
+	if err := p.enterDepth(); err != nil {
+		return nil, err
+	}
+	defer p.exitDepth()
 	if p.isContextual("yield") {
 		if p.inGenerator() {
 			yield, err := p.parseYield(forInit)
@@ -241,7 +251,7 @@ func (p *Parser) parseMaybeConditional(forInit string, refDestructuringErrors *D
 
 		errExpect := p.expect(TOKEN_COLON)
 		if errExpect != nil {
-			return nil, err
+			return nil, errExpect
 		}
 
 		maybeAssignElse, errElse := p.parseMaybeAssign(forInit, nil, nil)
@@ -472,6 +482,10 @@ func (p *Parser) buildBinary(startPos int, startLoc *Location, left *Node, right
 }
 
 func (p *Parser) parseMaybeUnary(refDestructuringErrors *DestructuringErrors, sawUnary bool, incDec bool, forInit string) (*Node, error) {
+	if err := p.enterDepth(); err != nil {
+		return nil, err
+	}
+	defer p.exitDepth()
 	startPos, startLoc := p.start, p.startLoc
 	var expr *Node
 	var err error
@@ -484,11 +498,7 @@ func (p *Parser) parseMaybeUnary(refDestructuringErrors *DestructuringErrors, sa
 		sawUnary = true
 	} else if p.Type.prefix {
 		node, update := p.startNode(), p.Type.identifier == TOKEN_INCDEC
-		if uop, ok := p.Value.([]byte); ok {
-			node.UnaryOperator = UnaryOperator(uop)
-		} else {
-			panic("p.Value was not []byte as expected")
-		}
+		node.UnaryOperator = UnaryOperator(p.operator())
 
 		node.Prefix = true
 		p.next(false)
@@ -527,8 +537,8 @@ func (p *Parser) parseMaybeUnary(refDestructuringErrors *DestructuringErrors, sa
 		}
 
 	} else if !sawUnary && p.Type.identifier == TOKEN_PRIVATEID {
-		if len(forInit) != 0 || len(p.PrivateNameStack) == 0 && p.options.CheckPrivateFields {
-			return nil, p.unexpected(`len(forInit) != 0 || len(p.PrivateNameStack) == 0 && p.options.CheckPrivateFields`, &p.pos)
+		if len(forInit) != 0 || len(p.PrivateNameStack) == 0 && !p.options.AllowUndeclaredPrivateFields {
+			return nil, p.unexpected(`len(forInit) != 0 || len(p.PrivateNameStack) == 0 && !p.options.AllowUndeclaredPrivateFields`, &p.pos)
 		}
 		expr, err = p.parsePrivateIdent()
 		if err != nil {
@@ -614,49 +624,56 @@ func (p *Parser) parseExprOps(forInit string, refDestructuringErrors *Destructur
 }
 
 func (p *Parser) parseExprOp(left *Node, leftStartPos int, leftStartLoc *Location, minPrec int, forInit string) (*Node, error) {
-	if p.Type.binop != nil && (len(forInit) == 0 || p.Type.identifier != TOKEN_IN) {
+	// Operators of the same or lower precedence chain to the left, a loop
+	// instead of recursing keeps long chains like a + b + … off the stack
+	for p.Type.binop != nil && (len(forInit) == 0 || p.Type.identifier != TOKEN_IN) {
 		prec := p.Type.binop.prec
-		if p.Type.binop.prec > minPrec {
-			logical := p.Type.identifier == TOKEN_LOGICALOR || p.Type.identifier == TOKEN_LOGICALAND
-			coalesce := p.Type.identifier == TOKEN_COALESCE
-			if coalesce {
-				// Handle the precedence of `tt.coalesce` as equal to the range of logical expressions.
-				// In other words, `node.right` shouldn't contain logical expressions in order to check the mixed error.
-				prec = tokenTypes[TOKEN_LOGICALAND].binop.prec
-			}
-			if op, ok := p.Value.([]byte); ok {
-				p.next(false)
-				startPos, startLoc := p.start, p.startLoc
-				unary, err := p.parseMaybeUnary(nil, false, false, forInit)
-				if err != nil {
-					return nil, err
-				}
-				right, err := p.parseExprOp(unary, startPos, startLoc, prec, forInit)
-
-				if err != nil {
-					return nil, err
-				}
-				node, err := p.buildBinary(leftStartPos, leftStartLoc, left, right, BinaryOperator(op), logical || coalesce)
-				if err != nil {
-					return nil, err
-				}
-				if (logical && p.Type.identifier == TOKEN_COALESCE) || (coalesce && (p.Type.identifier == TOKEN_LOGICALOR || p.Type.identifier == TOKEN_LOGICALAND)) {
-					return nil, p.raiseRecoverable(p.start, "Logical expressions and coalesce expressions cannot be mixed. Wrap either by parentheses")
-				}
-				expr, err := p.parseExprOp(node, leftStartPos, leftStartLoc, minPrec, forInit)
-				if err != nil {
-					return nil, err
-				}
-				return expr, nil
-			} else {
-				panic("Node had invalid operator as Value, expected []byte")
-			}
-
+		if p.Type.binop.prec <= minPrec {
+			break
+		}
+		logical := p.Type.identifier == TOKEN_LOGICALOR || p.Type.identifier == TOKEN_LOGICALAND
+		coalesce := p.Type.identifier == TOKEN_COALESCE
+		if coalesce {
+			// Handle the precedence of `tt.coalesce` as equal to the range of logical expressions.
+			// In other words, `node.right` shouldn't contain logical expressions in order to check the mixed error.
+			prec = tokenTypes[TOKEN_LOGICALAND].binop.prec
+		}
+		op := p.operator()
+		p.next(false)
+		startPos, startLoc := p.start, p.startLoc
+		unary, err := p.parseMaybeUnary(nil, false, false, forInit)
+		if err != nil {
+			return nil, err
+		}
+		right, err := p.parseExprOp(unary, startPos, startLoc, prec, forInit)
+		if err != nil {
+			return nil, err
+		}
+		node, err := p.buildBinary(leftStartPos, leftStartLoc, left, right, BinaryOperator(op), logical || coalesce)
+		if err != nil {
+			return nil, err
 		}
+		if (logical && p.Type.identifier == TOKEN_COALESCE) || (coalesce && (p.Type.identifier == TOKEN_LOGICALOR || p.Type.identifier == TOKEN_LOGICALAND)) {
+			return nil, p.raiseRecoverable(p.start, "Logical expressions and coalesce expressions cannot be mixed. Wrap either by parentheses")
+		}
+		left = node
 	}
 	return left, nil
 }
 
+// operator is the text of the current operator token. Punctuators carry
+// their bytes as the value, keyword operators like typeof and instanceof
+// carry the word.
+func (p *Parser) operator() string {
+	switch value := p.Value.(type) {
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	}
+	panic("Operator token had an invalid Value, expected []byte or string")
+}
+
 func isPrivateFieldAccess(node *Node) bool {
 	return node.Type == NODE_MEMBER_EXPRESSION && node.Property.Type == NODE_PRIVATE_IDENTIFIER ||
 		node.Type == NODE_CHAIN_EXPRESSION && isPrivateFieldAccess(node.Expression) ||
@@ -726,25 +743,24 @@ func (p *Parser) parseTemplate(opts struct{ isTagged bool }) (*Node, error) {
 
 func (p *Parser) parseTemplateElement(opts struct{ isTagged bool }) (*Node, error) {
 	elem := p.startNode()
+	if p.Type.identifier != TOKEN_TEMPLATE && p.Type.identifier != TOKEN_INVALIDTEMPLATE {
+		// An unterminated template ends the input
+		return nil, p.unexpected("", nil)
+	}
 	if p.Type.identifier == TOKEN_INVALIDTEMPLATE {
 		if !opts.isTagged {
 			return nil, p.raiseRecoverable(p.start, "Bad escape sequence in untagged template literal")
 		}
 
-		elem.Value = struct {
-			raw    string
-			cooked string
-		}{
-			raw:    strings.ReplaceAll(string(p.Value.([]byte)), "\r\n", "\n"),
-			cooked: "",
+		elem.TmplValue = &TemplateValue{
+			Raw:    strings.ReplaceAll(string(p.Value.([]byte)), "\r\n", "\n"),
+			Cooked: nil,
 		}
 	} else {
-		elem.Value = struct {
-			raw    string
-			cooked string
-		}{
-			raw:    strings.ReplaceAll(string(p.input[p.start:p.End]), "\r\n", "\n"),
-			cooked: string(p.Value.([]byte)),
+		cooked := p.Value.(jsstring.String)
+		elem.TmplValue = &TemplateValue{
+			Raw:    strings.ReplaceAll(string(p.input[p.start:p.End]), "\r\n", "\n"),
+			Cooked: &cooked,
 		}
 	}
 	p.next(false)
@@ -760,6 +776,10 @@ func (p *Parser) parseSubscriptAsyncArrow(startPos int, startLoc *Location, expr
 }
 
 func (p *Parser) parseExprAtom(refDestructuringErrors *DestructuringErrors, forInit string, forNew bool) (*Node, error) {
+	if err := p.enterDepth(); err != nil {
+		return nil, err
+	}
+	defer p.exitDepth()
 	// If a division operator appears in an expression position, the
 	// tokenizer got confused, and we force it to read a regexp instead.
 	if p.Type.identifier == TOKEN_SLASH {
@@ -836,13 +856,16 @@ func (p *Parser) parseExprAtom(refDestructuringErrors *DestructuringErrors, forI
 		return id, nil
 
 	case TOKEN_REGEXP:
-		panic("TOKEN_REGEXP not implemented")
-		/*
-			value := p.Value
-			node = p.parseLiteral(value.value)
-			node.regex = RegExpState{Pattern: value.pattern, flags: value.flags}
-			return node
-		*/
+		value, ok := p.Value.(*RegExpValue)
+		if !ok {
+			panic("In parseExprAtom() p.Value was not a regular expression as expected")
+		}
+		node, err := p.parseLiteral(value.Value)
+		if err != nil {
+			return nil, err
+		}
+		node.Regex = &Regex{Pattern: value.Pattern, Flags: value.Flags}
+		return node, nil
 
 	case TOKEN_NUM, TOKEN_STRING:
 		{
@@ -1187,7 +1210,7 @@ func (p *Parser) parseLiteral(value any) (*Node, error) {
 	node.Value = value
 
 	node.Raw = string(p.input[p.start:p.End])
-	if node.Raw[len(node.Raw)-1] == 110 { // big int stuff, maybe some day....
+	if _, ok := value.(*big.Int); ok {
 		node.Bigint = strings.ReplaceAll(node.Raw[:len(node.Raw)-1], "_", "")
 		// node.bigint = node.raw.slice(0, -1).replace(/_/g, "")
 	}
@@ -1209,7 +1232,7 @@ func (p *Parser) parsePrivateIdent() (*Node, error) {
 	p.next(false)
 	p.finishNode(node, NODE_PRIVATE_IDENTIFIER)
 
-	if p.options.CheckPrivateFields {
+	if !p.options.AllowUndeclaredPrivateFields {
 		if len(p.PrivateNameStack) == 0 {
 			p.raise(node.Start, "Private field #"+node.Name+" must be declared in an enclosing class")
 		} else {
@@ -1371,7 +1394,7 @@ func (p *Parser) parseParenExpression() (*Node, error) {
 	}
 	val, errParse := p.parseExpression("", nil)
 	if errParse != nil {
-		return nil, err
+		return nil, errParse
 	}
 	err = p.expect(TOKEN_PARENR)
 
@@ -269,6 +269,10 @@ func (p *Parser) parseRestBinding() (*Node, error) {
 }
 
 func (p *Parser) parseBindingAtom() (*Node, error) {
+	if err := p.enterDepth(); err != nil {
+		return nil, err
+	}
+	defer p.exitDepth()
 	if p.getEcmaVersion() >= 6 {
 		switch p.Type.identifier {
 		case TOKEN_BRACKETL:
@@ -3,6 +3,8 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+
+	"go_js/jsstring"
 )
 
 type SourceType int
@@ -369,9 +371,11 @@ func (n Node) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// TemplateValue holds the strings of a template element, Cooked is nil when
+// a tagged template has an invalid escape sequence
 type TemplateValue struct {
-	Cooked *string
-	Raw    string
+	Cooked *jsstring.String `json:"cooked"`
+	Raw    string           `json:"raw"`
 }
 
 func NewNode(parser *Parser, pos int, loc *Location) *Node {
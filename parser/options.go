@@ -1,71 +1,91 @@
 package parser
 
 type Options struct {
-	ecmaVersion                 interface{}
-	SourceType                  string
-	OnInsertedSemicolon         interface{}
-	OnTrailingComma             interface{}
-	AllowReserved               AllowReserved
-	AllowReturnOutsideFunction  bool
-	AllowImportExportEverywhere bool
-	AllowAwaitOutsideFunction   bool
-	AllowSuperOutsideMethod     bool
-	AllowHashBang               bool
-	CheckPrivateFields          bool
-	Locations                   bool
-	OnToken                     interface{} // function callback or array
-	OnComment                   interface{} // function callback or array
-	Ranges                      bool
-	Program                     interface{} // AST node type
-	SourceFile                  *string
-	DirectSourceFile            *string
-	PreserveParens              bool
+	ecmaVersion                  interface{}
+	SourceType                   string
+	OnInsertedSemicolon          interface{}
+	OnTrailingComma              interface{}
+	AllowReserved                AllowReserved
+	AllowReturnOutsideFunction   bool
+	AllowImportExportEverywhere  bool
+	AllowAwaitOutsideFunction    bool
+	AllowSuperOutsideMethod      bool
+	AllowNewDotTarget            bool // new.target at the top level, for direct eval in a function
+	AllowHashBang                bool // a #! line at the start, on in DefaultOptions
+	AllowUndeclaredPrivateFields bool // #x without a class declaring it, for debuggers
+	Locations                    bool
+	OnToken                      interface{} // function callback or array
+	OnComment                    interface{} // function callback or array
+	Ranges                       bool
+	Program                      interface{} // AST node type
+	SourceFile                   *string
+	DirectSourceFile             *string
+	PreserveParens               bool
+	Strict                       bool // strict mode without a directive, for direct eval in strict code
+	MaxDepth                     int  // how deep the parser may recurse, DEFAULT_MAX_DEPTH when 0
+	MaxInputSize                 int  // the largest input in bytes, unlimited when 0
 }
 
+// DEFAULT_MAX_DEPTH keeps deeply nested input like ((((…)))) from
+// overflowing the Go stack, which would crash the whole process. It counts
+// recursive parse steps, a parenthesized expression takes a few of them.
+const DEFAULT_MAX_DEPTH = 10000
+
 type AllowReserved uint8
 
+// ALLOW_RESERVED_FALSE is the zero value so it's the default
 const (
-	ALLOW_RESERVED_TRUE AllowReserved = iota
-	ALLOW_RESERVED_FALSE
+	ALLOW_RESERVED_FALSE AllowReserved = iota
+	ALLOW_RESERVED_TRUE
 	ALLOW_RESERVED_NEVER
 )
 
 var DefaultOptions = Options{
-	ecmaVersion:                 16,
-	SourceType:                  "script",
-	OnInsertedSemicolon:         nil,
-	OnTrailingComma:             nil,
-	AllowReserved:               ALLOW_RESERVED_FALSE,
-	AllowReturnOutsideFunction:  false,
-	AllowImportExportEverywhere: false,
-	AllowAwaitOutsideFunction:   false,
-	AllowSuperOutsideMethod:     false,
-	AllowHashBang:               false,
-	CheckPrivateFields:          true,
-	Locations:                   false,
-	OnToken:                     nil,
-	OnComment:                   nil,
-	Ranges:                      false,
-	Program:                     nil,
-	SourceFile:                  nil,
-	DirectSourceFile:            nil,
-	PreserveParens:              false,
+	ecmaVersion:                  16,
+	SourceType:                   "script",
+	OnInsertedSemicolon:          nil,
+	OnTrailingComma:              nil,
+	AllowReserved:                ALLOW_RESERVED_FALSE,
+	AllowReturnOutsideFunction:   false,
+	AllowImportExportEverywhere:  false,
+	AllowAwaitOutsideFunction:    false,
+	AllowSuperOutsideMethod:      false,
+	AllowNewDotTarget:            false,
+	AllowHashBang:                true,
+	AllowUndeclaredPrivateFields: false,
+	Locations:                    false,
+	OnToken:                      nil,
+	OnComment:                    nil,
+	Ranges:                       false,
+	Program:                      nil,
+	SourceFile:                   nil,
+	DirectSourceFile:             nil,
+	PreserveParens:               false,
+	Strict:                       false,
+	MaxDepth:                     DEFAULT_MAX_DEPTH,
+	MaxInputSize:                 0,
 }
 
 var warnedAboutEcmaVersion = false
 
+// GetOptions copies opts over DefaultOptions. ecmaVersion, SourceType and
+// MaxDepth get their default when they're left at the zero value, the other
+// fields are used as they are.
 func GetOptions(opts *Options) *Options {
-	options := &Options{}
+	// Work on a copy so per-parse options don't leak into DefaultOptions
+	defaults := DefaultOptions
+	options := &defaults
 
-	if opts == nil {
-		options = &DefaultOptions
-	} else {
-		options = &DefaultOptions
-		if opts.ecmaVersion != nil {
-			options.ecmaVersion = opts.ecmaVersion
+	if opts != nil {
+		*options = *opts
+		if options.ecmaVersion == nil {
+			options.ecmaVersion = DefaultOptions.ecmaVersion
+		}
+		if options.SourceType == "" {
+			options.SourceType = DefaultOptions.SourceType
 		}
-		if opts.SourceType != "" {
-			options.SourceType = opts.SourceType
+		if options.MaxDepth == 0 {
+			options.MaxDepth = DefaultOptions.MaxDepth
 		}
 	}
 
@@ -85,13 +105,6 @@ func GetOptions(opts *Options) *Options {
 		}
 	}
 
-	if opts == nil || !opts.AllowHashBang {
-		ecmaVer, ok := options.ecmaVersion.(int)
-		if ok && ecmaVer >= 14 {
-			options.AllowHashBang = true
-		}
-	}
-
 	if tokens, ok := options.OnToken.([]interface{}); ok {
 		options.OnToken = func(token interface{}) {
 			tokens = append(tokens, token)
@@ -58,6 +58,11 @@ type Parser struct {
 	PrivateNameStack         []*PrivateName
 	InTemplateElement        bool
 	InClassStaticBlock       bool
+	// The first error of the tokenizer, most callers of next don't check
+	// its result so GetAst reports it
+	tokenErr error
+	// How deep the recursive descent currently is, see enterDepth
+	depth int
 }
 
 func GetAst(input []byte, options *Options, startPos int) (*Node, error) {
@@ -68,6 +73,10 @@ func GetAst(input []byte, options *Options, startPos int) (*Node, error) {
 	options = opts
 	p.SourceFile = options.SourceFile
 
+	if options.MaxInputSize > 0 && len(input) > options.MaxInputSize {
+		return nil, errors.New("Input is larger than the maximum size of " + strconv.Itoa(options.MaxInputSize) + " bytes")
+	}
+
 	if p.getEcmaVersion() >= 6 {
 		p.Keywords = WordsRegexp(syntaxKeywords["6"])
 	} else {
@@ -141,7 +150,7 @@ func GetAst(input []byte, options *Options, startPos int) (*Node, error) {
 
 	// Figure out if it's a module code.
 	p.InModule = options.SourceType == "module"
-	p.Strict = p.InModule || p.strictDirective(p.pos)
+	p.Strict = p.InModule || options.Strict || p.strictDirective(p.pos)
 
 	// Used to signify the start of a potential arrow function
 	p.PotentialArrowAt = -1
@@ -155,7 +164,7 @@ func GetAst(input []byte, options *Options, startPos int) (*Node, error) {
 	p.UndefinedExports = map[string]*Node{}
 
 	// If enabled, skip leading hashbang line.
-	if p.pos == 0 && options.AllowHashBang && string(p.input[0:2]) == "#!" {
+	if p.pos == 0 && options.AllowHashBang && bytes.HasPrefix(p.input, []byte("#!")) {
 		p.skipLineComment(2)
 	}
 
@@ -172,9 +181,15 @@ func GetAst(input []byte, options *Options, startPos int) (*Node, error) {
 	p.PrivateNameStack = []*PrivateName{}
 	p.initAllUpdateContext()
 
-	p.nextToken()
+	if err := p.nextToken(); err != nil {
+		return nil, err
+	}
 	node, err := p.parseTopLevel(p.startNode())
 
+	// Parse errors after a tokenizer error are caused by the broken token
+	if p.tokenErr != nil {
+		return nil, p.tokenErr
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -182,6 +197,20 @@ func GetAst(input []byte, options *Options, startPos int) (*Node, error) {
 	return node, nil
 }
 
+// enterDepth guards the functions that nested syntax recurses through, each
+// call has to be paired with exitDepth
+func (p *Parser) enterDepth() error {
+	p.depth++
+	if p.depth > p.options.MaxDepth {
+		return p.raise(p.start, "Maximum nesting depth exceeded")
+	}
+	return nil
+}
+
+func (p *Parser) exitDepth() {
+	p.depth--
+}
+
 func (p *Parser) inFunction() bool {
 	return p.currentVarScope().Flags&SCOPE_FUNCTION == SCOPE_FUNCTION
 }
@@ -225,7 +254,7 @@ func (p *Parser) allowNewDotTarget() bool {
 			return true
 		}
 	}
-	return false
+	return p.options.AllowNewDotTarget
 }
 
 func (p *Parser) treatFunctionsAsVar() bool {
@@ -238,17 +267,32 @@ func (p *Parser) getEcmaVersion() int {
 	panic("Ecma verion was set to something weird")
 }
 
+// SyntaxError is the error GetAst returns for invalid input
+type SyntaxError struct {
+	Message string
+	// Pos is the offset in the input, -1 when the position was mapped to
+	// another file by a source map
+	Pos        int
+	Line       int // from 1
+	Column     int // from 0
+	SourceFile string
+}
+
+func (e *SyntaxError) Error() string {
+	message := e.Message + " (" + strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column) + ")"
+	if e.SourceFile != "" {
+		message += " in " + e.SourceFile
+	}
+	return message
+}
+
 func (p *Parser) raise(pos int, message string) error {
 	loc := getLineInfo(p.input, pos)
-	line := strconv.Itoa(loc.Line)
-	column := strconv.Itoa(loc.Column)
-	message += strings.Join([]string{" (", line, ":", column, ")"}, "")
-
+	err := &SyntaxError{Message: message, Pos: pos, Line: loc.Line, Column: loc.Column}
 	if p.SourceFile != nil {
-		message += strings.Join([]string{" in ", *p.SourceFile}, "")
+		err.SourceFile = *p.SourceFile
 	}
-
-	return errors.New(message)
+	return err
 }
 
 func (p *Parser) raiseRecoverable(pos int, message string) error {
@@ -265,7 +309,7 @@ Loop:
 		case 32, 160: // ' '
 			p.pos = p.pos + size
 		case 13:
-			if p.input[p.pos+size] == 10 {
+			if p.byteAt(p.pos+size) == 10 {
 				p.pos = p.pos + size
 			}
 			fallthrough
@@ -276,7 +320,7 @@ Loop:
 				p.LineStart = p.pos
 			}
 		case 47: // '/'
-			switch p.input[p.pos+1] {
+			switch p.byteAt(p.pos + 1) {
 			case 42: // '*'
 				p.skipBlockComment()
 			case 47:
@@ -2,10 +2,14 @@ package parser
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+
+	"go_js/jsstring"
 )
 
 func getTestInput(fileNum string) []byte {
@@ -2842,7 +2846,7 @@ func TestUnexpectedKeyword1(t *testing.T) {
 
 func TestUnexpectedKeyword2(t *testing.T) {
 	input := getTestInput("fail_2")
-	_, err := GetAst(input, nil, 0)
+	_, err := GetAst(input, &Options{SourceType: "module"}, 0)
 
 	if err == nil {
 		t.Error("Expected parser to return error")
@@ -2853,10 +2857,9 @@ func TestUnexpectedKeyword2(t *testing.T) {
 	}
 }
 
-// In solitude this tests passes, but with full suite it fails :thinking:
 func TestUnexpectedKeyword3(t *testing.T) {
 	input := getTestInput("fail_3")
-	_, err := GetAst(input, nil, 0)
+	_, err := GetAst(input, &Options{SourceType: "module"}, 0)
 
 	if err == nil {
 		t.Error("Expected parser to return error")
@@ -2879,3 +2882,216 @@ func TestUnexpectedKeyword4(t *testing.T) {
 		t.Errorf("Expected: `Assignin to rvalue (1:0)` Got: %s", err.Error())
 	}
 }
+
+func TestRegExpLiteral(t *testing.T) {
+	actual, err := GetAst([]byte("let re = /(?<year>\\d{4})-\\1/giu;"), nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to generate AST %s", err.Error())
+	}
+
+	literal := actual.Body[0].Declarations[0].Initializer
+	if literal.Regex == nil || literal.Regex.Pattern != "(?<year>\\d{4})-\\1" || literal.Regex.Flags != "giu" {
+		t.Errorf("Unexpected regex %v", literal.Regex)
+	}
+
+	// ES2025 syntax at the default ecmaVersion
+	for _, input := range []string{"/(?<a>x)|(?<a>y)/", "/(?i:a)(?-m:^b)/m", "/\\p{RGI_Emoji}/v"} {
+		if _, err := GetAst([]byte(input), nil, 0); err != nil {
+			t.Errorf("Failed to parse %s: %s", input, err.Error())
+		}
+	}
+}
+
+func TestInvalidRegExp(t *testing.T) {
+	tests := map[string]string{
+		"/a/gg":           "Duplicate regular expression flag (1:1)",
+		"/a/x":            "Invalid regular expression flag (1:1)",
+		"/(?<a>.)\\k<b>/": "Invalid regular expression: /(?<a>.)\\k<b>/: Invalid named capture referenced (1:1)",
+		"/a{2,1}/":        "Invalid regular expression: /a{2,1}/: numbers out of order in {} quantifier (1:1)",
+	}
+
+	for input, expected := range tests {
+		_, err := GetAst([]byte(input), nil, 0)
+		if err == nil {
+			t.Errorf("Expected %s to be invalid", input)
+			continue
+		}
+		if err.Error() != expected {
+			t.Errorf("Expected: `%s` Got: %s", expected, err.Error())
+		}
+	}
+}
+
+func TestStringLiteralCodeUnits(t *testing.T) {
+	actual, err := GetAst([]byte("let a = \"\\ud83d\\ude00\", b = \"\\uD800\", c = tag`\\u{1F600}\\r\\n${a}\\unicode`;"), nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to generate AST %s", err.Error())
+	}
+	declarations := actual.Body[0].Declarations
+
+	if a := declarations[0].Initializer.Value.(jsstring.String); a.Len() != 2 || a != jsstring.New("😀") {
+		t.Errorf("Expected a surrogate pair, got %#v", a)
+	}
+	if b := declarations[1].Initializer.Value.(jsstring.String); b.Len() != 1 || b.Unit(0) != 0xD800 {
+		t.Errorf("Expected a lone surrogate, got %#v", b)
+	}
+
+	quasis := declarations[2].Initializer.Quasi.Quasis
+	if cooked := quasis[0].TmplValue.Cooked; cooked == nil || *cooked != jsstring.New("😀\r\n") {
+		t.Errorf("Unexpected cooked value %#v", cooked)
+	}
+	if quasis[1].TmplValue.Cooked != nil || quasis[1].TmplValue.Raw != "\\unicode" {
+		t.Errorf("Expected an invalid escape to leave the cooked value undefined")
+	}
+}
+
+func TestInvalidStringEscape(t *testing.T) {
+	tests := map[string]string{
+		"x = '\\u{110000}'":         "Code point out of bounds (1:8)",
+		"x = '\\u{12'":              "Bad character escape sequence (1:8)",
+		"x = '\\xZ1'":               "Bad character escape sequence (1:7)",
+		"x = `\\u{12`":              "Bad escape sequence in untagged template literal (1:5)",
+		"export { '\\uD800' as x }": "An export name cannot include a lone surrogate. (1:9)",
+	}
+
+	for input, expected := range tests {
+		_, err := GetAst([]byte(input), &Options{SourceType: "module"}, 0)
+		if err == nil {
+			t.Errorf("Expected %s to be invalid", input)
+			continue
+		}
+		if err.Error() != expected {
+			t.Errorf("Expected: `%s` Got: %s", expected, err.Error())
+		}
+	}
+}
+
+func TestNumericLiteralValues(t *testing.T) {
+	actual, err := GetAst([]byte("x = [0x1F, 0o17, 0b1_01, 1_000.5e-1, 017, 019, .5, 5., 0xFFFFFFFFFFFFFFFFF, 123456789012345678901234567890n, 0xffn]"), nil, 0)
+	if err != nil {
+		t.Fatalf("Failed to generate AST %s", err.Error())
+	}
+
+	values := []string{}
+	for _, element := range actual.Body[0].Expression.Right.Elements {
+		values = append(values, fmt.Sprint(element.Value))
+	}
+	expected := []string{"31", "15", "5", "100.05", "15", "19", "0.5", "5", "2.9514790517935283e+20", "123456789012345678901234567890", "255"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
+
+func TestEvalContextOptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  *Options
+		expected string
+	}{
+		{"super.x", nil, "'super' keyword outside a method (1:0)"},
+		{"super.x", &Options{AllowSuperOutsideMethod: true}, ""},
+		{"() => new.target", nil, "'new.target' can only be used in functions and class static block (1:6)"},
+		{"() => new.target", &Options{AllowNewDotTarget: true}, ""},
+		{"with (a) {}", nil, ""},
+		{"with (a) {}", &Options{Strict: true}, "'with' in strict mode (1:0)"},
+		{"'use strict'; with (a) {}", nil, "'with' in strict mode (1:14)"},
+		{"'use strict'\nwith (a) {}", nil, "'with' in strict mode (2:0)"},
+		{"var eval", &Options{Strict: true}, "Binding eval in strict mode (1:4)"},
+		{"await x", &Options{AllowAwaitOutsideFunction: true}, ""},
+		{"#!x\n1", nil, ""},
+		{"#!x\n1", &Options{AllowHashBang: true}, ""},
+		{"#!x\n1", &Options{AllowHashBang: false}, "Unexpected character '#' (1:1)"},
+		{"#x in a", nil, "Unexpected token: len(forInit) != 0 || len(p.PrivateNameStack) == 0 && !p.options.AllowUndeclaredPrivateFields (1:2)"},
+		{"#x in a", &Options{AllowUndeclaredPrivateFields: true}, ""},
+		{"var enum", &Options{AllowReserved: ALLOW_RESERVED_TRUE}, ""},
+		{"var enum", nil, "The keyword enum is reserved (1:4)"},
+	}
+
+	for _, test := range tests {
+		_, err := GetAst([]byte(test.input), test.options, 0)
+		if err == nil && test.expected != "" {
+			t.Errorf("Expected %s to be invalid with %+v", test.input, test.options)
+		} else if err != nil && err.Error() != test.expected {
+			t.Errorf("Expected: `%s` Got: %s", test.expected, err.Error())
+		}
+	}
+
+	ast, err := GetAst([]byte("a = (1)"), &Options{Ranges: true, PreserveParens: true}, 0)
+	if err != nil {
+		t.Fatalf("Failed to get AST: %s", err.Error())
+	}
+	if right := ast.Body[0].Expression.Right; right.Type != NODE_PARENTHESIZED_EXPRESSION || right.Range != [2]int{4, 7} {
+		t.Errorf("Expected a parenthesized expression with a range, got %v %v", right.Type, right.Range)
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	n := 100000
+	inputs := []string{
+		strings.Repeat("(", n) + "1" + strings.Repeat(")", n),
+		strings.Repeat("[", n) + strings.Repeat("]", n),
+		"x = " + strings.Repeat("{a:", n) + "1" + strings.Repeat("}", n),
+		strings.Repeat("{", n) + strings.Repeat("}", n),
+		strings.Repeat("!", n) + "x",
+		strings.Repeat("new ", n) + "X",
+		strings.Repeat("a => ", n) + "a",
+		strings.Repeat("f(", n) + strings.Repeat(")", n),
+		strings.Repeat("`${", n) + "1" + strings.Repeat("}`", n),
+		"let " + strings.Repeat("[", n) + "a" + strings.Repeat("]", n) + " = x",
+		strings.Repeat("if (x) ", n) + ";",
+	}
+	for _, input := range inputs {
+		_, err := GetAst([]byte(input), nil, 0)
+		if err == nil || !strings.HasPrefix(err.Error(), "Maximum nesting depth exceeded") {
+			t.Errorf("Expected %s… to exceed the nesting depth, got %v", input[:20], err)
+		}
+	}
+
+	// Regexp literals are checked by jsregexp, which has its own limit
+	for _, input := range []string{"/" + strings.Repeat("(", n) + strings.Repeat(")", n) + "/", "/" + strings.Repeat("[", n) + strings.Repeat("]", n) + "/v"} {
+		if _, err := GetAst([]byte(input), nil, 0); err == nil || !strings.HasSuffix(err.Error(), "Maximum nesting depth exceeded (1:1)") {
+			t.Errorf("Expected %s… to exceed the nesting depth, got an error of %d bytes", input[:20], len(fmt.Sprint(err)))
+		}
+	}
+
+	// Long chains of binary operators don't nest
+	if _, err := GetAst([]byte(strings.Repeat("a + ", n)+"1"), nil, 0); err != nil {
+		t.Errorf("Failed to parse a long chain of operators: %s", err.Error())
+	}
+
+	input := []byte(strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100))
+	if _, err := GetAst(input, nil, 0); err != nil {
+		t.Errorf("Failed to parse 100 parentheses: %s", err.Error())
+	}
+	if _, err := GetAst(input, &Options{MaxDepth: 50}, 0); err == nil || err.Error() != "Maximum nesting depth exceeded (1:16)" {
+		t.Errorf("Expected a lower MaxDepth to apply, got %v", err)
+	}
+
+	if _, err := GetAst([]byte("let a = 1"), &Options{MaxInputSize: 8}, 0); err == nil || err.Error() != "Input is larger than the maximum size of 8 bytes" {
+		t.Errorf("Expected MaxInputSize to apply, got %v", err)
+	}
+	if _, err := GetAst([]byte("let a = 1"), &Options{MaxInputSize: 9}, 0); err != nil {
+		t.Errorf("Failed to parse input of the maximum size: %s", err.Error())
+	}
+}
+
+// FuzzGetAst checks that no input crashes the parser, everything has to come
+// back as an AST or an error
+func FuzzGetAst(f *testing.F) {
+	for i := 1; i <= 25; i++ {
+		f.Add(string(getTestInput(fmt.Sprint(i))), false)
+	}
+	for _, seed := range []string{"", "0", "void 0", "a?.b", "/(?<a>x)\\k<a>/v", "`${`${1}`}`", "'use strict'; with (a) {}", "((((((((((", "#!x", "<!--", "a\n-->", "0x", "1e", ".5", "...", "class { #a; static { } }",
+		"let", "async", "A?0", "`0", "'use strict'\n", "class A{0\"", "0\n0A", "typeof 0", "0\n-->\r\"", "<!--\n\"", "switch (0) { case 0: break a }"} {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+
+	f.Fuzz(func(t *testing.T, input string, module bool) {
+		options := &Options{MaxDepth: 500}
+		if module {
+			options.SourceType = "module"
+		}
+		GetAst([]byte(input), options, 0)
+	})
+}
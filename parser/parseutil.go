@@ -4,7 +4,7 @@ import (
 	"regexp"
 )
 
-var literal = regexp.MustCompile(`^(?:'((?:\\[^]|[^'\\])*?)'|\"((?:\\[^]|[^"\\])*?)")`)
+var literal = regexp.MustCompile(`^(?:'((?:\\[\s\S]|[^'\\])*?)'|"((?:\\[\s\S]|[^"\\])*?)")`)
 
 func (p *Parser) eat(token Token) bool {
 	if p.Type.identifier == token {
@@ -163,7 +163,6 @@ func (p *Parser) strictDirective(start int) bool {
 				return true
 			}
 
-			lineBreak := regexp.MustCompile(`\n|\r\n?|\u2028|\u2029`)
 			if lineBreak.MatchString(spaceAfter) {
 				quote := match[0][0]
 				if next == 0 || !regexp.MustCompile(`[(\[.`+string(quote)+`+\-/*%<>=,?\^&]`).MatchString(string(next)) {
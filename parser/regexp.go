@@ -1,17 +1,49 @@
 package parser
 
-import "regexp"
+import (
+	"regexp"
+
+	"go_js/jsregexp"
+)
 
 var lineBreak = regexp.MustCompile("\r\n?|\n|\u2028|\u2029")
 
+// RegExpState holds the regular expression literal being validated
 type RegExpState struct {
+	validFlags string
+	start      int
+	source     string
+	flags      string
+	value      *jsregexp.RegExp
 }
 
-func (res *RegExpState) reset(i int, s string, sp string) {
-	panic("Unimplemented")
+// RegExpValue is the token value of a regular expression literal
+type RegExpValue struct {
+	Pattern string
+	Flags   string
+	Value   *jsregexp.RegExp
+}
 
+func (res *RegExpState) reset(start int, pattern string, flags string) {
+	res.start = start
+	res.source = pattern
+	res.flags = flags
+	res.value = nil
 }
 
 func (p *Parser) NewRegExpState() *RegExpState {
-	return &RegExpState{}
+	validFlags := "gim"
+	if p.getEcmaVersion() >= 6 {
+		validFlags += "uy"
+	}
+	if p.getEcmaVersion() >= 9 {
+		validFlags += "s"
+	}
+	if p.getEcmaVersion() >= 13 {
+		validFlags += "d"
+	}
+	if p.getEcmaVersion() >= 15 {
+		validFlags += "v"
+	}
+	return &RegExpState{validFlags: validFlags}
 }
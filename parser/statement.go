@@ -1,9 +1,12 @@
 package parser
 
 import (
+	"bytes"
 	"errors"
 	"slices"
 	"strings"
+
+	"go_js/jsstring"
 )
 
 func (p *Parser) parseTopLevel(node *Node) (*Node, error) {
@@ -28,6 +31,10 @@ func (p *Parser) parseTopLevel(node *Node) (*Node, error) {
 }
 
 func (p *Parser) parseStatement(context string, topLevel bool, exports map[string]*Node) (*Node, error) {
+	if err := p.enterDepth(); err != nil {
+		return nil, err
+	}
+	defer p.exitDepth()
 	//p.printState()
 	startType, node := p.Type, p.startNode()
 	kind := KIND_NOT_INITIALIZED
@@ -198,7 +205,7 @@ func (p *Parser) parseStatement(context string, topLevel bool, exports map[strin
 			skip := skipWhiteSpace.Find((p.input[p.pos:]))
 
 			next := p.pos + len(skip)
-			nextCh := p.input[next]
+			nextCh := p.byteAt(next)
 
 			if nextCh == '(' || nextCh == '.' {
 				expression, err := p.parseExpression("", nil)
@@ -344,7 +351,7 @@ func (p *Parser) isAsyncFunction() bool {
 	}
 
 	return !lineBreak.Match(p.input[p.pos:next]) &&
-		string(p.input[next:next+8]) == "function" &&
+		bytes.HasPrefix(p.input[next:], []byte("function")) &&
 		(next+8 == len(p.input) ||
 			!(IsIdentifierChar(after, false) /*|| after > 0xd7ff && after < 0xdc00*/))
 }
@@ -369,6 +376,12 @@ func (p *Parser) parseExport(node *Node, exports map[string]*Node) (*Node, error
 			return nil, err
 		}
 
+		declaration, err := p.parseExportDefaultDeclaration()
+		if err != nil {
+			return nil, err
+		}
+		node.Declaration = declaration
+
 		return p.finishNode(node, NODE_EXPORT_DEFAULT_DECLARATION), nil
 	}
 
@@ -413,8 +426,8 @@ func (p *Parser) parseExport(node *Node, exports map[string]*Node) (*Node, error
 		node.Specifiers = specifiers
 
 		if p.eatContextual("from") {
-			if p.Type.identifier == TOKEN_STRING {
-				return nil, p.unexpected("Can't have STRING as current type", nil)
+			if p.Type.identifier != TOKEN_STRING {
+				return nil, p.unexpected("Expected TOKEN_STRING", nil)
 			}
 			exprAtom, err := p.parseExprAtom(nil, "", false)
 
@@ -464,6 +477,35 @@ func (p *Parser) parseExport(node *Node, exports map[string]*Node) (*Node, error
 	return p.finishNode(node, NODE_EXPORT_NAMED_DECLARATION), nil
 }
 
+func (p *Parser) parseExportDefaultDeclaration() (*Node, error) {
+	isAsync := p.isAsyncFunction()
+	if p.Type.identifier == TOKEN_FUNCTION || isAsync {
+		fNode := p.startNode()
+		p.next(false)
+		if isAsync {
+			p.next(false)
+		}
+		fun, err := p.parseFunction(fNode, FUNC_STATEMENT|FUNC_NULLABLE_ID, false, isAsync, "")
+		return fun, err
+	}
+
+	if p.Type.identifier == TOKEN_CLASS {
+		cNode := p.startNode()
+		class, err := p.parseClass(cNode, true)
+		return class, err
+	}
+
+	declaration, err := p.parseMaybeAssign("", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = p.semicolon()
+	if err != nil {
+		return nil, err
+	}
+	return declaration, nil
+}
+
 func (p *Parser) checkLocalExport(opts *Node) {
 	if slices.Index(p.ScopeStack[0].Lexical, opts.Name) == -1 &&
 		slices.Index(p.ScopeStack[0].Var, opts.Name) == -1 {
@@ -519,7 +561,7 @@ func (p *Parser) parseExportSpecifier(exports map[string]*Node) (*Node, error) {
 	} else {
 		node.Exported = node.Local
 	}
-	p.checkExport(
+	err = p.checkExport(
 		exports,
 		struct {
 			s string
@@ -529,6 +571,9 @@ func (p *Parser) parseExportSpecifier(exports map[string]*Node) (*Node, error) {
 		},
 		node.Exported.Start,
 	)
+	if err != nil {
+		return nil, err
+	}
 
 	return p.finishNode(node, NODE_EXPORT_SPECIFIER), nil
 }
@@ -541,12 +586,12 @@ func (p *Parser) parseModuleExportName() (*Node, error) {
 			return nil, err
 		}
 
-		if val, ok := stringLiteral.Value.(string); ok {
-			if loneSurrogate.Match([]byte(val)) {
+		if val, ok := stringLiteral.Value.(jsstring.String); ok {
+			if !val.IsWellFormed() {
 				return nil, p.raise(stringLiteral.Start, "An export name cannot include a lone surrogate.")
 			}
-			return stringLiteral, nil
 		}
+		return stringLiteral, nil
 	}
 	ident, err := p.parseIdent(true)
 	if err != nil {
@@ -660,10 +705,13 @@ func (p *Parser) checkPatternExport(exports map[string]*Node, pat *Node) error {
 
 	switch t {
 	case NODE_IDENTIFIER:
-		p.checkExport(exports, struct {
+		err := p.checkExport(exports, struct {
 			s string
 			n *Node
 		}{n: pat}, pat.Start)
+		if err != nil {
+			return err
+		}
 	case NODE_OBJECT_PATTERN:
 		for _, prop := range pat.Properties {
 			err := p.checkPatternExport(exports, prop)
@@ -731,15 +779,18 @@ func (p *Parser) checkExport(exports map[string]*Node, val struct {
 
 	name := ""
 
-	if len(val.s) == 0 {
-		name = val.n.Name
-	} else {
+	if len(val.s) != 0 {
 		name = val.s
+	} else if val.n.Type == NODE_IDENTIFIER {
+		name = val.n.Name
+	} else if str, ok := val.n.Value.(jsstring.String); ok {
+		name = str.String()
 	}
 
 	if _, found := exports[name]; found {
 		return p.raiseRecoverable(start, "Duplicate export '"+name+"'")
 	}
+	exports[name] = val.n
 
 	return nil
 }
@@ -754,10 +805,13 @@ func (p *Parser) parseExportAllDeclaration(node *Node, exports map[string]*Node)
 
 			node.Exported = moduleExportName
 
-			p.checkExport(exports, struct {
+			err = p.checkExport(exports, struct {
 				s string
 				n *Node
 			}{n: node.Exported}, p.LastTokStart)
+			if err != nil {
+				return nil, err
+			}
 		} else {
 			node.Exported = nil
 		}
@@ -990,7 +1044,7 @@ func (p *Parser) parseEmptyStatement(node *Node) (*Node, error) {
 
 func (p *Parser) parseWithStatement(node *Node) (*Node, error) {
 	if p.Strict {
-		p.raise(p.start, "'with' in strict mode")
+		return nil, p.raise(p.start, "'with' in strict mode")
 	}
 	p.next(false)
 	parenthesizedExpr, err := p.parseParenExpression()
@@ -1251,7 +1305,7 @@ func (p *Parser) isLet(context string) bool {
 	skip := skipWhiteSpace.Find(p.input[p.pos:])
 	next := p.pos + len(skip)
 
-	nextCh := rune(p.input[next])
+	nextCh := rune(p.byteAt(next))
 	// For ambiguous cases, determine if a LexicalDeclaration (or only a
 	// Statement) is allowed here. If context is not empty then only a Statement
 	// is allowed. However, `let [` is an explicit negative lookahead for
@@ -1268,10 +1322,10 @@ func (p *Parser) isLet(context string) bool {
 	}
 	if IsIdentifierStart(nextCh, true) {
 		pos := next + 1
-		nextCh = rune(p.input[pos])
+		nextCh = rune(p.byteAt(pos))
 		for IsIdentifierChar(nextCh, true) {
 			pos = pos + 1
-			nextCh = rune(p.input[pos])
+			nextCh = rune(p.byteAt(pos))
 		}
 		if nextCh == 92 /*|| nextCh > 0xd7ff && nextCh < 0xdc00*/ {
 			return true
@@ -1725,7 +1779,7 @@ func (p *Parser) parseBreakContinueStatement(node *Node, keyword string) (*Node,
 	// Verify that there is an actual destination to break or
 	// continue to.
 	i := 0
-	for i < len(p.Labels) {
+	for ; i < len(p.Labels); i++ {
 		lab := p.Labels[i]
 		if node.Label == nil || lab.Name == node.Label.Name {
 			if len(lab.Kind) != 0 && isBreak || lab.Kind == "loop" {
@@ -1975,7 +2029,7 @@ func (p *Parser) exitClassBody() error {
 	privateNameTop := p.PrivateNameStack[len(p.PrivateNameStack)-1]
 	p.PrivateNameStack = p.PrivateNameStack[:len(p.PrivateNameStack)-1]
 
-	if !p.options.CheckPrivateFields {
+	if p.options.AllowUndeclaredPrivateFields {
 		return nil
 	}
 	stackLength := len(p.PrivateNameStack)
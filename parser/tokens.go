@@ -3,10 +3,15 @@ package parser
 import (
 	"encoding/json"
 	"math"
+	"math/big"
 	"regexp"
 	"strconv"
 	"strings"
 	"unicode/utf8"
+
+	"go_js/jsnum"
+	"go_js/jsregexp"
+	"go_js/jsstring"
 )
 
 // TOKEN
@@ -348,13 +353,26 @@ func (p *Parser) next(ignoreEscapeSequenceInKeyword bool) error {
 
 	p.LastTokEnd = p.End
 	p.LastTokStart = p.start
-	p.LastTokEndLoc = p.startLoc
+	p.LastTokEndLoc = p.EndLoc
 	p.LastTokStartLoc = p.startLoc
-	p.nextToken()
+	if err := p.nextToken(); err != nil {
+		if p.tokenErr == nil {
+			p.tokenErr = err
+		}
+		// The broken token would leave the parser looking at garbage, so
+		// everything after it is treated as the end of the input
+		p.pos = len(p.input)
+		p.start = p.pos
+		if p.options.Locations {
+			p.startLoc = p.currentPosition()
+		}
+		p.finishToken(tokenTypes[TOKEN_EOF], nil)
+		return err
+	}
 	return nil
 }
 
-func (p *Parser) nextToken() {
+func (p *Parser) nextToken() error {
 	context := p.currentContext()
 	if context == nil || !context.PreserveSpace {
 		p.skipSpace()
@@ -367,15 +385,15 @@ func (p *Parser) nextToken() {
 
 	if p.pos >= len(p.input) {
 		p.finishToken(tokenTypes[TOKEN_EOF], nil)
-		return
+		return nil
 	}
 
 	if context.Override != nil {
 		context.Override(p)
-		return
+		return nil
 	} else {
 		ch, size, _ := p.fullCharCodeAtPos()
-		p.readToken(ch, size)
+		return p.readToken(ch, size)
 	}
 }
 
@@ -405,12 +423,11 @@ func (p *Parser) fullCharCodeAtPos() (code rune, size int, err error) {
 	return (r<<10 + next - 0x35FDC00), size + nextSize, nil
 }
 
-func (p *Parser) readToken(code rune, size int) {
+func (p *Parser) readToken(code rune, size int) error {
 	if IsIdentifierStart(code, p.getEcmaVersion() >= 6) || code == 92 {
-		p.readWord()
-		return
+		return p.readWord()
 	}
-	p.getTokenFromCode(code, size)
+	return p.getTokenFromCode(code, size)
 }
 
 func (p *Parser) finishToken(Type *TokenType, value any) {
@@ -427,8 +444,7 @@ func (p *Parser) finishToken(Type *TokenType, value any) {
 func (p *Parser) getTokenFromCode(code rune, size int) error {
 	switch code {
 	case 46: // '.'
-		p.readToken_dot()
-		return nil
+		return p.readToken_dot()
 	case 40: // '('
 		p.pos = p.pos + size
 		p.finishToken(tokenTypes[TOKEN_PARENL], nil)
@@ -484,7 +500,7 @@ func (p *Parser) getTokenFromCode(code rune, size int) error {
 		return nil
 
 	case 48: // '0'
-		next := p.input[p.pos+1]
+		next := p.byteAt(p.pos + 1)
 		if next == 120 || next == 88 { // 'x', 'X'
 			return p.readRadixNumber(16) // hex number
 
@@ -522,12 +538,10 @@ func (p *Parser) getTokenFromCode(code rune, size int) error {
 		return nil
 
 	case 43, 45: // '+', '-'
-		p.readToken_plus_min(code)
-		return nil
+		return p.readToken_plus_min(code)
 
 	case 60, 62: // '<', '>'
-		p.readToken_lt_gt(code)
-		return nil
+		return p.readToken_lt_gt(code)
 
 	case 61, 33: // '=', '!'
 		p.readToken_eq_excl(code)
@@ -556,9 +570,9 @@ func (p *Parser) finishOp(token *TokenType, size int) {
 func (p *Parser) readToken_question() {
 	ecmaVersion := p.options.ecmaVersion.(int)
 	if ecmaVersion >= 11 {
-		next := p.input[p.pos+1]
+		next := p.byteAt(p.pos + 1)
 		if next == 46 {
-			next2 := p.input[p.pos+2]
+			next2 := p.byteAt(p.pos + 2)
 			if next2 < 48 || next2 > 57 {
 				p.finishOp(tokenTypes[TOKEN_QUESTIONDOT], 2)
 				return
@@ -566,7 +580,7 @@ func (p *Parser) readToken_question() {
 		}
 		if next == 63 {
 			if ecmaVersion >= 12 {
-				next2 := p.input[p.pos+2]
+				next2 := p.byteAt(p.pos + 2)
 				if next2 == 61 {
 					p.finishOp(tokenTypes[TOKEN_ASSIGN], 3)
 					return
@@ -580,7 +594,7 @@ func (p *Parser) readToken_question() {
 }
 
 func (p *Parser) readToken_eq_excl(code rune) {
-	next := p.input[p.pos+1]
+	next := p.byteAt(p.pos + 1)
 
 	if code == 61 && next == 62 && p.getEcmaVersion() >= 6 {
 		p.pos += 2
@@ -589,7 +603,7 @@ func (p *Parser) readToken_eq_excl(code rune) {
 	}
 	if next == 61 {
 		size := 2
-		if p.input[p.pos+2] == 61 {
+		if p.byteAt(p.pos+2) == 61 {
 			size = 3 // === or !==
 		}
 		p.finishOp(tokenTypes[TOKEN_EQUALITY], size)
@@ -609,64 +623,64 @@ func (p *Parser) readToken_eq_excl(code rune) {
 	p.finishOp(tokenTypes[TOKEN_PREFIX], 1)
 }
 
-func (p *Parser) readToken_lt_gt(code rune) {
-	next := rune(p.input[p.pos+1])
+func (p *Parser) readToken_lt_gt(code rune) error {
+	next := rune(p.byteAt(p.pos + 1))
 	size := 1
 	if next == code {
-		if code == 62 && p.input[p.pos+2] == 62 {
+		if code == 62 && p.byteAt(p.pos+2) == 62 {
 			size = 3
 		} else {
 			size = 2
 		}
 
-		if p.input[p.pos+size] == 61 {
+		if p.byteAt(p.pos+size) == 61 {
 			p.finishOp(tokenTypes[TOKEN_ASSIGN], size+1)
-			return
+			return nil
 		}
 		p.finishOp(tokenTypes[TOKEN_BITSHIFT], size)
-		return
+		return nil
 	}
-	if next == 33 && code == 60 && !p.InModule && p.input[p.pos+2] == 45 &&
-		p.input[p.pos+3] == 45 {
+	if next == 33 && code == 60 && !p.InModule && p.byteAt(p.pos+2) == 45 &&
+		p.byteAt(p.pos+3) == 45 {
 		// `<!--`, an XML-style comment that should be interpreted as a line comment
 		p.skipLineComment(4)
 		p.skipSpace()
-		p.nextToken()
-		return
+		return p.nextToken()
 	}
 	if next == 61 {
 		size = 2
 	}
 	p.finishOp(tokenTypes[TOKEN_RELATIONAL], size)
+	return nil
 }
 
-func (p *Parser) readToken_plus_min(code rune) {
-	next := rune(p.input[p.pos+1])
+func (p *Parser) readToken_plus_min(code rune) error {
+	next := rune(p.byteAt(p.pos + 1))
 	if next == code {
-		if next == 45 && !p.InModule && p.input[p.pos+2] == 62 &&
+		if next == 45 && !p.InModule && p.byteAt(p.pos+2) == 62 &&
 			(p.LastTokEnd == 0 || lineBreak.Match([]byte(p.input[p.LastTokEnd:p.pos]))) {
 			// A `-->` line comment
 			p.skipLineComment(3)
 			p.skipSpace()
-			p.nextToken()
-			return
+			return p.nextToken()
 		}
 		p.finishOp(tokenTypes[TOKEN_INCDEC], 2)
-		return
+		return nil
 	}
 	if next == 61 {
 		p.finishOp(tokenTypes[TOKEN_ASSIGN], 2)
-		return
+		return nil
 	}
 	p.finishOp(tokenTypes[TOKEN_PLUSMIN], 1)
+	return nil
 }
 
 func (p *Parser) skipLineComment(startSkip int) {
-	ch := p.input[p.pos+startSkip]
+	ch := p.byteAt(p.pos + startSkip)
 	p.pos = p.pos + startSkip
 	for p.pos < len(p.input) && !isNewLine(rune(ch)) {
 		p.pos = p.pos + 1
-		ch = p.input[p.pos]
+		ch = p.byteAt(p.pos)
 	}
 
 	if p.options.OnComment != nil {
@@ -679,7 +693,7 @@ func (p *Parser) skipLineComment(startSkip int) {
 }
 
 func (p *Parser) readToken_caret() {
-	next := p.input[p.pos+1]
+	next := p.byteAt(p.pos + 1)
 	if next == 61 {
 		p.finishOp(tokenTypes[TOKEN_ASSIGN], 2)
 		return
@@ -688,10 +702,10 @@ func (p *Parser) readToken_caret() {
 }
 
 func (p *Parser) readToken_pipe_amp(code rune) {
-	next := rune(p.input[p.pos+1])
+	next := rune(p.byteAt(p.pos + 1))
 	if next == code {
 		if p.getEcmaVersion() >= 12 {
-			next2 := p.input[p.pos+2]
+			next2 := p.byteAt(p.pos + 2)
 			if next2 == 61 {
 				p.finishOp(tokenTypes[TOKEN_ASSIGN], 3)
 				return
@@ -721,7 +735,7 @@ func (p *Parser) readToken_pipe_amp(code rune) {
 }
 
 func (p *Parser) readToken_mult_modulo_exp(code rune) {
-	next := p.input[p.pos+1]
+	next := p.byteAt(p.pos + 1)
 	size := 1
 
 	var tokenType *TokenType
@@ -736,7 +750,7 @@ func (p *Parser) readToken_mult_modulo_exp(code rune) {
 	if p.getEcmaVersion() >= 7 && code == 42 && next == 42 {
 		size = size + 1
 		tokenType = tokenTypes[TOKEN_STAR]
-		next = p.input[p.pos+2]
+		next = p.byteAt(p.pos + 2)
 	}
 
 	if next == 61 {
@@ -748,7 +762,7 @@ func (p *Parser) readToken_mult_modulo_exp(code rune) {
 }
 
 func (p *Parser) readToken_slash() error {
-	next := p.input[p.pos+1]
+	next := p.byteAt(p.pos + 1)
 	if p.ExprAllowed {
 		p.pos = p.pos + 1
 		return p.readRegexp()
@@ -762,7 +776,7 @@ func (p *Parser) readToken_slash() error {
 }
 
 func (p *Parser) readRegexp() error {
-	escaped, inClass, start := p.pos == 0, p.pos == 0, p.pos
+	escaped, inClass, start := false, false, p.pos
 	for {
 		if p.pos >= len(p.input) {
 			return p.raise(start, "Unterminated regular expression")
@@ -810,37 +824,54 @@ func (p *Parser) readRegexp() error {
 	}
 
 	state.reset(start, string(pattern), flags)
-	p.validateRegExpFlags(state)
-	p.validateRegExpPattern(state)
-
-	// Create Literal#value property value.
-
-	value := &regexp.Regexp{} // new RegExp(pattern, flags)
+	err = p.validateRegExpFlags(state)
+	if err != nil {
+		return err
+	}
+	err = p.validateRegExpPattern(state)
+	if err != nil {
+		return err
+	}
 
-	p.finishToken(tokenTypes[TOKEN_REGEXP], struct {
-		pattern string
-		flags   string
-		value   *regexp.Regexp
-	}{
-		pattern: string(pattern),
-		flags:   flags,
-		value:   value,
+	p.finishToken(tokenTypes[TOKEN_REGEXP], &RegExpValue{
+		Pattern: state.source,
+		Flags:   state.flags,
+		Value:   state.value,
 	})
 	return nil
 }
 
-func (p *Parser) validateRegExpPattern(state *RegExpState) {
-	panic("unimplemented")
+func (p *Parser) validateRegExpPattern(state *RegExpState) error {
+	value, err := jsregexp.New(state.source, state.flags)
+	if err != nil {
+		return p.raise(state.start, err.Error())
+	}
+	state.value = value
+	return nil
 }
 
-func (p *Parser) validateRegExpFlags(state *RegExpState) {
-	panic("unimplemented")
+func (p *Parser) validateRegExpFlags(state *RegExpState) error {
+	u, v := false, false
+	for i, flag := range state.flags {
+		if !strings.ContainsRune(state.validFlags, flag) {
+			return p.raise(state.start, "Invalid regular expression flag")
+		}
+		if strings.ContainsRune(state.flags[i+1:], flag) {
+			return p.raise(state.start, "Duplicate regular expression flag")
+		}
+		u = u || flag == 'u'
+		v = v || flag == 'v'
+	}
+	if p.getEcmaVersion() >= 15 && u && v {
+		return p.raise(state.start, "Invalid regular expression flag")
+	}
+	return nil
 }
 
 func (p *Parser) readString(quote rune) error {
 	p.pos = p.pos + 1
-	// Potential improvement: Use bytes.Buffer
-	out, chunkStart := []byte{}, p.pos
+	var out jsstring.Builder
+	chunkStart := p.pos
 	for {
 		if p.pos >= len(p.input) {
 			return p.raise(p.start, "Unterminated string constant")
@@ -850,16 +881,17 @@ func (p *Parser) readString(quote rune) error {
 			break
 		}
 		if ch == 92 { // '\'
-			out = append(out, p.input[chunkStart:p.pos]...)
-			escapedChar, _ := p.readEscapedChar(false)
-			out = append(out, []byte(escapedChar)...)
+			out.AppendString(string(p.input[chunkStart:p.pos]))
+			if err := p.readEscapedChar(&out, false); err != nil {
+				return err
+			}
 			chunkStart = p.pos
 		} else if ch == 0x2028 || ch == 0x2029 {
 			if p.getEcmaVersion() < 10 {
 				return p.raise(p.start, "Unterminated string constant")
 
 			}
-			p.pos = p.pos + 1
+			p.pos = p.pos + size
 			if p.options.Locations {
 				p.CurLine++
 				p.LineStart = p.pos
@@ -871,9 +903,9 @@ func (p *Parser) readString(quote rune) error {
 			p.pos = p.pos + size
 		}
 	}
-	out = append(out, p.input[chunkStart:p.pos]...)
+	out.AppendString(string(p.input[chunkStart:p.pos]))
 	p.pos = p.pos + 1
-	p.finishToken(tokenTypes[TOKEN_STRING], out)
+	p.finishToken(tokenTypes[TOKEN_STRING], out.String())
 	return nil
 }
 
@@ -887,18 +919,16 @@ func (p *Parser) readNumber(startsWithDot bool) error {
 	if octal && p.Strict {
 		return p.raise(start, "Invalid number")
 	}
-	next := math.MaxInt
-	if p.pos < len(p.input) {
-		next = int(p.input[p.pos])
-	}
+	next := p.peekByte()
 
 	if !octal && !startsWithDot && p.getEcmaVersion() >= 11 && next == 110 {
 		val := stringToBigInt(p.input[start:p.pos])
 		p.pos = p.pos + 1
-		ch, _, _ := p.fullCharCodeAtPos()
-		if IsIdentifierStart(ch, false) {
-			return p.raise(p.pos, "Identifier directly after number")
-
+		if p.pos < len(p.input) {
+			ch, _, _ := p.fullCharCodeAtPos()
+			if IsIdentifierStart(ch, false) {
+				return p.raise(p.pos, "Identifier directly after number")
+			}
 		}
 		p.finishToken(tokenTypes[TOKEN_NUM], val)
 		return nil
@@ -910,11 +940,11 @@ func (p *Parser) readNumber(startsWithDot bool) error {
 	if next == 46 && !octal { // '.'
 		p.pos = p.pos + 1
 		p.readInt(10, nil, false)
-		next = int(p.input[p.pos])
+		next = p.peekByte()
 	}
 	if (next == 69 || next == 101) && !octal { // 'eE'
 		p.pos = p.pos + 1
-		next = int(p.input[p.pos])
+		next = p.peekByte()
 		if next == 43 || next == 45 { // '+-'
 			p.pos = p.pos + 1
 		}
@@ -924,10 +954,11 @@ func (p *Parser) readNumber(startsWithDot bool) error {
 			return p.raise(start, "Invalid number")
 		}
 	}
-	ch, _, _ := p.fullCharCodeAtPos()
-
-	if IsIdentifierStart(ch, false) {
-		return p.raise(p.pos, "Identifier directly after number")
+	if p.pos < len(p.input) {
+		ch, _, _ := p.fullCharCodeAtPos()
+		if IsIdentifierStart(ch, false) {
+			return p.raise(p.pos, "Identifier directly after number")
+		}
 	}
 
 	val := stringToNumber(p.input[start:p.pos], octal)
@@ -935,35 +966,55 @@ func (p *Parser) readNumber(startsWithDot bool) error {
 	return nil
 }
 
+// byteAt is the byte at pos, 0 past the end of the input
+func (p *Parser) byteAt(pos int) byte {
+	if pos < len(p.input) {
+		return p.input[pos]
+	}
+	return 0
+}
+
+// peekByte returns the byte at p.pos, or -1 at the end of the input
+func (p *Parser) peekByte() int {
+	if p.pos < len(p.input) {
+		return int(p.input[p.pos])
+	}
+	return -1
+}
+
+// stringToNumber is the value of a numeric literal, which the tokenizer
+// already checked
 func stringToNumber(b []byte, octal bool) float64 {
-	/*
-			This is missing and I don't have patience to do it
-			  if (isLegacyOctalNumericLiteral) {
-		    return parseInt(str, 8)
-		  }
-	*/
-
-	numToConvert := strings.Replace(string(b), "_", "", -1)
-	num, _ := strconv.ParseFloat(numToConvert, 64)
-	return num
+	str := strings.ReplaceAll(string(b), "_", "")
+	if octal {
+		return jsnum.ParseInt(str, 8)
+	}
+	return jsnum.StringToNumber(str)
 }
-func stringToBigInt(b []byte) int {
-	panic("unimplemented")
+
+// stringToBigInt is the value of a BigInt literal without its n suffix
+func stringToBigInt(b []byte) *big.Int {
+	val, _ := jsnum.StringToBigInt(strings.ReplaceAll(string(b), "_", ""))
+	return val
 }
 
 func (p *Parser) readRadixNumber(radix int) error {
 	start := p.pos
 	p.pos += 2 // 0x
-	val, err := p.readInt(radix, nil, false)
+	_, err := p.readInt(radix, nil, false)
 	if err != nil {
 		return p.raise(p.start+2, string("Expected number in radix ")+strconv.Itoa(radix))
 	}
-	ch, _, _ := p.fullCharCodeAtPos()
-	if p.getEcmaVersion() >= 11 && p.input[p.pos] == 110 {
+	var val any = stringToNumber(p.input[start:p.pos], false)
+	if p.getEcmaVersion() >= 11 && p.peekByte() == 110 {
 		val = stringToBigInt(p.input[start:p.pos])
 		p.pos = p.pos + 1
-	} else if IsIdentifierStart(ch, false) {
-		return p.raise(p.pos, "Identifier directly after number")
+	}
+	if p.pos < len(p.input) {
+		ch, _, _ := p.fullCharCodeAtPos()
+		if IsIdentifierStart(ch, false) {
+			return p.raise(p.pos, "Identifier directly after number")
+		}
 	}
 	p.finishToken(tokenTypes[TOKEN_NUM], val)
 	return nil
@@ -1046,15 +1097,14 @@ func (p *Parser) readInvalidTemplateToken() error {
 }
 
 func (p *Parser) readTmplToken() error {
-	// Potential improvement: use bytes.Buffer
-	out := []byte{}
+	var out jsstring.Builder
 	chunkStart := p.pos
 	for {
 		if p.pos >= len(p.input) {
 			return p.raise(p.start, "Unterminated template")
 		}
 		ch := p.input[p.pos]
-		if ch == 96 || ch == 36 && p.input[p.pos+1] == 123 { // '`', '${'
+		if ch == 96 || ch == 36 && p.byteAt(p.pos+1) == 123 { // '`', '${'
 			if p.pos == p.start && p.Type.identifier == TOKEN_TEMPLATE || p.Type.identifier == TOKEN_INVALIDTEMPLATE {
 				if ch == 36 {
 					p.pos += 2
@@ -1066,29 +1116,31 @@ func (p *Parser) readTmplToken() error {
 					return nil
 				}
 			}
-			out = append(out, p.input[chunkStart:p.pos]...)
+			out.AppendString(string(p.input[chunkStart:p.pos]))
 
-			p.finishToken(tokenTypes[TOKEN_TEMPLATE], out)
+			p.finishToken(tokenTypes[TOKEN_TEMPLATE], out.String())
 			return nil
 		}
 
 		if ch == 92 { // '\'
-			out = append(out, p.input[chunkStart:p.pos]...)
-			escaped, _ := p.readEscapedChar(true)
-			out = append(out, []byte(escaped)...)
+			out.AppendString(string(p.input[chunkStart:p.pos]))
+			if err := p.readEscapedChar(&out, true); err != nil {
+				return err
+			}
 			chunkStart = p.pos
 		} else if isNewLine(rune(ch)) {
-			out = append(out, p.input[chunkStart:p.pos]...)
+			out.AppendString(string(p.input[chunkStart:p.pos]))
 			p.pos = p.pos + 1
 			switch ch {
 			case 13:
-				if p.input[p.pos] == 10 {
+				if p.byteAt(p.pos) == 10 {
 					p.pos = p.pos + 1
 				}
+				out.AppendUnit('\n')
 			case 10:
-				out = append(out, "\n"...)
+				out.AppendUnit('\n')
 			default:
-				out = append(out, ch)
+				out.AppendUnit(uint16(ch))
 			}
 			if p.options.Locations {
 				p.CurLine = p.CurLine + 1
@@ -1101,38 +1153,49 @@ func (p *Parser) readTmplToken() error {
 	}
 }
 
-func (p *Parser) readEscapedChar(inTemplate bool) (string, error) {
+// readEscapedChar appends the code units of the escape sequence at p.pos to
+// out, \u escapes can produce lone surrogates
+func (p *Parser) readEscapedChar(out *jsstring.Builder, inTemplate bool) error {
 	if p.pos >= len(p.input) {
-		return "", p.invalidStringToken(p.pos, "Unexpected end of input after backslash")
+		return p.invalidStringToken(p.pos, "Unexpected end of input after backslash")
 	}
 	p.pos = p.pos + 1 // Skip backslash
+	if p.pos >= len(p.input) {
+		return p.invalidStringToken(p.pos, "Unexpected end of input after backslash")
+	}
 	r, size := utf8.DecodeRune(p.input[p.pos:])
 	if r == utf8.RuneError {
 
-		return "", p.invalidStringToken(p.pos, "Invalid UTF-8 sequence")
+		return p.invalidStringToken(p.pos, "Invalid UTF-8 sequence")
 	}
 	p.pos += size
 	ch := int(r)
 
 	switch ch {
 	case 'n':
-		return "\n", nil
+		out.AppendUnit('\n')
 	case 'r':
-		return "\r", nil
+		out.AppendUnit('\r')
 	case 'x':
 		hexCh, err := p.readHexChar(2)
-		return string(hexCh), err
+		if err != nil {
+			return err
+		}
+		out.AppendCodePoint(hexCh)
 	case 'u':
 		code, err := p.readCodePoint()
-		return CodePointToString(code), err
+		if err != nil {
+			return err
+		}
+		out.AppendCodePoint(code)
 	case 't':
-		return "\t", nil
+		out.AppendUnit('\t')
 	case 'b':
-		return "\b", nil
+		out.AppendUnit('\b')
 	case 'v':
-		return "\u000b", nil
+		out.AppendUnit('\v')
 	case 'f':
-		return "\f", nil
+		out.AppendUnit('\f')
 	case '\r':
 		if p.pos < len(p.input) && p.input[p.pos] == '\n' {
 			p.pos = p.pos + size
@@ -1143,15 +1206,14 @@ func (p *Parser) readEscapedChar(inTemplate bool) (string, error) {
 			p.LineStart = p.pos
 			p.CurLine++
 		}
-		return "", nil
 	case '8', '9':
 		if p.Strict {
-			return "", p.invalidStringToken(p.pos-1, "Invalid escape sequence")
+			return p.invalidStringToken(p.pos-1, "Invalid escape sequence")
 		}
 		if inTemplate {
-			return "", p.invalidStringToken(p.pos-1, "Invalid escape sequence in template string")
+			return p.invalidStringToken(p.pos-1, "Invalid escape sequence in template string")
 		}
-		return string(rune(ch)), nil
+		out.AppendUnit(uint16(ch))
 	default:
 		if ch >= '0' && ch <= '7' {
 			// Octal escape: read up to 3 digits
@@ -1168,7 +1230,7 @@ func (p *Parser) readEscapedChar(inTemplate bool) (string, error) {
 			octal, err := strconv.ParseInt(octalStr, 8, 64)
 			if err != nil {
 
-				return "", p.invalidStringToken(startPos, "Invalid octal escape sequence")
+				return p.invalidStringToken(startPos, "Invalid octal escape sequence")
 			}
 			if octal > 255 {
 				octalStr = octalStr[:len(octalStr)-1]
@@ -1186,19 +1248,21 @@ func (p *Parser) readEscapedChar(inTemplate bool) (string, error) {
 					msg = "Octal literal in template string"
 				}
 
-				return "", p.invalidStringToken(startPos, msg)
+				return p.invalidStringToken(startPos, msg)
 			}
-			return string(rune(octal)), nil
+			out.AppendUnit(uint16(octal))
+			return nil
 		}
 		if isNewLine(rune(ch)) {
 			if p.options.Locations {
 				p.LineStart = p.pos
 				p.CurLine++
 			}
-			return "", nil
+			return nil
 		}
-		return string(rune(ch)), nil
+		out.AppendCodePoint(rune(ch))
 	}
+	return nil
 }
 
 func (p *Parser) readWord() error {
@@ -1235,7 +1299,7 @@ func (p *Parser) readWord1() (string, error) {
 			word = p.input[chunkStart:p.pos]
 			escStart := p.pos
 			p.pos = p.pos + size
-			if p.input[p.pos] != 117 { // "u"
+			if p.byteAt(p.pos) != 117 { // "u"
 
 				return "", p.invalidStringToken(p.pos, "Expecting Unicode escape sequence \\uXXXX")
 			}
@@ -1274,7 +1338,7 @@ func (p *Parser) invalidStringToken(pos int, message string) error {
 }
 
 func (p *Parser) readCodePoint() (rune, error) {
-	ch := p.input[p.pos]
+	ch := p.byteAt(p.pos)
 	code := rune(0)
 
 	if ch == 123 { // '{'
@@ -1283,14 +1347,24 @@ func (p *Parser) readCodePoint() (rune, error) {
 		}
 		codePos := p.pos + 1
 		p.pos = p.pos + 1
-		hexCh, _ := p.readHexChar(len(p.input[p.pos:]) + strings.Index(string(p.input[p.pos:]), "}") - p.pos)
+		length := strings.IndexByte(string(p.input[p.pos:]), '}')
+		if length < 0 {
+			return 0, p.invalidStringToken(codePos, "Bad character escape sequence")
+		}
+		hexCh, err := p.readHexChar(length)
+		if err != nil {
+			return 0, err
+		}
 		code = hexCh
 		p.pos = p.pos + 1
 		if code > 0x10FFFF {
 			return 0, p.invalidStringToken(codePos, "Code point out of bounds")
 		}
 	} else {
-		hexCh, _ := p.readHexChar(4)
+		hexCh, err := p.readHexChar(4)
+		if err != nil {
+			return 0, err
+		}
 		code = hexCh
 	}
 	return code, nil
@@ -1313,7 +1387,7 @@ func (p *Parser) readInt(radix int, length *int, maybeLegacyOctalNumericLiteral
 	// `maybeLegacyOctalNumericLiteral` is true if it doesn't have prefix (0x,0o,0b)
 	// and isn't fraction part nor exponent part. In that case, if the first digit
 	// is zero then disallow separators.
-	isLegacyOctalNumericLiteral := maybeLegacyOctalNumericLiteral && p.input[p.pos] == 48
+	isLegacyOctalNumericLiteral := maybeLegacyOctalNumericLiteral && p.byteAt(p.pos) == 48
 
 	start, total, lastCode := p.pos, 0, 0
 	e := 0
@@ -1378,12 +1452,11 @@ func (p *Parser) readInt(radix int, length *int, maybeLegacyOctalNumericLiteral
 }
 
 func (p *Parser) readToken_dot() error {
-	next := p.input[p.pos+1]
+	next, next2 := p.byteAt(p.pos+1), p.byteAt(p.pos+2)
 	if next >= 48 && next <= 57 {
 		return p.readNumber(true)
 	}
 
-	next2 := p.input[p.pos+2]
 	if p.getEcmaVersion() >= 6 && next == 46 && next2 == 46 { // 46 = dot '.'
 		p.pos += 3
 		p.finishToken(tokenTypes[TOKEN_ELLIPSIS], nil)
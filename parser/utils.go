@@ -18,7 +18,6 @@ var AstralIdentifierStartCodes = [598]rune{0, 11, 2, 25, 2, 18, 2, 1, 2, 14, 3,
 
 var nonASCIIwhitespace = regexp.MustCompile("[\u1680\u2000-\u200a\u202f\u205f\u3000\ufeff]")
 var keywordRelationalOperator = regexp.MustCompile("^in(stanceof)?$")
-var loneSurrogate = regexp.MustCompile("")
 var reservedWords = map[string]string{
 	"3":          "abstract boolean byte char class double enum export extends final float goto implements import int interface long native package private protected public short static super synchronized throws transient volatile",
 	"5":          "class enum extends super const export import",
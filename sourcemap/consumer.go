@@ -0,0 +1,158 @@
+package sourcemap
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// segment is one decoded mapping, source is -1 for generated code without
+// an original and name is -1 when there is no name
+type segment struct {
+	column         int
+	source         int
+	originalLine   int
+	originalColumn int
+	name           int
+}
+
+// Consumer looks up original positions in a parsed source map
+type Consumer struct {
+	Map *Map
+	// sources are the Map's sources with the sourceRoot applied
+	sources []string
+	// lines holds the segments of each generated line sorted by column
+	lines [][]segment
+}
+
+// Parse decodes a source map. Index maps with sections aren't supported.
+func Parse(data []byte) (*Consumer, error) {
+	var raw struct {
+		Map
+		Sections json.RawMessage `json:"sections"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Version != 3 {
+		return nil, errors.New("Unsupported source map version")
+	}
+	if raw.Sections != nil {
+		return nil, errors.New("Index source maps aren't supported")
+	}
+
+	m := raw.Map
+	c := &Consumer{Map: &m, sources: make([]string, len(m.Sources))}
+	root := m.SourceRoot
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	for i, source := range m.Sources {
+		c.sources[i] = root + source
+	}
+	if err := c.decode(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Consumer) decode() error {
+	mappings := c.Map.Mappings
+	var line []segment
+	source, originalLine, originalColumn, name := 0, 0, 0, 0
+	column := 0
+	for pos := 0; pos <= len(mappings); {
+		if pos == len(mappings) || mappings[pos] == ';' {
+			sort.SliceStable(line, func(i, j int) bool { return line[i].column < line[j].column })
+			c.lines = append(c.lines, line)
+			line, column = nil, 0
+			pos++
+			continue
+		}
+		if mappings[pos] == ',' {
+			pos++
+			continue
+		}
+
+		var fields [5]int
+		count := 0
+		for pos < len(mappings) && mappings[pos] != ',' && mappings[pos] != ';' {
+			if count == len(fields) {
+				return errors.New("Too many fields in a mapping segment")
+			}
+			value, next, err := readVLQ(mappings, pos)
+			if err != nil {
+				return err
+			}
+			fields[count], pos = value, next
+			count++
+		}
+		if count != 1 && count != 4 && count != 5 {
+			return errors.New("Invalid number of fields in a mapping segment")
+		}
+
+		column += fields[0]
+		seg := segment{column: column, source: -1, name: -1}
+		if count >= 4 {
+			source += fields[1]
+			originalLine += fields[2]
+			originalColumn += fields[3]
+			if source < 0 || source >= len(c.sources) {
+				return errors.New("Mapping refers to a missing source")
+			}
+			seg.source, seg.originalLine, seg.originalColumn = source, originalLine, originalColumn
+		}
+		if count == 5 {
+			name += fields[4]
+			if name < 0 || name >= len(c.Map.Names) {
+				return errors.New("Mapping refers to a missing name")
+			}
+			seg.name = name
+		}
+		line = append(line, seg)
+	}
+	return nil
+}
+
+// Sources are the sources of the map with the sourceRoot applied
+func (c *Consumer) Sources() []string {
+	return c.sources
+}
+
+// OriginalPosition finds where the code at a generated position came from.
+// It uses the closest mapping at or before the column on the same line, and
+// reports false when there is none or it has no original.
+func (c *Consumer) OriginalPosition(line, column int) (Mapping, bool) {
+	if line < 1 || line > len(c.lines) {
+		return Mapping{}, false
+	}
+	segments := c.lines[line-1]
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].column > column }) - 1
+	if i < 0 || segments[i].source < 0 {
+		return Mapping{}, false
+	}
+
+	seg := segments[i]
+	m := Mapping{
+		GeneratedLine:   line,
+		GeneratedColumn: seg.column,
+		Source:          c.sources[seg.source],
+		OriginalLine:    seg.originalLine + 1,
+		OriginalColumn:  seg.originalColumn,
+	}
+	if seg.name >= 0 {
+		m.Name = c.Map.Names[seg.name]
+	}
+	return m, true
+}
+
+// SourceContent is the embedded text of a source, if the map has it
+func (c *Consumer) SourceContent(source string) (string, bool) {
+	for i, s := range c.sources {
+		if s == source && i < len(c.Map.SourcesContent) && c.Map.SourcesContent[i] != nil {
+			return *c.Map.SourcesContent[i], true
+		}
+	}
+	return "", false
+}
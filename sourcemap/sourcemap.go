@@ -0,0 +1,154 @@
+// Package sourcemap reads and writes Source Map v3 files, which map
+// positions in generated JavaScript back to the files it was compiled from.
+//
+// Lines count from 1 and columns from 0, like parser.Location. The format
+// itself counts columns in UTF-16 code units.
+package sourcemap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"go_js/parser"
+)
+
+// Map is the JSON form of a source map
+type Map struct {
+	Version        int       `json:"version"`
+	File           string    `json:"file,omitempty"`
+	SourceRoot     string    `json:"sourceRoot,omitempty"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent,omitempty"`
+	Names          []string  `json:"names"`
+	Mappings       string    `json:"mappings"`
+}
+
+// DataURL encodes the map for an inline sourceMappingURL comment
+func (m *Map) DataURL() string {
+	data, _ := json.Marshal(m)
+	return "data:application/json;base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// Mapping connects a position in the generated file to a position in one of
+// the sources. A mapping without a Source marks generated code that has no
+// original.
+type Mapping struct {
+	GeneratedLine   int
+	GeneratedColumn int
+	Source          string
+	OriginalLine    int
+	OriginalColumn  int
+	Name            string
+}
+
+// Generator collects mappings while code is generated and encodes them.
+// Nothing in this tree prints JavaScript yet (main.go dumps the AST as JSON),
+// so an AST printer or transform calls AddNode as it writes each node.
+type Generator struct {
+	file        string
+	sources     []string
+	sourceIndex map[string]int
+	contents    map[string]string
+	names       []string
+	nameIndex   map[string]int
+	mappings    []Mapping
+}
+
+func NewGenerator(file string) *Generator {
+	return &Generator{file: file, sourceIndex: map[string]int{}, contents: map[string]string{}, nameIndex: map[string]int{}}
+}
+
+func (g *Generator) AddMapping(m Mapping) {
+	if m.Source != "" {
+		if _, found := g.sourceIndex[m.Source]; !found {
+			g.sourceIndex[m.Source] = len(g.sources)
+			g.sources = append(g.sources, m.Source)
+		}
+		if m.Name != "" {
+			if _, found := g.nameIndex[m.Name]; !found {
+				g.nameIndex[m.Name] = len(g.names)
+				g.names = append(g.names, m.Name)
+			}
+		}
+	}
+	g.mappings = append(g.mappings, m)
+}
+
+// AddNode maps the generated position to the start of node in source. The
+// node needs a Location, so the source has to be parsed with the Locations
+// option. Identifiers keep their name.
+func (g *Generator) AddNode(line, column int, source string, node *parser.Node) {
+	if node.Location == nil || node.Location.Start == nil {
+		return
+	}
+	m := Mapping{GeneratedLine: line, GeneratedColumn: column, Source: source, OriginalLine: node.Location.Start.Line, OriginalColumn: node.Location.Start.Column}
+	if node.Type == parser.NODE_IDENTIFIER {
+		m.Name = node.Name
+	}
+	g.AddMapping(m)
+}
+
+// SetSourceContent embeds the text of a source in the map, so consumers
+// don't have to find the file
+func (g *Generator) SetSourceContent(source, content string) {
+	if _, found := g.sourceIndex[source]; !found {
+		g.sourceIndex[source] = len(g.sources)
+		g.sources = append(g.sources, source)
+	}
+	g.contents[source] = content
+}
+
+// Map encodes the mappings added so far
+func (g *Generator) Map() *Map {
+	mappings := append([]Mapping(nil), g.mappings...)
+	sort.SliceStable(mappings, func(i, j int) bool {
+		if mappings[i].GeneratedLine != mappings[j].GeneratedLine {
+			return mappings[i].GeneratedLine < mappings[j].GeneratedLine
+		}
+		return mappings[i].GeneratedColumn < mappings[j].GeneratedColumn
+	})
+
+	// Every field is relative to the same field of the previous segment,
+	// the generated column only within a line
+	var b []byte
+	line, column, source, originalLine, originalColumn, name := 1, 0, 0, 0, 0, 0
+	for i, m := range mappings {
+		if m.GeneratedLine > line {
+			for ; line < m.GeneratedLine; line++ {
+				b = append(b, ';')
+			}
+			column = 0
+		} else if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = appendVLQ(b, m.GeneratedColumn-column)
+		column = m.GeneratedColumn
+		if m.Source == "" {
+			continue
+		}
+		b = appendVLQ(b, g.sourceIndex[m.Source]-source)
+		source = g.sourceIndex[m.Source]
+		// Lines are stored from 0
+		b = appendVLQ(b, m.OriginalLine-1-originalLine)
+		originalLine = m.OriginalLine - 1
+		b = appendVLQ(b, m.OriginalColumn-originalColumn)
+		originalColumn = m.OriginalColumn
+		if m.Name != "" {
+			b = appendVLQ(b, g.nameIndex[m.Name]-name)
+			name = g.nameIndex[m.Name]
+		}
+	}
+
+	m := &Map{Version: 3, File: g.file, Sources: append([]string{}, g.sources...), Names: append([]string{}, g.names...), Mappings: string(b)}
+	if len(g.contents) > 0 {
+		m.SourcesContent = make([]*string, len(g.sources))
+		for i, source := range g.sources {
+			if content, found := g.contents[source]; found {
+				m.SourcesContent[i] = &content
+			}
+		}
+	}
+	return m
+}
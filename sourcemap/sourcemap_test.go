@@ -0,0 +1,161 @@
+package sourcemap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"go_js/parser"
+)
+
+func TestVLQ(t *testing.T) {
+	tests := map[int]string{0: "A", 1: "C", -1: "D", 15: "e", 16: "gB", 123: "2H", -1000: "x+B", 1 << 28: "gggggQ"}
+	for n, expected := range tests {
+		if s := string(appendVLQ(nil, n)); s != expected {
+			t.Errorf("Expected %d to encode as %s, got %s", n, expected, s)
+		}
+		if value, pos, err := readVLQ(expected, 0); err != nil || value != n || pos != len(expected) {
+			t.Errorf("Expected %s to decode as %d, got %d", expected, n, value)
+		}
+	}
+	for _, s := range []string{"", "g", "!", "gggggggggA"} {
+		if _, _, err := readVLQ(s, 0); err == nil {
+			t.Errorf("Expected %q to be invalid", s)
+		}
+	}
+}
+
+func newTestGenerator() *Generator {
+	g := NewGenerator("app.js")
+	g.AddMapping(Mapping{GeneratedLine: 2, GeneratedColumn: 10})
+	g.AddMapping(Mapping{GeneratedLine: 1, GeneratedColumn: 0, Source: "app.ts", OriginalLine: 1, OriginalColumn: 0})
+	g.AddMapping(Mapping{GeneratedLine: 1, GeneratedColumn: 8, Source: "app.ts", OriginalLine: 1, OriginalColumn: 12, Name: "x"})
+	g.AddMapping(Mapping{GeneratedLine: 2, GeneratedColumn: 2, Source: "app.ts", OriginalLine: 3, OriginalColumn: 6})
+	g.SetSourceContent("app.ts", "let x: number = 1")
+	return g
+}
+
+func TestGenerator(t *testing.T) {
+	m := newTestGenerator().Map()
+	if m.Mappings != "AAAA,QAAYA;EAEN,Q" {
+		t.Errorf("Unexpected mappings %s", m.Mappings)
+	}
+	if len(m.Sources) != 1 || m.Sources[0] != "app.ts" || len(m.Names) != 1 || m.Names[0] != "x" {
+		t.Errorf("Unexpected sources %v and names %v", m.Sources, m.Names)
+	}
+	if len(m.SourcesContent) != 1 || *m.SourcesContent[0] != "let x: number = 1" {
+		t.Error("Expected the source content to be embedded")
+	}
+
+	ast, err := parser.GetAst([]byte("let a = 1\n  foo(bar)"), &parser.Options{Locations: true}, 0)
+	if err != nil {
+		t.Fatalf("Failed to get AST: %s", err.Error())
+	}
+	g := NewGenerator("out.js")
+	g.AddNode(1, 0, "in.js", ast.Body[1].Expression.Arguments[0])
+	if m := g.Map(); m.Mappings != "AACMA" || m.Names[0] != "bar" {
+		t.Errorf("Unexpected mappings %s for a node", m.Mappings)
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	c, err := Parse([]byte(`{"version":3,"sources":["app.ts"],"sourceRoot":"src","names":["x"],"mappings":"AAAA,QAAYA;EAEN,Q","sourcesContent":["let x"]}`))
+	if err != nil {
+		t.Fatalf("Failed to parse source map: %s", err.Error())
+	}
+
+	tests := []struct {
+		line, column int
+		expected     Mapping
+	}{
+		{1, 0, Mapping{GeneratedLine: 1, GeneratedColumn: 0, Source: "src/app.ts", OriginalLine: 1, OriginalColumn: 0}},
+		{1, 7, Mapping{GeneratedLine: 1, GeneratedColumn: 0, Source: "src/app.ts", OriginalLine: 1, OriginalColumn: 0}},
+		{1, 50, Mapping{GeneratedLine: 1, GeneratedColumn: 8, Source: "src/app.ts", OriginalLine: 1, OriginalColumn: 12, Name: "x"}},
+		{2, 5, Mapping{GeneratedLine: 2, GeneratedColumn: 2, Source: "src/app.ts", OriginalLine: 3, OriginalColumn: 6}},
+	}
+	for _, test := range tests {
+		if m, ok := c.OriginalPosition(test.line, test.column); !ok || m != test.expected {
+			t.Errorf("Expected %d:%d to map to %+v, got %+v", test.line, test.column, test.expected, m)
+		}
+	}
+	for _, position := range [][2]int{{2, 1}, {2, 10}, {3, 0}, {0, 0}} {
+		if m, ok := c.OriginalPosition(position[0], position[1]); ok {
+			t.Errorf("Expected %v not to be mapped, got %+v", position, m)
+		}
+	}
+	if content, ok := c.SourceContent("src/app.ts"); !ok || content != "let x" {
+		t.Error("Expected the embedded source content")
+	}
+
+	invalid := []string{
+		`{"version":2,"sources":[],"names":[],"mappings":""}`,
+		`{"version":3,"sections":[]}`,
+		`{"version":3,"sources":[],"names":[],"mappings":"AAAA"}`,
+		`{"version":3,"sources":["a"],"names":[],"mappings":"AA"}`,
+		`{"version":3,"sources":["a"],"names":[],"mappings":"AAAAC"}`,
+		`{"version":3,"sources":["a"],"names":[],"mappings":"A!"}`,
+	}
+	for _, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Expected %s to be invalid", data)
+		}
+	}
+}
+
+func TestFindURL(t *testing.T) {
+	tests := map[string]string{
+		"a()\n//# sourceMappingURL=a.js.map":                              "a.js.map",
+		"a()\r\n//@ sourceMappingURL=a.js.map\r\n":                        "a.js.map",
+		"//# sourceMappingURL=old.map\na()\n//# sourceMappingURL=new.map": "new.map",
+		"a() //# sourceMappingURL=a.js.map":                               "",
+		"s = '\\\n//# sourceMappingURL=a b'":                              "",
+		"a()":                                                             "",
+	}
+	for source, expected := range tests {
+		if url := FindURL([]byte(source)); url != expected {
+			t.Errorf("Expected %q to have the URL %q, got %q", source, expected, url)
+		}
+	}
+}
+
+func TestRemapError(t *testing.T) {
+	g := NewGenerator("app.js")
+	g.AddMapping(Mapping{GeneratedLine: 1, GeneratedColumn: 0, Source: "../src/app.ts", OriginalLine: 4, OriginalColumn: 2})
+	g.AddMapping(Mapping{GeneratedLine: 1, GeneratedColumn: 6, Source: "../src/app.ts", OriginalLine: 4, OriginalColumn: 10})
+	g.AddMapping(Mapping{GeneratedLine: 1, GeneratedColumn: 8, Source: "../src/app.ts", OriginalLine: 5, OriginalColumn: 0})
+	mapData := []byte(`{"version":3,"sources":["../src/app.ts"],"names":[],"mappings":"` + g.Map().Mappings + `"}`)
+
+	fsys := fstest.MapFS{
+		"dist/app.js":      {Data: []byte("let a = ;\n//# sourceMappingURL=app.js.map")},
+		"dist/app.js.map":  {Data: mapData},
+		"dist/inline.js":   {Data: []byte("/*😀*/ = ;\n//# sourceMappingURL=" + g.Map().DataURL())},
+		"dist/missing.js":  {Data: []byte("let a = ;\n//# sourceMappingURL=missing.js.map")},
+		"dist/external.js": {Data: []byte("let a = ;\n//# sourceMappingURL=https://example.com/a.map")},
+	}
+
+	// The emoji is 4 bytes but 2 UTF-16 code units, the error in inline.js
+	// is at column 9 for the parser and column 7 for the source map
+	tests := map[string]string{
+		"dist/app.js":      " (5:0) in src/app.ts",
+		"dist/inline.js":   " (4:10) in src/app.ts",
+		"dist/missing.js":  " (1:8) in dist/missing.js",
+		"dist/external.js": " (1:8) in dist/external.js",
+	}
+	for name, expected := range tests {
+		source := fsys[name].Data
+		_, err := parser.GetAst(source, &parser.Options{SourceFile: &name}, 0)
+		err = RemapError(err, fsys, name, source)
+		if err == nil || !strings.HasSuffix(err.Error(), expected) {
+			t.Errorf("Expected `%s` for %s, got %v", expected, name, err)
+		}
+	}
+
+	if _, err := Load(fsys, "dist/app.js", []byte("a()")); err != ErrNoSourceMap {
+		t.Errorf("Expected ErrNoSourceMap, got %v", err)
+	}
+	other := errors.New("other")
+	if err := RemapError(other, fsys, "dist/app.js", fsys["dist/app.js"].Data); err != other {
+		t.Error("Expected other errors to be returned unchanged")
+	}
+}
@@ -0,0 +1,130 @@
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"go_js/parser"
+)
+
+// ErrNoSourceMap is returned by Load for sources without a sourceMappingURL
+var ErrNoSourceMap = errors.New("No sourceMappingURL comment")
+
+// FindURL returns the URL of the last sourceMappingURL comment in source,
+// "" when there is none. Comments have to be on a line of their own, like
+// compilers write them.
+func FindURL(source []byte) string {
+	found := ""
+	for len(source) > 0 {
+		line := source
+		if i := bytes.IndexAny(source, "\r\n"); i >= 0 {
+			line, source = source[:i], source[i+1:]
+		} else {
+			source = nil
+		}
+
+		line = bytes.TrimSpace(line)
+		for _, prefix := range []string{"//# sourceMappingURL=", "//@ sourceMappingURL="} {
+			if rest, ok := bytes.CutPrefix(line, []byte(prefix)); ok && len(rest) > 0 && !bytes.ContainsAny(rest, " \t'\"") {
+				found = string(rest)
+			}
+		}
+	}
+	return found
+}
+
+// Load reads the source map of the file name in fsys. Data URLs are decoded
+// in place, other URLs are paths relative to the file. Sources in the map
+// are resolved against the map's location, so they are paths in fsys too.
+func Load(fsys fs.FS, name string, source []byte) (*Consumer, error) {
+	mapURL := FindURL(source)
+	if mapURL == "" {
+		return nil, ErrNoSourceMap
+	}
+
+	dir := path.Dir(name)
+	var data []byte
+	if rest, ok := strings.CutPrefix(mapURL, "data:"); ok {
+		header, payload, found := strings.Cut(rest, ",")
+		if !found {
+			return nil, errors.New("Invalid source map data URL")
+		}
+		var err error
+		if strings.HasSuffix(header, ";base64") {
+			data, err = base64.StdEncoding.DecodeString(payload)
+		} else {
+			var unescaped string
+			unescaped, err = url.PathUnescape(payload)
+			data = []byte(unescaped)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid source map data URL: %w", err)
+		}
+	} else {
+		parsed, err := url.Parse(mapURL)
+		if err != nil || parsed.Scheme != "" && parsed.Scheme != "file" {
+			return nil, fmt.Errorf("Cannot load source map '%s'", mapURL)
+		}
+		mapPath := parsed.Path
+		if strings.HasPrefix(mapPath, "/") {
+			mapPath = path.Clean(strings.TrimLeft(mapPath, "/"))
+		} else {
+			mapPath = path.Join(dir, mapPath)
+		}
+		if !fs.ValidPath(mapPath) {
+			return nil, fmt.Errorf("Cannot load source map '%s' from '%s'", mapURL, name)
+		}
+		if data, err = fs.ReadFile(fsys, mapPath); err != nil {
+			return nil, fmt.Errorf("Cannot load source map '%s': %w", mapURL, err)
+		}
+		dir = path.Dir(mapPath)
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	for i, source := range c.sources {
+		if !strings.HasPrefix(source, "/") && !strings.Contains(source, ":") {
+			c.sources[i] = path.Join(dir, source)
+		}
+	}
+	return c, nil
+}
+
+// RemapError moves a parser.SyntaxError in the file name to the original
+// source when the file has a source map. Any other error, or one that can't
+// be mapped, is returned unchanged.
+func RemapError(err error, fsys fs.FS, name string, source []byte) error {
+	var syntaxErr *parser.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Pos < 0 || syntaxErr.Pos > len(source) {
+		return err
+	}
+	c, loadErr := Load(fsys, name, source)
+	if loadErr != nil {
+		return err
+	}
+
+	// The parser counts columns in bytes, source maps in UTF-16 code units
+	lineStart := max(syntaxErr.Pos-syntaxErr.Column, 0)
+	column := 0
+	for _, r := range string(source[lineStart:syntaxErr.Pos]) {
+		if r > 0xFFFF {
+			column += 2
+		} else {
+			column++
+		}
+	}
+
+	original, ok := c.OriginalPosition(syntaxErr.Line, column)
+	if !ok {
+		return err
+	}
+	return &parser.SyntaxError{Message: syntaxErr.Message, Pos: -1, Line: original.OriginalLine, Column: original.OriginalColumn, SourceFile: original.Source}
+}
@@ -0,0 +1,66 @@
+package sourcemap
+
+import "errors"
+
+// BASE64 VLQ
+//
+// Mappings are written as base64 digits holding 5 bits each, the 6th bit
+// says another digit follows. The lowest bit of the first digit is the sign.
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+var errInvalidVLQ = errors.New("Invalid VLQ in mappings")
+
+var base64Values = func() [256]int8 {
+	var values [256]int8
+	for i := range values {
+		values[i] = -1
+	}
+	for i := 0; i < len(base64Digits); i++ {
+		values[base64Digits[i]] = int8(i)
+	}
+	return values
+}()
+
+func appendVLQ(b []byte, n int) []byte {
+	value := n << 1
+	if n < 0 {
+		value = (-n << 1) | 1
+	}
+	for {
+		digit := value & 0x1F
+		value >>= 5
+		if value > 0 {
+			digit |= 0x20
+		}
+		b = append(b, base64Digits[digit])
+		if value == 0 {
+			return b
+		}
+	}
+}
+
+// readVLQ decodes the number at s[pos:] and returns it with the position
+// after it
+func readVLQ(s string, pos int) (int, int, error) {
+	value, shift := 0, 0
+	for {
+		if pos >= len(s) || shift > 30 {
+			return 0, pos, errInvalidVLQ
+		}
+		digit := base64Values[s[pos]]
+		if digit < 0 {
+			return 0, pos, errInvalidVLQ
+		}
+		pos++
+		value |= int(digit&0x1F) << shift
+		shift += 5
+		if digit&0x20 == 0 {
+			break
+		}
+	}
+	if value&1 == 1 {
+		return -(value >> 1), pos, nil
+	}
+	return value >> 1, pos, nil
+}